@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/plar/rentals-api/auth"
+	"github.com/plar/rentals-api/config"
+	"github.com/plar/rentals-api/domain"
+	"github.com/plar/rentals-api/repository"
+)
+
+const apiKeyUsage = `Usage:
+  rentals-api apikey create -name NAME [-scopes rentals:read,rentals:export] [-rate N] [-burst N] [config flags]
+  rentals-api apikey list [config flags]
+  rentals-api apikey revoke [config flags] PREFIX`
+
+// runAPIKey implements `rentals-api apikey create|list|revoke`, it returns the process exit code.
+// The key is printed once by create, only its hash is stored.
+func runAPIKey(log *zap.Logger, args []string) int {
+	if len(args) == 0 || (args[0] != "create" && args[0] != "list" && args[0] != "revoke") {
+		fmt.Fprintln(os.Stderr, apiKeyUsage)
+		return 2
+	}
+	command, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("apikey "+command, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), apiKeyUsage)
+		fs.PrintDefaults()
+	}
+	var (
+		name   *string
+		scopes *string
+		rate   *float64
+		burst  *int
+	)
+	if command == "create" {
+		name = fs.String("name", "", "partner name")
+		actions := make([]string, len(auth.Actions))
+		for i, action := range auth.Actions {
+			actions[i] = string(action)
+		}
+		scopes = fs.String("scopes", string(auth.ActionRead), "comma separated scopes: "+strings.Join(actions, ", "))
+		rate = fs.Float64("rate", 0, "requests per second (default: rate_limit.key_rate)")
+		burst = fs.Int("burst", 0, "burst (default: rate_limit.key_burst)")
+	}
+	cfg, err := config.Load(fs, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	} else if err != nil {
+		log.Error("Invalid configuration", zap.Error(err))
+		return 2
+	}
+
+	db, err := openDB(log, cfg)
+	if err != nil {
+		log.Error("Failed to connect to database", zap.Error(err))
+		return 1
+	}
+	defer closeDB(log, db)
+	repo := repository.NewAPIKeyRepository(db)
+	ctx := context.Background()
+
+	switch command {
+	case "create":
+		if *name == "" {
+			fs.Usage()
+			return 2
+		}
+		key := domain.APIKey{Name: *name, Rate: *rate, Burst: *burst}
+		for _, scope := range strings.Split(*scopes, ",") {
+			if scope = strings.TrimSpace(scope); scope == "" {
+				continue
+			}
+			// a key with a misspelled scope would be denied every call
+			if _, err = auth.ParseAction(scope); err != nil {
+				log.Error("Invalid scope", zap.String("scope", scope), zap.Error(err))
+				return 2
+			}
+			key.Scopes = append(key.Scopes, scope)
+		}
+		if key.Rate <= 0 {
+			key.Rate = cfg.RateLimit.KeyRate
+		}
+		if key.Burst < 1 {
+			key.Burst = cfg.RateLimit.KeyBurst
+		}
+
+		var plain string
+		if plain, key.Prefix, key.Hash, err = auth.GenerateAPIKey(); err != nil {
+			log.Error("Cannot generate API key", zap.Error(err))
+			return 1
+		}
+		if key, err = repo.Create(ctx, key); err != nil {
+			log.Error("Cannot create API key", zap.Error(err))
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "API key %s created for %s, store it now, it cannot be shown again:\n", key.Prefix, key.Name)
+		fmt.Println(plain)
+	case "list":
+		keys, err := repo.List(ctx)
+		if err != nil {
+			log.Error("Cannot list API keys", zap.Error(err))
+			return 1
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		if err = enc.Encode(keys); err != nil {
+			log.Error("Cannot write API keys", zap.Error(err))
+			return 1
+		}
+	case "revoke":
+		if fs.NArg() != 1 {
+			fs.Usage()
+			return 2
+		}
+		if err = repo.Revoke(ctx, fs.Arg(0)); err != nil {
+			log.Error("Cannot revoke API key", zap.String("prefix", fs.Arg(0)), zap.Error(err))
+			return 1
+		}
+	}
+	return 0
+}
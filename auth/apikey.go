@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/plar/rentals-api/domain"
+)
+
+// APIKeyHeader is the request header of the partner API keys
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyPrefix starts every key, it makes leaked keys easy to find with secret scanners
+const apiKeyPrefix = "rk_"
+
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// GenerateAPIKey returns a new random key, its public prefix and the hash to store. The key is shown
+// to its owner once and never stored.
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	id := make([]byte, 4)
+	secret := make([]byte, 32)
+	if _, err = rand.Read(id); err != nil {
+		return "", "", "", err
+	}
+	if _, err = rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+	prefix = apiKeyPrefix + hex.EncodeToString(id)
+	key = prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	return key, prefix, HashAPIKey(key), nil
+}
+
+// HashAPIKey is the SHA-256 of the key, the keys have 256 bits of entropy so a slow hash is not needed
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+type APIKeyAuthenticator struct {
+	repo domain.APIKeyRepository
+}
+
+func NewAPIKeyAuthenticator(repo domain.APIKeyRepository) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{repo: repo}
+}
+
+// Authenticate looks the key up and returns it with the identity of its partner. Unknown and revoked
+// keys wrap ErrInvalidAPIKey, any other error is a lookup failure.
+func (a *APIKeyAuthenticator) Authenticate(ctx context.Context, key string) (domain.APIKey, Identity, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return domain.APIKey{}, Identity{}, fmt.Errorf("%w: malformed key", ErrInvalidAPIKey)
+	}
+
+	apiKey, err := a.repo.FindByHash(ctx, HashAPIKey(key))
+	if errors.Is(err, domain.ErrAPIKeyNotFound) {
+		return domain.APIKey{}, Identity{}, fmt.Errorf("%w: unknown key", ErrInvalidAPIKey)
+	} else if err != nil {
+		return domain.APIKey{}, Identity{}, err
+	}
+	if apiKey.RevokedAt != nil {
+		return domain.APIKey{}, Identity{}, fmt.Errorf("%w: key %s is revoked", ErrInvalidAPIKey, apiKey.Prefix)
+	}
+
+	scopes := append([]string{}, apiKey.Scopes...)
+	return apiKey, Identity{
+		Subject: "apikey:" + apiKey.Prefix,
+		Roles:   []string{string(RolePartner)},
+		Scopes:  scopes,
+	}, nil
+}
@@ -0,0 +1,36 @@
+package auth_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/plar/rentals-api/auth"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, prefix, hash, err := auth.GenerateAPIKey()
+	require.NoError(t, err)
+
+	assert.Regexp(t, regexp.MustCompile(`^rk_[0-9a-f]{8}_[A-Za-z0-9_-]{43}$`), key)
+	assert.Equal(t, key[:len(prefix)], prefix)
+	assert.Equal(t, auth.HashAPIKey(key), hash)
+	assert.NotContains(t, hash, key)
+
+	other, _, _, err := auth.GenerateAPIKey()
+	require.NoError(t, err)
+	assert.NotEqual(t, key, other)
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	partner := auth.Identity{Subject: "apikey:rk_0011aabb", Roles: []string{"partner"}, Scopes: []string{"rentals:read"}}
+
+	assert.NoError(t, auth.DefaultPolicy.Authorize(partner, auth.ActionRead))
+	// partners may export, the key is not scoped for it
+	assert.ErrorContains(t, auth.DefaultPolicy.Authorize(partner, auth.ActionExport), "scope not granted to the API key")
+
+	partner.Scopes = []string{}
+	assert.ErrorIs(t, auth.DefaultPolicy.Authorize(partner, auth.ActionRead), auth.ErrForbidden)
+}
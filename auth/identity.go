@@ -0,0 +1,34 @@
+package auth
+
+import "context"
+
+// Identity is the authenticated caller, taken from the sub and roles claims of the bearer token
+// or from the API key
+type Identity struct {
+	Subject string   `json:"sub"`
+	Roles   []string `json:"roles"`
+	// Scopes is nil for bearer tokens, API keys are restricted further to the actions of their scopes
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+func (i Identity) HasRole(role string) bool {
+	for _, r := range i.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type identityKey struct{}
+
+// NewContext returns a copy of ctx which carries id
+func NewContext(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity of the caller, ok is false for anonymous requests
+func FromContext(ctx context.Context) (id Identity, ok bool) {
+	id, ok = ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
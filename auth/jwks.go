@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// LoadJWKS reads the RSA signing keys of a JWKS file (RFC 7517) indexed by key ID,
+// keys of other types and encryption keys are skipped
+func LoadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read JWKS: %w", err)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err = json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS %s: %w", path, err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for i, k := range set.Keys {
+		if k.Kty != "RSA" || k.Use == "enc" || (k.Alg != "" && k.Alg != "RS256") {
+			continue
+		}
+		key, err := k.rsaPublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWKS key #%d (kid %q): %w", i, k.Kid, err)
+		}
+		if _, ok := keys[k.Kid]; ok {
+			return nil, fmt.Errorf("duplicate JWKS key ID %q", k.Kid)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS %s has no RS256 signing key", path)
+	}
+	return keys, nil
+}
+
+func (k jwk) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("exponent: %w", err)
+	}
+	if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+		return nil, errors.New("missing or malformed modulus or exponent")
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
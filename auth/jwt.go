@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/plar/rentals-api/config"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims are the claims of the bearer tokens
+type Claims struct {
+	Roles []string `json:"roles,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Authenticator verifies HS256 tokens with the shared secret and RS256 tokens with the JWKS keys
+type Authenticator struct {
+	secret  []byte
+	rsaKeys map[string]*rsa.PublicKey
+	parser  *jwt.Parser
+}
+
+func NewAuthenticator(cfg config.AuthConfig) (*Authenticator, error) {
+	a := &Authenticator{}
+	if cfg.JWTSecret != "" {
+		a.secret = []byte(cfg.JWTSecret)
+	}
+	if cfg.JWKSFile != "" {
+		keys, err := LoadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		a.rsaKeys = keys
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg()}),
+		jwt.WithLeeway(cfg.Leeway),
+		jwt.WithIssuedAt(),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	a.parser = jwt.NewParser(opts...)
+	return a, nil
+}
+
+// Configured reports whether any key is set, without one every token is rejected
+func (a *Authenticator) Configured() bool {
+	return a.secret != nil || len(a.rsaKeys) > 0
+}
+
+// Authenticate verifies the signature and the claims of token and returns the caller identity.
+// Every failure wraps ErrInvalidToken.
+func (a *Authenticator) Authenticate(token string) (Identity, error) {
+	var claims Claims
+	if _, err := a.parser.ParseWithClaims(token, &claims, a.key); err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.ExpiresAt == nil {
+		return Identity{}, fmt.Errorf("%w: exp claim is required", ErrInvalidToken)
+	}
+	if claims.Subject == "" {
+		return Identity{}, fmt.Errorf("%w: sub claim is required", ErrInvalidToken)
+	}
+	return Identity{Subject: claims.Subject, Roles: claims.Roles}, nil
+}
+
+func (a *Authenticator) key(t *jwt.Token) (interface{}, error) {
+	switch t.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if a.secret == nil {
+			return nil, errors.New("HS256 tokens are not accepted")
+		}
+		return a.secret, nil
+	case *jwt.SigningMethodRSA:
+		kid, _ := t.Header["kid"].(string)
+		if key, ok := a.rsaKeys[kid]; ok {
+			return key, nil
+		}
+		// a token without kid is accepted when the JWKS holds a single key
+		if kid == "" && len(a.rsaKeys) == 1 {
+			for _, key := range a.rsaKeys {
+				return key, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+}
@@ -0,0 +1,142 @@
+package auth_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/plar/rentals-api/auth"
+	"github.com/plar/rentals-api/config"
+)
+
+const secret = "test-secret"
+
+func claims(sub string, roles ...string) auth.Claims {
+	return auth.Claims{
+		Roles: roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   sub,
+			Issuer:    "rentals-test",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, c jwt.Claims) string {
+	token := jwt.NewWithClaims(method, c)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	require.NoError(t, err)
+	return s
+}
+
+func writeJWKS(t *testing.T, keys map[string]*rsa.PublicKey) string {
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	for kid, key := range keys {
+		set.Keys = append(set.Keys, map[string]string{
+			"kty": "RSA", "kid": kid, "use": "sig", "alg": "RS256",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	data, err := json.Marshal(set)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func TestAuthenticate(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	authn, err := auth.NewAuthenticator(config.AuthConfig{
+		JWTSecret: secret,
+		JWKSFile:  writeJWKS(t, map[string]*rsa.PublicKey{"key-1": &rsaKey.PublicKey}),
+		Issuer:    "rentals-test",
+	})
+	require.NoError(t, err)
+	assert.True(t, authn.Configured())
+
+	expired := claims("user-1")
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+	noExp := claims("user-1")
+	noExp.ExpiresAt = nil
+	otherIssuer := claims("user-1")
+	otherIssuer.Issuer = "someone-else"
+
+	tests := []struct {
+		name  string
+		token string
+		id    auth.Identity
+		err   string
+	}{
+		{name: "HS256", token: sign(t, jwt.SigningMethodHS256, []byte(secret), "", claims("user-1", "admin")),
+			id: auth.Identity{Subject: "user-1", Roles: []string{"admin"}}},
+		{name: "RS256", token: sign(t, jwt.SigningMethodRS256, rsaKey, "key-1", claims("user-2")),
+			id: auth.Identity{Subject: "user-2"}},
+		{name: "RS256 without kid, single key", token: sign(t, jwt.SigningMethodRS256, rsaKey, "", claims("user-2")),
+			id: auth.Identity{Subject: "user-2"}},
+		{name: "wrong secret", token: sign(t, jwt.SigningMethodHS256, []byte("other"), "", claims("user-1")), err: "signature is invalid"},
+		{name: "unknown kid", token: sign(t, jwt.SigningMethodRS256, rsaKey, "key-2", claims("user-2")), err: `unknown key ID "key-2"`},
+		{name: "wrong RSA key", token: sign(t, jwt.SigningMethodRS256, otherKey, "key-1", claims("user-2")), err: "verification error"},
+		{name: "HS512 is not accepted", token: sign(t, jwt.SigningMethodHS512, []byte(secret), "", claims("user-1")), err: "signing method HS512 is invalid"},
+		{name: "none is not accepted", token: sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", claims("user-1")), err: "signing method none is invalid"},
+		{name: "expired", token: sign(t, jwt.SigningMethodHS256, []byte(secret), "", expired), err: "token is expired"},
+		{name: "exp is required", token: sign(t, jwt.SigningMethodHS256, []byte(secret), "", noExp), err: "exp claim is required"},
+		{name: "sub is required", token: sign(t, jwt.SigningMethodHS256, []byte(secret), "", claims("")), err: "sub claim is required"},
+		{name: "issuer", token: sign(t, jwt.SigningMethodHS256, []byte(secret), "", otherIssuer), err: "token has invalid issuer"},
+		{name: "garbage", token: "not.a.token", err: "token is malformed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := authn.Authenticate(tt.token)
+			if tt.err != "" {
+				assert.ErrorIs(t, err, auth.ErrInvalidToken)
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.id, id)
+		})
+	}
+}
+
+func TestAuthenticateWithoutKeys(t *testing.T) {
+	authn, err := auth.NewAuthenticator(config.AuthConfig{})
+	require.NoError(t, err)
+	assert.False(t, authn.Configured())
+
+	_, err = authn.Authenticate(sign(t, jwt.SigningMethodHS256, []byte(""), "", claims("user-1")))
+	assert.ErrorContains(t, err, "HS256 tokens are not accepted")
+}
+
+func TestLoadJWKS(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"keys":[{"kty":"EC","kid":"ec"}]}`), 0o600))
+	_, err := auth.LoadJWKS(path)
+	assert.ErrorContains(t, err, "has no RS256 signing key")
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"keys":[{"kty":"RSA","kid":"bad","n":"!!","e":"AQAB"}]}`), 0o600))
+	_, err = auth.LoadJWKS(path)
+	assert.ErrorContains(t, err, `invalid JWKS key #0 (kid "bad")`)
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+type Role string
+
+const (
+	// RoleGuest is the role of anonymous callers and of tokens without roles
+	RoleGuest   Role = "guest"
+	RoleOwner   Role = "owner"
+	RolePartner Role = "partner"
+	RoleAdmin   Role = "admin"
+)
+
+type Action string
+
+const (
+	ActionRead   Action = "rentals:read"
+	ActionExport Action = "rentals:export"
+	ActionImport Action = "rentals:import"
+	ActionWrite  Action = "rentals:write"
+	// ActionHistory reads the revisions of a rental and its past states
+	ActionHistory Action = "rentals:history"
+	// ActionAdmin covers the maintenance of the catalog, e.g. the restore and purge of deleted rentals
+	ActionAdmin Action = "rentals:admin"
+)
+
+// Actions are the known actions, the scopes of the API keys are among them
+var Actions = []Action{ActionRead, ActionExport, ActionImport, ActionWrite, ActionHistory, ActionAdmin}
+
+// ParseAction returns the known action named s
+func ParseAction(s string) (Action, error) {
+	for _, action := range Actions {
+		if string(action) == s {
+			return action, nil
+		}
+	}
+	return "", fmt.Errorf("unknown action %q", s)
+}
+
+// Grant is what a role may do with an action
+type Grant int
+
+const (
+	Deny Grant = iota
+	// AllowOwn allows the action on the rentals the caller owns only
+	AllowOwn
+	Allow
+)
+
+// Policy is the table of the grants per action and role, a missing entry denies
+type Policy map[Action]map[Role]Grant
+
+// DefaultPolicy lets everybody read, partners export the catalog, owners import, modify and see the
+// history of their own rentals and admins do anything
+var DefaultPolicy = Policy{
+	ActionRead:    {RoleGuest: Allow, RoleOwner: Allow, RolePartner: Allow, RoleAdmin: Allow},
+	ActionExport:  {RolePartner: Allow, RoleAdmin: Allow},
+	ActionImport:  {RoleOwner: AllowOwn, RoleAdmin: Allow},
+	ActionWrite:   {RoleOwner: AllowOwn, RoleAdmin: Allow},
+	ActionHistory: {RoleOwner: AllowOwn, RoleAdmin: Allow},
+	ActionAdmin:   {RoleAdmin: Allow},
+}
+
+// ErrForbidden is matched by every ForbiddenError with errors.Is
+var ErrForbidden = errors.New("forbidden")
+
+// ForbiddenError is returned when the policy denies an action to the caller
+type ForbiddenError struct {
+	Subject string
+	Action  Action
+	Reason  string
+}
+
+func (e *ForbiddenError) Error() string {
+	return fmt.Sprintf("%s is not allowed: %s", e.Action, e.Reason)
+}
+
+func (e *ForbiddenError) Is(target error) bool {
+	return target == ErrForbidden
+}
+
+// roles returns the roles of the identity, guest when it has none
+func (i Identity) roles() []Role {
+	if len(i.Roles) == 0 {
+		return []Role{RoleGuest}
+	}
+	roles := make([]Role, len(i.Roles))
+	for n, r := range i.Roles {
+		roles[n] = Role(r)
+	}
+	return roles
+}
+
+func (i Identity) hasScope(action Action) bool {
+	for _, s := range i.Scopes {
+		if s == string(action) {
+			return true
+		}
+	}
+	return false
+}
+
+// UserID is the numeric subject, owners are matched against the user_id of the rentals with it
+func (i Identity) UserID() (uint, bool) {
+	id, err := strconv.ParseUint(i.Subject, 10, 0)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// Grant returns the broadest grant of the identity roles for action
+func (p Policy) Grant(id Identity, action Action) Grant {
+	grant := Deny
+	for _, role := range id.roles() {
+		if g := p[action][role]; g > grant {
+			grant = g
+		}
+	}
+	return grant
+}
+
+// Authorize checks that id may perform action on the rentals owned by ownerIDs, use no owners for
+// actions which do not touch specific rentals. The denial is a *ForbiddenError.
+func (p Policy) Authorize(id Identity, action Action, ownerIDs ...uint) error {
+	if id.Scopes != nil && !id.hasScope(action) {
+		return &ForbiddenError{Subject: id.Subject, Action: action, Reason: "scope not granted to the API key"}
+	}
+
+	switch p.Grant(id, action) {
+	case Allow:
+		return nil
+	case AllowOwn:
+		userID, ok := id.UserID()
+		if !ok {
+			return &ForbiddenError{Subject: id.Subject, Action: action, Reason: "subject is not a user ID"}
+		}
+		for _, owner := range ownerIDs {
+			if owner != userID {
+				return &ForbiddenError{Subject: id.Subject, Action: action, Reason: fmt.Sprintf("rental owned by user %d", owner)}
+			}
+		}
+		return nil
+	}
+	return &ForbiddenError{Subject: id.Subject, Action: action, Reason: "not granted to the caller roles"}
+}
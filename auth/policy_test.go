@@ -0,0 +1,83 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/plar/rentals-api/auth"
+)
+
+func TestDefaultPolicy(t *testing.T) {
+	var (
+		anonymous = auth.Identity{}
+		guest     = auth.Identity{Subject: "5"}
+		owner     = auth.Identity{Subject: "7", Roles: []string{"owner"}}
+		partner   = auth.Identity{Subject: "partner-1", Roles: []string{"partner"}}
+		admin     = auth.Identity{Subject: "admin-1", Roles: []string{"admin"}}
+		// the broadest grant of the roles wins
+		ownerAdmin = auth.Identity{Subject: "7", Roles: []string{"owner", "admin"}}
+		// owners need a numeric subject to be matched with user_id
+		ownerByName = auth.Identity{Subject: "alice", Roles: []string{"owner"}}
+		unknownRole = auth.Identity{Subject: "7", Roles: []string{"superuser"}}
+	)
+
+	tests := []struct {
+		name    string
+		id      auth.Identity
+		action  auth.Action
+		owners  []uint
+		allowed bool
+	}{
+		{"anonymous reads", anonymous, auth.ActionRead, nil, true},
+		{"guest reads", guest, auth.ActionRead, nil, true},
+		{"guest cannot export", guest, auth.ActionExport, nil, false},
+		{"guest cannot import", guest, auth.ActionImport, []uint{5}, false},
+		{"guest cannot write", guest, auth.ActionWrite, []uint{5}, false},
+		{"owner reads", owner, auth.ActionRead, nil, true},
+		{"owner cannot export", owner, auth.ActionExport, nil, false},
+		{"owner imports own rentals", owner, auth.ActionImport, []uint{7, 7}, true},
+		{"owner cannot import others rentals", owner, auth.ActionImport, []uint{7, 8}, false},
+		{"owner writes own rental", owner, auth.ActionWrite, []uint{7}, true},
+		{"owner cannot write others rental", owner, auth.ActionWrite, []uint{8}, false},
+		{"owner without user ID", ownerByName, auth.ActionWrite, []uint{7}, false},
+		{"partner exports", partner, auth.ActionExport, nil, true},
+		{"partner cannot import", partner, auth.ActionImport, nil, false},
+		{"partner cannot write", partner, auth.ActionWrite, []uint{1}, false},
+		{"admin exports", admin, auth.ActionExport, nil, true},
+		{"admin imports anything", admin, auth.ActionImport, []uint{1, 2, 3}, true},
+		{"admin writes anything", admin, auth.ActionWrite, []uint{8}, true},
+		{"owner sees the history of own rental", owner, auth.ActionHistory, []uint{7}, true},
+		{"owner cannot see the history of others rental", owner, auth.ActionHistory, []uint{8}, false},
+		{"partner cannot see the history", partner, auth.ActionHistory, []uint{1}, false},
+		{"admin maintains the catalog", admin, auth.ActionAdmin, nil, true},
+		{"owner cannot maintain the catalog", owner, auth.ActionAdmin, nil, false},
+		{"owner and admin", ownerAdmin, auth.ActionWrite, []uint{8}, true},
+		{"unknown role is denied", unknownRole, auth.ActionRead, nil, false},
+		{"unknown action is denied", admin, auth.Action("rentals:delete"), nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := auth.DefaultPolicy.Authorize(tt.id, tt.action, tt.owners...)
+			if tt.allowed {
+				assert.NoError(t, err)
+				return
+			}
+			var forbidden *auth.ForbiddenError
+			assert.ErrorAs(t, err, &forbidden)
+			assert.ErrorIs(t, err, auth.ErrForbidden)
+			assert.Equal(t, tt.action, forbidden.Action)
+		})
+	}
+}
+
+func TestParseAction(t *testing.T) {
+	for _, action := range auth.Actions {
+		parsed, err := auth.ParseAction(string(action))
+		assert.NoError(t, err)
+		assert.Equal(t, action, parsed)
+	}
+	_, err := auth.ParseAction("rentals:raed")
+	assert.EqualError(t, err, `unknown action "rentals:raed"`)
+}
@@ -0,0 +1,19 @@
+// Package cache holds the backends of the repository cache, values are opaque bytes so a backend may
+// keep them outside of the process.
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+type Cache interface {
+	// Get returns the value of key, ok is false when it is missing or expired
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	// Set stores value under key for ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes keys, missing keys are ignored
+	Delete(ctx context.Context, keys ...string) error
+	// DeletePrefix removes every key starting with prefix
+	DeletePrefix(ctx context.Context, prefix string) error
+}
@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// Memory is a cache in the process memory which evicts the least recently used entry once it holds
+// maxEntries entries
+type Memory struct {
+	mu         sync.Mutex
+	maxEntries int
+	// lru holds *entry, the most recently used at the front
+	lru     *list.List
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+var _ Cache = (*Memory)(nil)
+
+// NewMemory returns an in-memory cache of maxEntries entries, now is the clock (time.Now when nil)
+func NewMemory(maxEntries int, now func() time.Time) *Memory {
+	if now == nil {
+		now = time.Now
+	}
+	return &Memory{
+		maxEntries: maxEntries,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+		now:        now,
+	}
+}
+
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	e := el.Value.(*entry)
+	if !m.now().Before(e.expires) {
+		m.remove(el)
+		return nil, false, nil
+	}
+	m.lru.MoveToFront(el)
+	return e.value, true, nil
+}
+
+func (m *Memory) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expires := m.now().Add(ttl)
+	if el, ok := m.entries[key]; ok {
+		e := el.Value.(*entry)
+		e.value, e.expires = value, expires
+		m.lru.MoveToFront(el)
+		return nil
+	}
+
+	m.entries[key] = m.lru.PushFront(&entry{key: key, value: value, expires: expires})
+	for m.lru.Len() > m.maxEntries {
+		m.remove(m.lru.Back())
+	}
+	return nil
+}
+
+func (m *Memory) Delete(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range keys {
+		if el, ok := m.entries[key]; ok {
+			m.remove(el)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) DeletePrefix(ctx context.Context, prefix string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, el := range m.entries {
+		if strings.HasPrefix(key, prefix) {
+			m.remove(el)
+		}
+	}
+	return nil
+}
+
+// Len is the number of entries, the expired ones included until they are evicted or read
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lru.Len()
+}
+
+func (m *Memory) remove(el *list.Element) {
+	m.lru.Remove(el)
+	delete(m.entries, el.Value.(*entry).key)
+}
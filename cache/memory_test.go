@@ -0,0 +1,75 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/plar/rentals-api/cache"
+)
+
+func get(t *testing.T, c cache.Cache, key string) string {
+	t.Helper()
+	value, ok, err := c.Get(context.Background(), key)
+	assert.NoError(t, err)
+	if !ok {
+		return "<missing>"
+	}
+	return string(value)
+}
+
+func TestMemoryTTL(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	c := cache.NewMemory(10, func() time.Time { return now })
+
+	assert.NoError(t, c.Set(ctx, "rental:1", []byte("Maupin"), time.Minute))
+	assert.Equal(t, "Maupin", get(t, c, "rental:1"))
+
+	now = now.Add(59 * time.Second)
+	assert.Equal(t, "Maupin", get(t, c, "rental:1"))
+
+	now = now.Add(time.Second)
+	assert.Equal(t, "<missing>", get(t, c, "rental:1"))
+	assert.Zero(t, c.Len(), "expired entries are dropped when read")
+}
+
+func TestMemoryLRU(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewMemory(2, nil)
+
+	assert.NoError(t, c.Set(ctx, "a", []byte("1"), time.Minute))
+	assert.NoError(t, c.Set(ctx, "b", []byte("2"), time.Minute))
+	// a is used, b becomes the least recently used
+	assert.Equal(t, "1", get(t, c, "a"))
+	assert.NoError(t, c.Set(ctx, "c", []byte("3"), time.Minute))
+
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, "1", get(t, c, "a"))
+	assert.Equal(t, "<missing>", get(t, c, "b"))
+	assert.Equal(t, "3", get(t, c, "c"))
+
+	// overwriting keeps the size
+	assert.NoError(t, c.Set(ctx, "c", []byte("4"), time.Minute))
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, "4", get(t, c, "c"))
+}
+
+func TestMemoryDelete(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewMemory(10, nil)
+	for _, key := range []string{"rental:1", "rental:2", "rentals:filter:a", "rentals:filter:b"} {
+		assert.NoError(t, c.Set(ctx, key, []byte(key), time.Minute))
+	}
+
+	assert.NoError(t, c.Delete(ctx, "rental:1", "rental:404"))
+	assert.Equal(t, "<missing>", get(t, c, "rental:1"))
+	assert.Equal(t, "rental:2", get(t, c, "rental:2"))
+
+	assert.NoError(t, c.DeletePrefix(ctx, "rentals:filter:"))
+	assert.Equal(t, "<missing>", get(t, c, "rentals:filter:a"))
+	assert.Equal(t, "<missing>", get(t, c, "rentals:filter:b"))
+	assert.Equal(t, 1, c.Len())
+}
@@ -0,0 +1,182 @@
+// Package certs serves the TLS certificate of the server and reloads it when its files change, new
+// connections get the new certificate while the open ones keep theirs.
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/plar/rentals-api/config"
+)
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	// the chain is verified by verifyClient against the current CA bundle rather than by crypto/tls,
+	// so the bundle reloads together with the certificate
+	"none":     tls.NoClientCert,
+	"optional": tls.RequestClientCert,
+	"require":  tls.RequireAnyClientCert,
+}
+
+// loaded is the certificate and the client CA bundle of one reload
+type loaded struct {
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	// stamp is the size and modification time of the files, Watch reloads when it changes
+	stamp string
+}
+
+type Reloader struct {
+	cfg config.TLSConfig
+	log *zap.Logger
+
+	mu      sync.RWMutex
+	current loaded
+}
+
+// NewReloader loads the certificate, key and client CA bundle of cfg, it fails when they cannot be loaded
+func NewReloader(cfg config.TLSConfig, log *zap.Logger) (*Reloader, error) {
+	if _, ok := clientAuthTypes[cfg.ClientAuth]; !ok && cfg.ClientAuth != "" {
+		return nil, fmt.Errorf("unsupported client auth %q", cfg.ClientAuth)
+	}
+	r := &Reloader{cfg: cfg, log: log}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// TLSConfig returns the server TLS configuration, pass it as http.Server.TLSConfig and start the server
+// with ListenAndServeTLS("", "")
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		GetCertificate:   r.GetCertificate,
+		ClientAuth:       clientAuthTypes[r.cfg.ClientAuth],
+		VerifyConnection: r.verifyClient,
+	}
+}
+
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current.cert, nil
+}
+
+// verifyClient verifies the client certificate chain, a missing certificate is rejected by crypto/tls
+// when it is required
+func (r *Reloader) verifyClient(cs tls.ConnectionState) error {
+	if r.cfg.ClientAuth == "" || r.cfg.ClientAuth == "none" || len(cs.PeerCertificates) == 0 {
+		return nil
+	}
+
+	r.mu.RLock()
+	roots := r.current.clientCAs
+	r.mu.RUnlock()
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return fmt.Errorf("invalid client certificate: %w", err)
+	}
+	return nil
+}
+
+// Reload loads the files again, the current certificate is kept when they are invalid
+func (r *Reloader) Reload() error {
+	stamp, err := r.stamp()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("cannot load certificate: %w", err)
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return fmt.Errorf("cannot parse certificate: %w", err)
+		}
+	}
+
+	var clientCAs *x509.CertPool
+	if r.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("cannot read client CA bundle: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in client CA bundle %s", r.cfg.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.current = loaded{cert: &cert, clientCAs: clientCAs, stamp: stamp}
+	r.mu.Unlock()
+
+	r.log.Info("TLS certificate loaded",
+		zap.String("subject", cert.Leaf.Subject.String()),
+		zap.Strings("dns_names", cert.Leaf.DNSNames),
+		zap.Time("not_after", cert.Leaf.NotAfter))
+	return nil
+}
+
+// stamp identifies the content of the files by their size and modification time
+func (r *Reloader) stamp() (string, error) {
+	var stamp string
+	for _, path := range []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.ClientCAFile} {
+		if path == "" {
+			continue
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		stamp += fmt.Sprintf("%s:%d:%d;", path, fi.Size(), fi.ModTime().UnixNano())
+	}
+	return stamp, nil
+}
+
+// Watch reloads the files every interval when they changed, until ctx is done. Errors are logged
+// and the current certificate is kept, a half written file is picked up on the next check.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stamp, err := r.stamp()
+		if err != nil {
+			r.log.Error("Cannot check TLS certificate files", zap.Error(err))
+			continue
+		}
+		r.mu.RLock()
+		changed := stamp != r.current.stamp
+		r.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		if err = r.Reload(); err != nil {
+			r.log.Error("Cannot reload TLS certificate", zap.Error(err))
+		}
+	}
+}
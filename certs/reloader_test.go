@@ -0,0 +1,238 @@
+package certs_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/plar/rentals-api/certs"
+	"github.com/plar/rentals-api/config"
+)
+
+// issue returns a certificate signed by parent, a self-signed CA when parent is nil
+func issue(t *testing.T, name string, parent *tls.Certificate, usage x509.ExtKeyUsage) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	signer, signerKey := tmpl, any(key)
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+		tmpl.ExtKeyUsage = nil
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// write stores cert and its key as PEM files, the modification time moves forward so every write is seen
+func write(t *testing.T, cert tls.Certificate, certFile, keyFile string) {
+	t.Helper()
+	key, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}), 0o600))
+
+	mtime := time.Now().Add(time.Duration(len(cert.Leaf.Subject.CommonName)) * time.Second)
+	require.NoError(t, os.Chtimes(certFile, mtime, mtime))
+	require.NoError(t, os.Chtimes(keyFile, mtime, mtime))
+}
+
+// serve starts an HTTPS server with the TLS configuration of r and returns its address
+func serve(t *testing.T, r *certs.Reloader) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if len(req.TLS.PeerCertificates) > 0 {
+				io.WriteString(w, req.TLS.PeerCertificates[0].Subject.CommonName)
+			}
+		}),
+		TLSConfig: r.TLSConfig(),
+	}
+	go srv.ServeTLS(ln, "", "")
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String()
+}
+
+func client(ca tls.Certificate, certs ...tls.Certificate) *http.Client {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs},
+	}}
+}
+
+// get returns the common name of the server certificate and the response body
+func get(c *http.Client, addr string) (string, string, error) {
+	resp, err := c.Get("https://" + addr)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return resp.TLS.PeerCertificates[0].Subject.CommonName, string(body), err
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.TLSConfig{
+		CertFile:   filepath.Join(dir, "server.crt"),
+		KeyFile:    filepath.Join(dir, "server.key"),
+		ClientAuth: "none",
+	}
+	ca := issue(t, "ca", nil, 0)
+	write(t, issue(t, "a", &ca, x509.ExtKeyUsageServerAuth), cfg.CertFile, cfg.KeyFile)
+
+	r, err := certs.NewReloader(cfg, zap.NewNop())
+	require.NoError(t, err)
+	addr := serve(t, r)
+
+	kept := client(ca)
+	name, _, err := get(kept, addr)
+	require.NoError(t, err)
+	assert.Equal(t, "a", name)
+
+	t.Run("reload", func(t *testing.T) {
+		write(t, issue(t, "bb", &ca, x509.ExtKeyUsageServerAuth), cfg.CertFile, cfg.KeyFile)
+		require.NoError(t, r.Reload())
+
+		name, _, err := get(client(ca), addr)
+		require.NoError(t, err)
+		assert.Equal(t, "bb", name)
+
+		// the open connection is reused with the certificate of its handshake
+		name, _, err = get(kept, addr)
+		require.NoError(t, err)
+		assert.Equal(t, "a", name)
+	})
+
+	t.Run("invalid files keep the certificate", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(cfg.KeyFile, []byte("not a key"), 0o600))
+		assert.ErrorContains(t, r.Reload(), "cannot load certificate")
+
+		name, _, err := get(client(ca), addr)
+		require.NoError(t, err)
+		assert.Equal(t, "bb", name)
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go r.Watch(ctx, 10*time.Millisecond)
+
+		write(t, issue(t, "ccc", &ca, x509.ExtKeyUsageServerAuth), cfg.CertFile, cfg.KeyFile)
+		assert.Eventually(t, func() bool {
+			name, _, err := get(client(ca), addr)
+			return err == nil && name == "ccc"
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestReloaderErrors(t *testing.T) {
+	dir := t.TempDir()
+	_, err := certs.NewReloader(config.TLSConfig{
+		CertFile: filepath.Join(dir, "missing.crt"),
+		KeyFile:  filepath.Join(dir, "missing.key"),
+	}, zap.NewNop())
+	assert.Error(t, err)
+
+	ca := issue(t, "ca", nil, 0)
+	cfg := config.TLSConfig{
+		CertFile:     filepath.Join(dir, "server.crt"),
+		KeyFile:      filepath.Join(dir, "server.key"),
+		ClientCAFile: filepath.Join(dir, "clients.pem"),
+		ClientAuth:   "require",
+	}
+	write(t, issue(t, "server", &ca, x509.ExtKeyUsageServerAuth), cfg.CertFile, cfg.KeyFile)
+	require.NoError(t, os.WriteFile(cfg.ClientCAFile, []byte("no certificates"), 0o600))
+	_, err = certs.NewReloader(cfg, zap.NewNop())
+	assert.ErrorContains(t, err, "no certificate found in client CA bundle")
+}
+
+func TestReloaderClientAuth(t *testing.T) {
+	dir := t.TempDir()
+	serverCA := issue(t, "server ca", nil, 0)
+	clientCA := issue(t, "client ca", nil, 0)
+	otherCA := issue(t, "other ca", nil, 0)
+
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	write(t, issue(t, "server", &serverCA, x509.ExtKeyUsageServerAuth), certFile, keyFile)
+	caFile := filepath.Join(dir, "clients.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: clientCA.Certificate[0]}), 0o600))
+
+	internal := issue(t, "billing", &clientCA, x509.ExtKeyUsageClientAuth)
+	stranger := issue(t, "stranger", &otherCA, x509.ExtKeyUsageClientAuth)
+	serverUsage := issue(t, "server usage", &clientCA, x509.ExtKeyUsageServerAuth)
+
+	tests := []struct {
+		clientAuth string
+		certs      []tls.Certificate
+		body       string
+		ok         bool
+	}{
+		{clientAuth: "require", certs: []tls.Certificate{internal}, body: "billing", ok: true},
+		{clientAuth: "require", ok: false},
+		{clientAuth: "require", certs: []tls.Certificate{stranger}, ok: false},
+		{clientAuth: "require", certs: []tls.Certificate{serverUsage}, ok: false},
+		{clientAuth: "optional", certs: []tls.Certificate{internal}, body: "billing", ok: true},
+		{clientAuth: "optional", body: "", ok: true},
+		{clientAuth: "optional", certs: []tls.Certificate{stranger}, ok: false},
+		{clientAuth: "none", certs: []tls.Certificate{stranger}, body: "", ok: true},
+	}
+
+	for _, tt := range tests {
+		r, err := certs.NewReloader(config.TLSConfig{
+			CertFile:     certFile,
+			KeyFile:      keyFile,
+			ClientCAFile: caFile,
+			ClientAuth:   tt.clientAuth,
+		}, zap.NewNop())
+		require.NoError(t, err)
+		addr := serve(t, r)
+
+		_, body, err := get(client(serverCA, tt.certs...), addr)
+		if tt.ok {
+			assert.NoError(t, err, tt.clientAuth)
+			assert.Equal(t, tt.body, body, tt.clientAuth)
+		} else {
+			assert.Error(t, err, tt.clientAuth)
+		}
+	}
+}
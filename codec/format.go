@@ -0,0 +1,89 @@
+package codec
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/plar/rentals-api/domain"
+)
+
+type Format string
+
+const (
+	FormatJSON    Format = "json"
+	FormatCSV     Format = "csv"
+	FormatNDJSON  Format = "ndjson"
+	FormatGeoJSON Format = "geojson"
+)
+
+const (
+	MIMEJSON    = "application/json"
+	MIMECSV     = "text/csv"
+	MIMENDJSON  = "application/x-ndjson"
+	MIMEGeoJSON = "application/geo+json"
+)
+
+var formatMIMEs = map[Format]string{
+	FormatJSON:    MIMEJSON,
+	FormatCSV:     MIMECSV,
+	FormatNDJSON:  MIMENDJSON,
+	FormatGeoJSON: MIMEGeoJSON,
+}
+
+// MIMEs returns the supported media types, JSON first, in the order they should be offered
+// during content negotiation.
+func MIMEs() []string {
+	return []string{MIMEJSON, MIMEGeoJSON, MIMECSV, MIMENDJSON}
+}
+
+func ParseFormat(s string) (Format, error) {
+	f := Format(s)
+	if _, ok := formatMIMEs[f]; !ok {
+		return "", fmt.Errorf("unsupported format %q", s)
+	}
+	return f, nil
+}
+
+func FormatFromMIME(mime string) (Format, bool) {
+	for f, m := range formatMIMEs {
+		if m == mime {
+			return f, true
+		}
+	}
+	return "", false
+}
+
+func (f Format) ContentType() string {
+	return formatMIMEs[f]
+}
+
+// RentalEncoder writes rentals one by one, so callers can stream large result sets.
+// Close must be called to write any trailing data (CSV header for an empty set, GeoJSON footer).
+type RentalEncoder interface {
+	Encode(rental domain.Rental) error
+	Close() error
+}
+
+func NewRentalEncoder(f Format, w io.Writer) (RentalEncoder, error) {
+	switch f {
+	case FormatCSV:
+		return newRentalCSVEncoder(w), nil
+	case FormatNDJSON:
+		return newRentalNDJSONEncoder(w), nil
+	case FormatGeoJSON:
+		return newRentalGeoJSONEncoder(w), nil
+	}
+	return nil, fmt.Errorf("format %q does not support streaming", f)
+}
+
+// DecodeRentals reads every row of a CSV or NDJSON document. A row which cannot be parsed
+// is returned with ImportRow.Err set, the error is only returned when the document itself is unreadable.
+func DecodeRentals(f Format, r io.Reader) ([]domain.ImportRow, error) {
+	switch f {
+	case FormatCSV:
+		return decodeRentalsCSV(r)
+	case FormatNDJSON:
+		return decodeRentalsNDJSON(r)
+	}
+	return nil, fmt.Errorf("format %q does not support decoding", f)
+}
@@ -0,0 +1,194 @@
+package codec_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/plar/rentals-api/codec"
+	"github.com/plar/rentals-api/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRentals = []domain.Rental{
+	{
+		ID:       1,
+		Name:     "'Abaco' VW Bay Window: Westfalia Pop-top",
+		Type:     "camper-van",
+		Year:     1978,
+		Length:   15.5,
+		Price:    domain.Price{Day: 16900},
+		Location: domain.Location{City: "Costa Mesa", State: "CA", Lat: 33.64, Lng: -117.93},
+		User:     domain.User{ID: 1, FirstName: "John", LastName: "Smith"},
+	},
+	{
+		ID:       2,
+		Name:     "Maupin: Vanagon, \"Camper\"",
+		Type:     "camper-van",
+		Price:    domain.Price{Day: 15000},
+		Location: domain.Location{City: "Portland", State: "OR", Lat: 45.51, Lng: -122.68},
+		User:     domain.User{ID: 2, FirstName: "Jane", LastName: "Doe"},
+	},
+}
+
+func encodeAll(t *testing.T, format codec.Format, rentals []domain.Rental) string {
+	var buf bytes.Buffer
+	enc, err := codec.NewRentalEncoder(format, &buf)
+	require.NoError(t, err)
+	for _, r := range rentals {
+		require.NoError(t, enc.Encode(r))
+	}
+	require.NoError(t, enc.Close())
+	return buf.String()
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, s := range []string{"json", "csv", "ndjson", "geojson"} {
+		f, err := codec.ParseFormat(s)
+		assert.NoError(t, err)
+		assert.Equal(t, codec.Format(s), f)
+	}
+
+	_, err := codec.ParseFormat("xml")
+	assert.Error(t, err)
+
+	f, ok := codec.FormatFromMIME(codec.MIMEGeoJSON)
+	assert.True(t, ok)
+	assert.Equal(t, codec.FormatGeoJSON, f)
+}
+
+func TestRentalCSVEncoder(t *testing.T) {
+	out := encodeAll(t, codec.FormatCSV, testRentals)
+
+	records, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, codec.RentalCSVColumns, records[0])
+
+	row := map[string]string{}
+	for i, col := range records[0] {
+		row[col] = records[1][i]
+	}
+	assert.Equal(t, "1", row["id"])
+	assert.Equal(t, "15.5", row["length"])
+	assert.Equal(t, "16900", row["price.day"])
+	assert.Equal(t, "Costa Mesa", row["location.city"])
+	assert.Equal(t, "33.64", row["location.lat"])
+	assert.Equal(t, "-117.93", row["location.lng"])
+	assert.Equal(t, "Smith", row["user.last_name"])
+	assert.Equal(t, testRentals[1].Name, records[2][1])
+}
+
+func TestRentalCSVEncoderEmpty(t *testing.T) {
+	out := encodeAll(t, codec.FormatCSV, nil)
+	assert.Equal(t, strings.Join(codec.RentalCSVColumns, ",")+"\n", out)
+}
+
+func TestRentalNDJSONEncoder(t *testing.T) {
+	out := encodeAll(t, codec.FormatNDJSON, testRentals)
+
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	require.Len(t, lines, 2)
+	for i, line := range lines {
+		var r domain.Rental
+		require.NoError(t, json.Unmarshal([]byte(line), &r))
+		assert.Equal(t, testRentals[i], r)
+	}
+}
+
+func TestRentalGeoJSONEncoder(t *testing.T) {
+	type feature struct {
+		Type     string `json:"type"`
+		ID       uint   `json:"id"`
+		Geometry struct {
+			Type        string     `json:"type"`
+			Coordinates [2]float64 `json:"coordinates"`
+		} `json:"geometry"`
+		Properties domain.Rental `json:"properties"`
+	}
+	var fc struct {
+		Type     string    `json:"type"`
+		Features []feature `json:"features"`
+	}
+
+	out := encodeAll(t, codec.FormatGeoJSON, testRentals)
+	require.NoError(t, json.Unmarshal([]byte(out), &fc))
+	assert.Equal(t, "FeatureCollection", fc.Type)
+	require.Len(t, fc.Features, 2)
+
+	f := fc.Features[0]
+	assert.Equal(t, "Feature", f.Type)
+	assert.Equal(t, uint(1), f.ID)
+	assert.Equal(t, "Point", f.Geometry.Type)
+	assert.Equal(t, [2]float64{-117.93, 33.64}, f.Geometry.Coordinates)
+	assert.Equal(t, testRentals[0], f.Properties)
+
+	out = encodeAll(t, codec.FormatGeoJSON, nil)
+	require.NoError(t, json.Unmarshal([]byte(out), &fc))
+	assert.Empty(t, fc.Features)
+}
+
+func TestRentalEncoderUnsupported(t *testing.T) {
+	_, err := codec.NewRentalEncoder(codec.FormatJSON, &bytes.Buffer{})
+	assert.Error(t, err)
+}
+
+func TestDecodeRentalsCSV(t *testing.T) {
+	// exported documents can be imported back
+	out := encodeAll(t, codec.FormatCSV, testRentals)
+	rows, err := codec.DecodeRentals(codec.FormatCSV, strings.NewReader(out))
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	for i, row := range rows {
+		assert.NoError(t, row.Err)
+		assert.Equal(t, i+2, row.Line)
+		assert.Equal(t, testRentals[i], row.Rental)
+	}
+
+	// columns in any order, subset of columns, bad values are reported per row
+	in := "name,price.day,user.id\n" +
+		"Van 1,100,1\n" +
+		"Van 2,abc,1\n" +
+		"\"Van 3,100,1\n"
+	rows, err = codec.DecodeRentals(codec.FormatCSV, strings.NewReader(in))
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.NoError(t, rows[0].Err)
+	assert.Equal(t, domain.Rental{Name: "Van 1", Price: domain.Price{Day: 100}, User: domain.User{ID: 1}}, rows[0].Rental)
+	assert.EqualError(t, rows[1].Err, `invalid price.day value "abc"`)
+	assert.Equal(t, 3, rows[1].Line)
+	assert.Error(t, rows[2].Err)
+	assert.Equal(t, 4, rows[2].Line)
+}
+
+func TestDecodeRentalsCSVHeader(t *testing.T) {
+	_, err := codec.DecodeRentals(codec.FormatCSV, strings.NewReader(""))
+	assert.EqualError(t, err, "missing CSV header")
+
+	_, err = codec.DecodeRentals(codec.FormatCSV, strings.NewReader("name,color\n"))
+	assert.EqualError(t, err, `unknown CSV column "color"`)
+}
+
+func TestDecodeRentalsNDJSON(t *testing.T) {
+	out := encodeAll(t, codec.FormatNDJSON, testRentals)
+	in := out + "\n" + `{"name":"Van","colour":"red"}` + "\n" + `{"name":` + "\n"
+
+	rows, err := codec.DecodeRentals(codec.FormatNDJSON, strings.NewReader(in))
+	require.NoError(t, err)
+	require.Len(t, rows, 4)
+	assert.NoError(t, rows[0].Err)
+	assert.Equal(t, testRentals[0], rows[0].Rental)
+	assert.NoError(t, rows[1].Err)
+	assert.Equal(t, 2, rows[1].Line)
+	assert.Error(t, rows[2].Err, "unknown fields are rejected")
+	assert.Equal(t, 4, rows[2].Line)
+	assert.Error(t, rows[3].Err)
+	assert.Equal(t, 5, rows[3].Line)
+
+	_, err = codec.DecodeRentals(codec.FormatGeoJSON, strings.NewReader(in))
+	assert.Error(t, err)
+}
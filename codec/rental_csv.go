@@ -0,0 +1,209 @@
+package codec
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/plar/rentals-api/domain"
+)
+
+// RentalCSVColumns are the flattened domain.Rental fields, nested structs use dotted names.
+var RentalCSVColumns = []string{
+	"id",
+	"name",
+	"description",
+	"type",
+	"make",
+	"model",
+	"year",
+	"length",
+	"sleeps",
+	"primary_image_url",
+	"price.day",
+	"location.city",
+	"location.state",
+	"location.zip",
+	"location.country",
+	"location.lat",
+	"location.lng",
+	"user.id",
+	"user.first_name",
+	"user.last_name",
+}
+
+type rentalCSVEncoder struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func newRentalCSVEncoder(w io.Writer) *rentalCSVEncoder {
+	return &rentalCSVEncoder{w: csv.NewWriter(w)}
+}
+
+func (e *rentalCSVEncoder) writeHeader() error {
+	if e.headerWritten {
+		return nil
+	}
+	e.headerWritten = true
+	return e.w.Write(RentalCSVColumns)
+}
+
+func (e *rentalCSVEncoder) Encode(r domain.Rental) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	return e.w.Write(toCSVRecord(r))
+}
+
+func (e *rentalCSVEncoder) Close() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func toCSVRecord(r domain.Rental) []string {
+	return []string{
+		strconv.FormatUint(uint64(r.ID), 10),
+		r.Name,
+		r.Description,
+		r.Type,
+		r.Make,
+		r.Model,
+		strconv.Itoa(r.Year),
+		formatFloat(r.Length),
+		strconv.Itoa(r.Sleeps),
+		r.PrimaryImageURL,
+		strconv.Itoa(r.Price.Day),
+		r.Location.City,
+		r.Location.State,
+		r.Location.Zip,
+		r.Location.Country,
+		formatFloat(r.Location.Lat),
+		formatFloat(r.Location.Lng),
+		strconv.Itoa(r.User.ID),
+		r.User.FirstName,
+		r.User.LastName,
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+type csvFieldSetter func(r *domain.Rental, v string) (err error)
+
+func setString(field func(r *domain.Rental) *string) csvFieldSetter {
+	return func(r *domain.Rental, v string) error {
+		*field(r) = v
+		return nil
+	}
+}
+
+func setInt(field func(r *domain.Rental) *int) csvFieldSetter {
+	return func(r *domain.Rental, v string) (err error) {
+		if v == "" {
+			return nil
+		}
+		*field(r), err = strconv.Atoi(v)
+		return err
+	}
+}
+
+func setFloat(field func(r *domain.Rental) *float64) csvFieldSetter {
+	return func(r *domain.Rental, v string) (err error) {
+		if v == "" {
+			return nil
+		}
+		*field(r), err = strconv.ParseFloat(v, 64)
+		return err
+	}
+}
+
+var rentalCSVSetters = map[string]csvFieldSetter{
+	"id": func(r *domain.Rental, v string) error {
+		if v == "" {
+			return nil
+		}
+		id, err := strconv.ParseUint(v, 10, 32)
+		r.ID = uint(id)
+		return err
+	},
+	"name":              setString(func(r *domain.Rental) *string { return &r.Name }),
+	"description":       setString(func(r *domain.Rental) *string { return &r.Description }),
+	"type":              setString(func(r *domain.Rental) *string { return &r.Type }),
+	"make":              setString(func(r *domain.Rental) *string { return &r.Make }),
+	"model":             setString(func(r *domain.Rental) *string { return &r.Model }),
+	"year":              setInt(func(r *domain.Rental) *int { return &r.Year }),
+	"length":            setFloat(func(r *domain.Rental) *float64 { return &r.Length }),
+	"sleeps":            setInt(func(r *domain.Rental) *int { return &r.Sleeps }),
+	"primary_image_url": setString(func(r *domain.Rental) *string { return &r.PrimaryImageURL }),
+	"price.day":         setInt(func(r *domain.Rental) *int { return &r.Price.Day }),
+	"location.city":     setString(func(r *domain.Rental) *string { return &r.Location.City }),
+	"location.state":    setString(func(r *domain.Rental) *string { return &r.Location.State }),
+	"location.zip":      setString(func(r *domain.Rental) *string { return &r.Location.Zip }),
+	"location.country":  setString(func(r *domain.Rental) *string { return &r.Location.Country }),
+	"location.lat":      setFloat(func(r *domain.Rental) *float64 { return &r.Location.Lat }),
+	"location.lng":      setFloat(func(r *domain.Rental) *float64 { return &r.Location.Lng }),
+	"user.id":           setInt(func(r *domain.Rental) *int { return &r.User.ID }),
+	// user names belong to the users table, they are accepted so exported files can be imported back
+	"user.first_name": setString(func(r *domain.Rental) *string { return &r.User.FirstName }),
+	"user.last_name":  setString(func(r *domain.Rental) *string { return &r.User.LastName }),
+}
+
+// decodeRentalsCSV reads a CSV document with a header row, columns are matched by RentalCSVColumns names
+// and may come in any order.
+func decodeRentalsCSV(r io.Reader) ([]domain.ImportRow, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("missing CSV header")
+	} else if err != nil {
+		return nil, fmt.Errorf("invalid CSV header: %w", err)
+	}
+
+	setters := make([]csvFieldSetter, len(header))
+	for i, col := range header {
+		col = strings.TrimSpace(col)
+		if setters[i] = rentalCSVSetters[col]; setters[i] == nil {
+			return nil, fmt.Errorf("unknown CSV column %q", col)
+		}
+		header[i] = col
+	}
+
+	var rows []domain.ImportRow
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+
+		row := domain.ImportRow{}
+		if err != nil {
+			// a malformed row is reported and skipped, any other error comes from the underlying reader
+			var perr *csv.ParseError
+			if !errors.As(err, &perr) {
+				return nil, err
+			}
+			row.Line = perr.StartLine
+			row.Err = err
+			rows = append(rows, row)
+			continue
+		}
+		row.Line, _ = cr.FieldPos(0)
+
+		for i, v := range record {
+			if err := setters[i](&row.Rental, strings.TrimSpace(v)); err != nil {
+				row.Err = fmt.Errorf("invalid %s value %q", header[i], v)
+				break
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
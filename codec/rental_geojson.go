@@ -0,0 +1,71 @@
+package codec
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/plar/rentals-api/domain"
+)
+
+type geoJSONPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+type geoJSONFeature struct {
+	Type       string        `json:"type"`
+	ID         uint          `json:"id"`
+	Geometry   geoJSONPoint  `json:"geometry"`
+	Properties domain.Rental `json:"properties"`
+}
+
+// rentalGeoJSONEncoder writes a FeatureCollection, every rental is a Feature with Point geometry.
+type rentalGeoJSONEncoder struct {
+	w        io.Writer
+	features int
+}
+
+func newRentalGeoJSONEncoder(w io.Writer) *rentalGeoJSONEncoder {
+	return &rentalGeoJSONEncoder{w: w}
+}
+
+func toGeoJSONFeature(r domain.Rental) geoJSONFeature {
+	return geoJSONFeature{
+		Type: "Feature",
+		ID:   r.ID,
+		Geometry: geoJSONPoint{
+			Type: "Point",
+			// GeoJSON positions are [longitude, latitude] (RFC 7946, section 3.1.1)
+			Coordinates: [2]float64{r.Location.Lng, r.Location.Lat},
+		},
+		Properties: r,
+	}
+}
+
+func (e *rentalGeoJSONEncoder) Encode(r domain.Rental) error {
+	prefix := ","
+	if e.features == 0 {
+		prefix = `{"type":"FeatureCollection","features":[`
+	}
+	data, err := json.Marshal(toGeoJSONFeature(r))
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(e.w, prefix); err != nil {
+		return err
+	}
+	if _, err = e.w.Write(data); err != nil {
+		return err
+	}
+	e.features++
+	return nil
+}
+
+func (e *rentalGeoJSONEncoder) Close() error {
+	suffix := "]}\n"
+	if e.features == 0 {
+		suffix = `{"type":"FeatureCollection","features":[]}` + "\n"
+	}
+	_, err := io.WriteString(e.w, suffix)
+	return err
+}
@@ -0,0 +1,51 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/plar/rentals-api/domain"
+)
+
+type rentalNDJSONEncoder struct {
+	enc *json.Encoder
+}
+
+func newRentalNDJSONEncoder(w io.Writer) *rentalNDJSONEncoder {
+	return &rentalNDJSONEncoder{enc: json.NewEncoder(w)}
+}
+
+// Encode writes the rental as a single line, json.Encoder terminates every value with '\n'
+func (e *rentalNDJSONEncoder) Encode(r domain.Rental) error {
+	return e.enc.Encode(r)
+}
+
+func (e *rentalNDJSONEncoder) Close() error {
+	return nil
+}
+
+// maxNDJSONLine is the longest accepted NDJSON line
+const maxNDJSONLine = 1 << 20
+
+// decodeRentalsNDJSON reads one rental per line, blank lines are skipped and unknown fields are rejected.
+func decodeRentalsNDJSON(r io.Reader) ([]domain.ImportRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxNDJSONLine)
+
+	var rows []domain.ImportRow
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		row := domain.ImportRow{Line: line}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		row.Err = dec.Decode(&row.Rental)
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
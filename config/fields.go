@@ -0,0 +1,118 @@
+package config
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// field is a leaf of the Config struct, path is the dotted YAML path (db.host)
+type field struct {
+	path   string
+	env    string
+	usage  string
+	secret bool
+	value  reflect.Value
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func configFields(cfg *Config) []field {
+	return collectFields("", reflect.ValueOf(cfg).Elem())
+}
+
+func collectFields(prefix string, v reflect.Value) (fields []field) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := strings.Split(sf.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct && fv.Type() != durationType {
+			fields = append(fields, collectFields(name, fv)...)
+			continue
+		}
+		fields = append(fields, field{
+			path:   name,
+			env:    sf.Tag.Get("env"),
+			usage:  sf.Tag.Get("usage"),
+			secret: sf.Tag.Get("secret") == "true",
+			value:  fv,
+		})
+	}
+	return fields
+}
+
+func fieldByFlag(fields []field, name string) field {
+	for _, f := range fields {
+		if f.flagName() == name {
+			return f
+		}
+	}
+	panic("unknown config flag " + name)
+}
+
+// envName is DB_HOST for db.host, unless the env tag overrides it
+func (f field) envName() string {
+	if f.env != "" {
+		return f.env
+	}
+	return strings.ToUpper(strings.NewReplacer(".", "_").Replace(f.path))
+}
+
+// flagName is db-host for db.host and server-shutdown-timeout for server.shutdown_timeout
+func (f field) flagName() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(f.path)
+}
+
+func (f field) set(s string) error {
+	if f.value.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		f.value.SetInt(int64(d))
+		return nil
+	}
+
+	switch f.value.Kind() {
+	case reflect.String:
+		f.value.SetString(s)
+	case reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		f.value.SetInt(int64(n))
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		f.value.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.value.SetBool(b)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		f.value.Set(reflect.ValueOf(items))
+	default:
+		panic("unsupported config field type " + f.value.Type().String())
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package domain
+
+import "time"
+
+// APIKey is a partner API key, only the SHA-256 hash of the key is stored. Prefix is the public
+// beginning of the key which identifies it in listings and logs.
+type APIKey struct {
+	ID        uint       `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Hash      string     `json:"-"`
+	Scopes    []string   `json:"scopes"`
+	Rate      float64    `json:"rate"`
+	Burst     int        `json:"burst"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
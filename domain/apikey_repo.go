@@ -0,0 +1,16 @@
+package domain
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+type APIKeyRepository interface {
+	// FindByHash returns the key with the hash, revoked keys included, or ErrAPIKeyNotFound
+	FindByHash(ctx context.Context, hash string) (APIKey, error)
+	Create(ctx context.Context, key APIKey) (APIKey, error)
+	List(ctx context.Context) ([]APIKey, error)
+	Revoke(ctx context.Context, prefix string) error
+}
@@ -0,0 +1,17 @@
+package domain
+
+import "context"
+
+type primaryReadsKey struct{}
+
+// WithPrimaryReads sends the repository reads of ctx to the primary database, use it for the reads
+// which decide a write and must not see a lagging replica
+func WithPrimaryReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryReadsKey{}, true)
+}
+
+// PrimaryReads reports whether the reads of ctx must go to the primary database
+func PrimaryReads(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryReadsKey{}).(bool)
+	return primary
+}
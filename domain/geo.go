@@ -0,0 +1,22 @@
+package domain
+
+import "math"
+
+const (
+	// EarthRadiusMeters is the radius of the earth sphere of the PostgreSQL earthdistance extension,
+	// the distances computed in Go match the ones of earth_distance with it
+	EarthRadiusMeters = 6378168
+	// MetersPerMile converts the near radius, which is configured in miles
+	MetersPerMile = 1609.34
+)
+
+// HaversineDistance returns the great-circle distance in meters between two points given by their
+// latitude and longitude in degrees
+func HaversineDistance(lat1, lng1, lat2, lng2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLng := toRad(lng2 - lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * EarthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(a)))
+}
@@ -0,0 +1,15 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHaversineDistance(t *testing.T) {
+	assert.Zero(t, HaversineDistance(33.64, -117.93, 33.64, -117.93))
+	// a degree of longitude at the equator of the earthdistance sphere
+	assert.InDelta(t, 111320, HaversineDistance(0, 0, 0, 1), 0.1)
+	// Costa Mesa to San Diego
+	assert.InDelta(t, 67, HaversineDistance(33.64, -117.93, 32.83, -117.28)/MetersPerMile, 1)
+}
@@ -0,0 +1,34 @@
+package domain
+
+// RentalImage is an uploaded picture of a rental, the images of a rental are shown in position order from 1
+// and the first one is its primary image
+type RentalImage struct {
+	ID       uint           `json:"id"`
+	RentalID uint           `json:"-"`
+	Position int            `json:"position"`
+	Width    int            `json:"width"`
+	Height   int            `json:"height"`
+	URL      string         `json:"url"`
+	Variants []ImageVariant `json:"variants"`
+	// Key names the uploaded file in the image storage, URL is derived from it
+	Key string `json:"-"`
+}
+
+// ImageVariant is the image scaled down to one of the thumbnail sizes in one of the formats
+type ImageVariant struct {
+	Size   string `json:"size"`
+	Format string `json:"format"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	URL    string `json:"url"`
+	Key    string `json:"-"`
+}
+
+// Keys returns the keys of the files of the image
+func (i RentalImage) Keys() []string {
+	keys := []string{i.Key}
+	for _, variant := range i.Variants {
+		keys = append(keys, variant.Key)
+	}
+	return keys
+}
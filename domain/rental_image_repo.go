@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrImageNotFound is returned for an image which does not exist or belongs to another rental
+var ErrImageNotFound = errors.New("image not found")
+
+// ErrInvalidImage is returned for an upload which is not an image in a supported format and size
+var ErrInvalidImage = errors.New("invalid image")
+
+// ErrImageOrder is returned by a reorder which does not list every image of the rental once
+var ErrImageOrder = errors.New("the order must list every image of the rental once")
+
+type RentalImageRepository interface {
+	// FindByRentalIDs returns the images of the rentals by rental ID, in position order
+	FindByRentalIDs(ctx context.Context, ids []uint) (map[uint][]RentalImage, error)
+	// Add puts the image after the other images of its rental and returns it with its ID and position
+	Add(ctx context.Context, image RentalImage) (RentalImage, error)
+	// Delete removes an image of a rental and moves the next ones up, ErrImageNotFound when the rental has no such image
+	Delete(ctx context.Context, rentalID, id uint) (RentalImage, error)
+	// Reorder moves the images of a rental to the positions of their IDs in ids, ErrImageOrder unless it lists
+	// every one of them once
+	Reorder(ctx context.Context, rentalID uint, ids []uint) ([]RentalImage, error)
+	// DeleteAll removes the images of a rental, e.g. when it is purged
+	DeleteAll(ctx context.Context, rentalID uint) error
+}
+
+// ImagePositions returns the position of every image in ids by image ID, ErrImageOrder unless ids lists
+// every image once
+func ImagePositions[T any](images []T, ids []uint, id func(T) uint) (map[uint]int, error) {
+	if len(ids) != len(images) {
+		return nil, ErrImageOrder
+	}
+	positions := make(map[uint]int, len(ids))
+	for i, imageID := range ids {
+		positions[imageID] = i + 1
+	}
+	// with as many IDs as images a repeated ID leaves an image out
+	for _, image := range images {
+		if _, ok := positions[id(image)]; !ok {
+			return nil, ErrImageOrder
+		}
+	}
+	return positions, nil
+}
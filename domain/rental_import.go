@@ -0,0 +1,26 @@
+package domain
+
+// ImportRow is a single decoded input row, Err is set when the row could not be parsed
+type ImportRow struct {
+	Line   int
+	Rental Rental
+	Err    error
+}
+
+type ImportRowError struct {
+	Line   int      `json:"line"`
+	ID     uint     `json:"id,omitempty"`
+	Errors []string `json:"errors"`
+}
+
+type ImportReport struct {
+	DryRun   bool             `json:"dry_run"`
+	Total    int              `json:"total"`
+	Valid    int              `json:"valid"`
+	Imported int              `json:"imported"`
+	Errors   []ImportRowError `json:"errors"`
+}
+
+func (r ImportReport) HasErrors() bool {
+	return len(r.Errors) > 0
+}
@@ -1,5 +1,7 @@
 package domain
 
+import "time"
+
 type Rental struct {
 	ID              uint     `json:"id"`
 	Name            string   `json:"name"`
@@ -14,6 +16,14 @@ type Rental struct {
 	Price           Price    `json:"price"`
 	Location        Location `json:"location"`
 	User            User     `json:"user"`
+	// Images are attached by the service when the rental has uploaded images, PrimaryImageURL is the URL
+	// of the first one then
+	Images []RentalImage `json:"images,omitempty"`
+	// Version is incremented by every write of the rental, updates must name the version they change.
+	// It is left out of the past states, which have no version of their own.
+	Version uint `json:"version,omitempty"`
+	// DeletedAt is set on the soft-deleted rentals only
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 type Price struct {
@@ -1,7 +1,64 @@
 package domain
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrRentalNotFound is returned by the calls which find, update, restore or purge a rental which does not exist
+var ErrRentalNotFound = errors.New("rental not found")
+
+// ErrConflict is matched by every ConflictError with errors.Is
+var ErrConflict = errors.New("version conflict")
+
+// ConflictError is returned by an update of a rental which changed since the version it was based on
+type ConflictError struct {
+	ID      uint
+	Version uint
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("rental %d is no longer at version %d", e.ID, e.Version)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
 type RentalRepository interface {
-	FindAll() ([]Rental, error)
-	FindByID(id uint) (Rental, error)
-	FindByFilter(filter RentalFindFilter) (Response[Rental], error)
+	FindAll(ctx context.Context) ([]Rental, error)
+	// FindByID returns ErrRentalNotFound when there is no rental with id or it is deleted
+	FindByID(ctx context.Context, id uint) (Rental, error)
+	// FindByIDs returns the existing rentals among ids in a single query, the order is not defined
+	FindByIDs(ctx context.Context, ids []uint) ([]Rental, error)
+	// FindByFilter returns a page of the rentals matching the filter, in ID order unless the filter sorts
+	// them and then with the ties in ID order, along with the number of matching rentals
+	FindByFilter(ctx context.Context, filter RentalFindFilter) (Response[Rental], error)
+	// StreamByFilter calls fn for every rental matching the selection part of the filter,
+	// rentals are visited in ID order, a non-nil error from fn stops the iteration.
+	StreamByFilter(ctx context.Context, filter RentalFindFilter, fn func(Rental) error) error
+	// Upsert inserts rentals without ID and updates the existing ones in a single transaction, the writes
+	// of Upsert and Restore record their revisions in the same transaction
+	Upsert(ctx context.Context, rentals []Rental) error
+	// Update writes the rental if it is still at rental.Version and returns it at its new version, a
+	// *ConflictError when it changed since and ErrRentalNotFound when it does not exist
+	Update(ctx context.Context, rental Rental) (Rental, error)
+
+	// FindDeleted returns the soft-deleted rentals matching the filter, the last deleted first unless
+	// the filter sorts them
+	FindDeleted(ctx context.Context, filter RentalFindFilter) (Response[Rental], error)
+	// Restore undeletes a soft-deleted rental, ErrRentalNotFound when there is none with id
+	Restore(ctx context.Context, id uint) (Rental, error)
+	// Purge removes a soft-deleted rental and its revisions for good, ErrRentalNotFound when there is none with id
+	Purge(ctx context.Context, id uint) error
+	// PurgeDeleted removes for good the rentals soft-deleted before the time and their revisions, it returns
+	// the IDs of the rentals
+	PurgeDeleted(ctx context.Context, before time.Time) ([]uint, error)
+
+	// FindRevisions returns the revisions of a rental, the last one first
+	FindRevisions(ctx context.Context, id uint, page ViewFilter) (Response[RentalRevision], error)
+	// FindAsOf returns the rental as it was at the time, ErrRentalNotFound when it did not exist or was deleted
+	FindAsOf(ctx context.Context, id uint, at time.Time) (Rental, error)
 }
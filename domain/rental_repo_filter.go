@@ -3,6 +3,8 @@ package domain
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -164,6 +166,59 @@ func (f *RentalFindFilter) String() string {
 	return s
 }
 
+// Key is the canonical encoding of the filter, the filters selecting the same page have the same key.
+// Unlike String its field order is fixed, IDs are sorted and deduplicated since their order does not
+// change the result, and an unset option differs from a zero one.
+func (f *RentalFindFilter) Key() string {
+	var b strings.Builder
+	optUint := func(name string, v uint, ok bool) {
+		b.WriteString(name + "=")
+		if ok {
+			b.WriteString(strconv.FormatUint(uint64(v), 10))
+		}
+		b.WriteByte(';')
+	}
+
+	priceMin, priceMinOk := f.PriceMin()
+	optUint("price_min", priceMin, priceMinOk)
+	priceMax, priceMaxOk := f.PriceMax()
+	optUint("price_max", priceMax, priceMaxOk)
+
+	b.WriteString("ids=")
+	if ids, ok := f.RentalIDs(); ok {
+		sorted := append([]int(nil), ids...)
+		sort.Ints(sorted)
+		for i, id := range sorted {
+			if i > 0 && id == sorted[i-1] {
+				continue
+			}
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(strconv.Itoa(id))
+		}
+	}
+	b.WriteByte(';')
+
+	b.WriteString("near=")
+	if near, ok := f.Coords(); ok {
+		b.WriteString(strconv.FormatFloat(near[0], 'g', -1, 64) + "," + strconv.FormatFloat(near[1], 'g', -1, 64))
+	}
+	b.WriteByte(';')
+
+	b.WriteString("sort=")
+	if s, ok := f.Sort(); ok {
+		b.WriteString(s.s)
+	}
+	b.WriteByte(';')
+
+	limit, limitOk := f.Limit()
+	optUint("limit", limit, limitOk)
+	offset, offsetOk := f.Offset()
+	optUint("offset", offset, offsetOk)
+	return b.String()
+}
+
 type RentalFindFilterBuilder struct {
 	filter RentalFindFilter
 }
@@ -85,3 +85,31 @@ func TestRentalFindFilterBuilderError(t *testing.T) {
 		Build()
 	assert.Error(err)
 }
+
+func TestRentalFindFilterKey(t *testing.T) {
+	assert := assert.New(t)
+
+	a, _ := NewRentalFilterBuilder().
+		WithPriceMin(1000).
+		WithRentalIDs([]int{3, 1, 2, 3}).
+		WithCoords([2]float64{33.64, -117.93}).
+		WithSort(SortPriceAsc).
+		WithLimit(10).
+		Build()
+	b, _ := NewRentalFilterBuilder().
+		WithLimit(10).
+		WithSort(SortPriceAsc).
+		WithCoords([2]float64{33.64, -117.93}).
+		WithRentalIDs([]int{1, 2, 3}).
+		WithPriceMin(1000).
+		Build()
+	assert.Equal("price_min=1000;price_max=;ids=1,2,3;near=33.64,-117.93;sort=price_per_day#asc;limit=10;offset=;", a.Key())
+	assert.Equal(a.Key(), b.Key())
+
+	// an unset option is not a zero one
+	zero, _ := NewRentalFilterBuilder().WithPriceMin(1000).WithRentalIDs([]int{1, 2, 3}).
+		WithCoords([2]float64{33.64, -117.93}).WithSort(SortPriceAsc).WithLimit(10).WithOffset(0).Build()
+	assert.NotEqual(a.Key(), zero.Key())
+
+	assert.Equal("price_min=;price_max=;ids=;near=;sort=;limit=;offset=;", (&RentalFindFilter{}).Key())
+}
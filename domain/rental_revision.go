@@ -0,0 +1,88 @@
+package domain
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+type RevisionAction string
+
+const (
+	RevisionCreate  RevisionAction = "create"
+	RevisionUpdate  RevisionAction = "update"
+	RevisionRestore RevisionAction = "restore"
+	// RevisionBaseline records the rentals as they were when the history started
+	RevisionBaseline RevisionAction = "baseline"
+)
+
+// FieldChange is the old and new value of a field, old is null for a created rental
+type FieldChange struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+// RentalRevision is a change of a rental, Diff is keyed by the JSON path of the changed fields,
+// e.g. "price.day" or "location.city"
+type RentalRevision struct {
+	ID        uint                   `json:"id"`
+	RentalID  uint                   `json:"rental_id"`
+	Action    RevisionAction         `json:"action"`
+	Actor     string                 `json:"actor"`
+	ChangedAt time.Time              `json:"changed_at"`
+	Diff      map[string]FieldChange `json:"diff"`
+}
+
+// RevisionState is the part of a rental recorded by the revisions, the owner is kept by ID only and
+// the version, which changes with every revision, is left out
+func RevisionState(r Rental) Rental {
+	r.User = User{ID: r.User.ID}
+	r.Version = 0
+	r.Images = nil
+	return r
+}
+
+// DiffRentals returns the fields which differ between the revision states of old and new, every
+// field of new when old is nil
+func DiffRentals(old *Rental, new Rental) map[string]FieldChange {
+	oldFields := map[string]any{}
+	if old != nil {
+		oldFields = flatten(RevisionState(*old))
+	}
+	newFields := flatten(RevisionState(new))
+
+	diff := make(map[string]FieldChange)
+	for path, value := range newFields {
+		if prev, ok := oldFields[path]; !ok || !reflect.DeepEqual(prev, value) {
+			diff[path] = FieldChange{Old: prev, New: value}
+		}
+	}
+	for path, prev := range oldFields {
+		if _, ok := newFields[path]; !ok {
+			diff[path] = FieldChange{Old: prev}
+		}
+	}
+	return diff
+}
+
+// flatten returns the JSON leaves of the rental by their dotted path, so the diff holds the changed
+// leaves only and not the whole location when its city changes
+func flatten(r Rental) map[string]any {
+	data, _ := json.Marshal(r)
+	var tree map[string]any
+	_ = json.Unmarshal(data, &tree)
+
+	fields := make(map[string]any)
+	var walk func(prefix string, node map[string]any)
+	walk = func(prefix string, node map[string]any) {
+		for key, value := range node {
+			if child, ok := value.(map[string]any); ok {
+				walk(prefix+key+".", child)
+				continue
+			}
+			fields[prefix+key] = value
+		}
+	}
+	walk("", tree)
+	return fields
+}
@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffRentals(t *testing.T) {
+	old := Rental{
+		ID:       1,
+		Name:     "Maupin: Vanagon Camper",
+		Price:    Price{Day: 16900},
+		Location: Location{City: "Costa Mesa", State: "CA"},
+		User:     User{ID: 1, FirstName: "John"},
+	}
+
+	t.Run("changed leaves only", func(t *testing.T) {
+		new := old
+		new.Price.Day = 15000
+		new.Location.City = "Irvine"
+		// the owner names are not part of the rental
+		new.User.FirstName = "Johnny"
+
+		assert.Equal(t, map[string]FieldChange{
+			"price.day":     {Old: float64(16900), New: float64(15000)},
+			"location.city": {Old: "Costa Mesa", New: "Irvine"},
+		}, DiffRentals(&old, new))
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		assert.Empty(t, DiffRentals(&old, old))
+	})
+
+	t.Run("created", func(t *testing.T) {
+		diff := DiffRentals(nil, old)
+		assert.Equal(t, FieldChange{New: "Maupin: Vanagon Camper"}, diff["name"])
+		assert.Equal(t, FieldChange{New: float64(1)}, diff["user.id"])
+		assert.NotContains(t, diff, "deleted_at")
+	})
+
+	t.Run("restored", func(t *testing.T) {
+		deleted := old
+		deletedAt := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+		deleted.DeletedAt = &deletedAt
+
+		assert.Equal(t, map[string]FieldChange{
+			"deleted_at": {Old: "2023-05-01T12:00:00Z"},
+		}, DiffRentals(&deleted, old))
+	})
+}
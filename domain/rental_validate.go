@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RentalTypes are the vehicle types a rental can be listed as
+var RentalTypes = []string{
+	"camper-van",
+	"class-a",
+	"class-b",
+	"class-c",
+	"fifth-wheel",
+	"travel-trailer",
+	"truck-camper",
+	"toy-hauler",
+	"popup-camper",
+	"other",
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+type ValidationErrors []FieldError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func IsKnownRentalType(t string) bool {
+	for _, rt := range RentalTypes {
+		if rt == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the rental can be stored, all violations are returned as ValidationErrors
+func (r Rental) Validate() error {
+	var errs ValidationErrors
+	if strings.TrimSpace(r.Name) == "" {
+		errs = append(errs, FieldError{"name", "is required"})
+	}
+	if r.Type == "" {
+		errs = append(errs, FieldError{"type", "is required"})
+	} else if !IsKnownRentalType(r.Type) {
+		errs = append(errs, FieldError{"type", fmt.Sprintf("unknown type %q", r.Type)})
+	}
+	if r.User.ID <= 0 {
+		errs = append(errs, FieldError{"user.id", "is required"})
+	}
+	if r.Price.Day <= 0 {
+		errs = append(errs, FieldError{"price.day", "must be positive"})
+	}
+	if r.Location.Lat < -90 || r.Location.Lat > 90 {
+		errs = append(errs, FieldError{"location.lat", "must be between -90 and 90"})
+	}
+	if r.Location.Lng < -180 || r.Location.Lng > 180 {
+		errs = append(errs, FieldError{"location.lng", "must be between -180 and 180"})
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRentalValidate(t *testing.T) {
+	valid := Rental{
+		Name:     "Van",
+		Type:     "camper-van",
+		Price:    Price{Day: 100},
+		Location: Location{Lat: 33.64, Lng: -117.93},
+		User:     User{ID: 1},
+	}
+	assert.NoError(t, valid.Validate())
+
+	invalid := Rental{
+		Type:     "spaceship",
+		Location: Location{Lat: 91, Lng: -181},
+	}
+	err := invalid.Validate()
+	assert.Equal(t, ValidationErrors{
+		{"name", "is required"},
+		{"type", `unknown type "spaceship"`},
+		{"user.id", "is required"},
+		{"price.day", "must be positive"},
+		{"location.lat", "must be between -90 and 90"},
+		{"location.lng", "must be between -180 and 180"},
+	}, err)
+	assert.Contains(t, err.Error(), "name: is required; type: unknown type")
+}
@@ -25,3 +25,9 @@ func NewResponse[RepoModel any, DomainModel any](filter ViewFilter, total int64,
 		Items: repoToDomain(items),
 	}
 }
+
+// BatchResponse holds the found items in the requested order and the IDs which were not found
+type BatchResponse[T any] struct {
+	Items    []T    `json:"items"`
+	NotFound []uint `json:"not_found"`
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/plar/rentals-api/auth"
+	"github.com/plar/rentals-api/domain"
+)
+
+// StatusClientClosedRequest is the non-standard (nginx) status of requests the client gave up on
+const StatusClientClosedRequest = 499
+
+// errorResponse maps err to a status code and body, a canceled request becomes 499, a request
+// which ran out of its deadline 503, a request denied by the policy 403, a missing rental or image 404, an
+// update of a rental which changed since 412 and an invalid image or image order 422, any other error gets
+// the fallback status and message.
+func errorResponse(err error, status int, msg string) (int, gin.H) {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return StatusClientClosedRequest, gin.H{"error": "request canceled"}
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable, gin.H{"error": "request timed out"}
+	case errors.Is(err, auth.ErrForbidden):
+		return http.StatusForbidden, gin.H{"error": err.Error()}
+	case errors.Is(err, domain.ErrRentalNotFound):
+		return http.StatusNotFound, gin.H{"error": err.Error()}
+	case errors.Is(err, domain.ErrConflict):
+		return http.StatusPreconditionFailed, gin.H{"error": err.Error()}
+	case errors.Is(err, domain.ErrImageNotFound):
+		return http.StatusNotFound, gin.H{"error": err.Error()}
+	case errors.Is(err, domain.ErrInvalidImage), errors.Is(err, domain.ErrImageOrder):
+		return http.StatusUnprocessableEntity, gin.H{"error": err.Error()}
+	}
+	return status, gin.H{"error": msg}
+}
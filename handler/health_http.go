@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/plar/rentals-api/logs"
+)
+
+// readyCheckTimeout bounds the time /readyz spends on its dependency checks
+const readyCheckTimeout = 2 * time.Second
+
+type HealthHandler interface {
+	Healthz(c *gin.Context)
+	Readyz(c *gin.Context)
+	Status(c *gin.Context)
+	// ShutdownStarted makes /readyz fail, the orchestrator stops routing traffic to the instance then
+	ShutdownStarted()
+}
+
+// ReadinessCheck reports an error when a dependency the service needs is not usable
+type ReadinessCheck func(ctx context.Context) error
+
+type BuildInfo struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+}
+
+type DBPoolStats struct {
+	MaxOpenConnections int    `json:"max_open_connections"`
+	OpenConnections    int    `json:"open_connections"`
+	InUse              int    `json:"in_use"`
+	Idle               int    `json:"idle"`
+	WaitCount          int64  `json:"wait_count"`
+	WaitDuration       string `json:"wait_duration"`
+	MaxIdleClosed      int64  `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64  `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64  `json:"max_lifetime_closed"`
+}
+
+type StatusResponse struct {
+	BuildInfo
+	StartedAt     time.Time    `json:"started_at"`
+	Uptime        string       `json:"uptime"`
+	UptimeSeconds int64        `json:"uptime_seconds"`
+	DB            *DBPoolStats `json:"db,omitempty"`
+}
+
+type healthHandler struct {
+	db           *sql.DB
+	migrated     ReadinessCheck
+	build        BuildInfo
+	startedAt    time.Time
+	shuttingDown atomic.Bool
+	logger       *zap.Logger
+}
+
+// NewHealthHandler returns the probes of a service backed by db, without database (nil db, e.g. with the
+// memory backend) /readyz checks neither the database nor the migrations and /status has no pool stats
+func NewHealthHandler(db *sql.DB, migrated ReadinessCheck, build BuildInfo, logger *zap.Logger) HealthHandler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &healthHandler{
+		db:        db,
+		migrated:  migrated,
+		build:     build,
+		startedAt: time.Now(),
+		logger:    logger,
+	}
+}
+
+// Healthz reports that the process is alive, it does not depend on the database
+func (h *healthHandler) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz reports whether the instance can serve requests: the database answers, the schema is
+// migrated and the graceful shutdown has not started
+func (h *healthHandler) Readyz(c *gin.Context) {
+	if h.shuttingDown.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "shutting down"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readyCheckTimeout)
+	defer cancel()
+
+	type readinessCheck struct {
+		name string
+		fn   ReadinessCheck
+	}
+	var readinessChecks []readinessCheck
+	if h.db != nil {
+		readinessChecks = append(readinessChecks, readinessCheck{"database", h.db.PingContext}, readinessCheck{"migrations", h.migrated})
+	}
+
+	status, ready := http.StatusOK, "ok"
+	checks := gin.H{}
+	for _, check := range readinessChecks {
+		if err := check.fn(ctx); err != nil {
+			logs.WithContext(ctx, h.logger).Warn("Readiness check failed", zap.String("check", check.name), zap.Error(err))
+			status, ready = http.StatusServiceUnavailable, "unavailable"
+			checks[check.name] = err.Error()
+			// the following checks need the database as well
+			break
+		}
+		checks[check.name] = "ok"
+	}
+
+	c.JSON(status, gin.H{"status": ready, "checks": checks})
+}
+
+func (h *healthHandler) Status(c *gin.Context) {
+	uptime := time.Since(h.startedAt)
+	resp := StatusResponse{
+		BuildInfo:     h.build,
+		StartedAt:     h.startedAt.UTC(),
+		Uptime:        uptime.Round(time.Second).String(),
+		UptimeSeconds: int64(uptime.Seconds()),
+	}
+	if h.db != nil {
+		stats := h.db.Stats()
+		resp.DB = &DBPoolStats{
+			MaxOpenConnections: stats.MaxOpenConnections,
+			OpenConnections:    stats.OpenConnections,
+			InUse:              stats.InUse,
+			Idle:               stats.Idle,
+			WaitCount:          stats.WaitCount,
+			WaitDuration:       stats.WaitDuration.String(),
+			MaxIdleClosed:      stats.MaxIdleClosed,
+			MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+			MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *healthHandler) ShutdownStarted() {
+	h.shuttingDown.Store(true)
+}
@@ -0,0 +1,133 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/plar/rentals-api/handler"
+)
+
+func healthRouter(h handler.HealthHandler) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/healthz", h.Healthz)
+	router.GET("/readyz", h.Readyz)
+	router.GET("/status", h.Status)
+	return router
+}
+
+func serve(router *gin.Engine, path string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", path, nil)
+	router.ServeHTTP(w, req)
+
+	var body map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	return w, body
+}
+
+func TestHealth(t *testing.T) {
+	migrated := func(ctx context.Context) error { return nil }
+	build := handler.BuildInfo{Version: "v1.0.0", Commit: "abc123"}
+
+	t.Run("healthz does not touch the database", func(t *testing.T) {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		require.NoError(t, err)
+		defer db.Close()
+
+		w, body := serve(healthRouter(handler.NewHealthHandler(db, migrated, build, nil)), "/healthz")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "ok", body["status"])
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("readyz ok", func(t *testing.T) {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		require.NoError(t, err)
+		defer db.Close()
+		mock.ExpectPing()
+
+		w, body := serve(healthRouter(handler.NewHealthHandler(db, migrated, build, nil)), "/readyz")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, map[string]interface{}{"database": "ok", "migrations": "ok"}, body["checks"])
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("readyz database down", func(t *testing.T) {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		require.NoError(t, err)
+		defer db.Close()
+		mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+		called := false
+		h := handler.NewHealthHandler(db, func(ctx context.Context) error { called = true; return nil }, build, nil)
+		w, body := serve(healthRouter(h), "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "unavailable", body["status"])
+		assert.Equal(t, map[string]interface{}{"database": "connection refused"}, body["checks"])
+		assert.False(t, called)
+	})
+
+	t.Run("readyz not migrated", func(t *testing.T) {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		require.NoError(t, err)
+		defer db.Close()
+		mock.ExpectPing()
+
+		h := handler.NewHealthHandler(db, func(ctx context.Context) error { return errors.New("table for *repository.Rental is missing") }, build, nil)
+		w, body := serve(healthRouter(h), "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, map[string]interface{}{"database": "ok", "migrations": "table for *repository.Rental is missing"}, body["checks"])
+	})
+
+	t.Run("readyz fails during shutdown", func(t *testing.T) {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		require.NoError(t, err)
+		defer db.Close()
+
+		h := handler.NewHealthHandler(db, migrated, build, nil)
+		h.ShutdownStarted()
+		w, body := serve(healthRouter(h), "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "shutting down", body["status"])
+		assert.NoError(t, mock.ExpectationsWereMet())
+
+		// the process is still alive
+		w, _ = serve(healthRouter(h), "/healthz")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("status", func(t *testing.T) {
+		db, _, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		w, body := serve(healthRouter(handler.NewHealthHandler(db, migrated, build, nil)), "/status")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "v1.0.0", body["version"])
+		assert.Equal(t, "abc123", body["commit"])
+		assert.Contains(t, body, "uptime")
+		assert.Contains(t, body, "started_at")
+		assert.Contains(t, body["db"], "open_connections")
+	})
+
+	t.Run("without database", func(t *testing.T) {
+		h := handler.NewHealthHandler(nil, nil, build, nil)
+		w, body := serve(healthRouter(h), "/readyz")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "ok", body["status"])
+
+		w, body = serve(healthRouter(h), "/status")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, body, "db")
+	})
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDeletedRentals lists the soft-deleted rentals, the last deleted first. It takes the filter, sort and
+// pagination parameters of GetRentals and answers JSON only.
+func (h *rentalHandler) GetDeletedRentals(c *gin.Context) {
+	filter, err := createRentalFindFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := h.service.GetDeletedRentals(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(errorResponse(err, http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// RestoreRental undeletes a soft-deleted rental and returns it
+func (h *rentalHandler) RestoreRental(c *gin.Context) {
+	var req RentalByIDRequest
+	if err := c.ShouldBindUri(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rental ID"})
+		return
+	}
+
+	rental, err := h.service.RestoreRental(c.Request.Context(), req.ID)
+	if err != nil {
+		c.JSON(errorResponse(err, http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, rental)
+}
+
+// PurgeRental removes a soft-deleted rental for good, a rental which is not deleted is not found
+func (h *rentalHandler) PurgeRental(c *gin.Context) {
+	var req RentalByIDRequest
+	if err := c.ShouldBindUri(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rental ID"})
+		return
+	}
+
+	if err := h.service.PurgeRental(c.Request.Context(), req.ID); err != nil {
+		c.JSON(errorResponse(err, http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,107 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/plar/rentals-api/auth"
+	"github.com/plar/rentals-api/domain"
+	"github.com/plar/rentals-api/handler"
+	"github.com/plar/rentals-api/service/mocks"
+)
+
+func newAdminRouter(mockService *mocks.RentalService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	h := handler.NewRentalHandler(mockService, nil)
+	router.GET("/admin/rentals/deleted", h.GetDeletedRentals)
+	router.POST("/admin/rentals/:id/restore", h.RestoreRental)
+	router.DELETE("/admin/rentals/:id/purge", h.PurgeRental)
+	return router
+}
+
+func TestGetDeletedRentals(t *testing.T) {
+	deletedAt := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	mockService := new(mocks.RentalService)
+	mockService.On("GetDeletedRentals", mock.Anything, mock.MatchedBy(func(f domain.RentalFindFilter) bool {
+		limit, _ := f.Limit()
+		offset, _ := f.Offset()
+		return limit == 5 && offset == 10
+	})).Return(domain.Response[domain.Rental]{
+		Paginator: domain.Paginator{Limit: 5, Offset: 10, TotalItems: 11},
+		Items:     []domain.Rental{{ID: 3, DeletedAt: &deletedAt}},
+	}, nil)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/admin/rentals/deleted?limit=5&offset=10", nil)
+	newAdminRouter(mockService).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Items []map[string]any
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, resp.Items, 1)
+	assert.Equal(t, "2023-05-01T12:00:00Z", resp.Items[0]["deleted_at"])
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/admin/rentals/deleted?limit=500", nil)
+	newAdminRouter(mockService).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestRestoreRental(t *testing.T) {
+	mockService := new(mocks.RentalService)
+	mockService.On("RestoreRental", mock.Anything, uint(3)).Return(domain.Rental{ID: 3, Name: "Restored"}, nil)
+	mockService.On("RestoreRental", mock.Anything, uint(4)).Return(domain.Rental{}, domain.ErrRentalNotFound)
+	mockService.On("RestoreRental", mock.Anything, uint(5)).Return(domain.Rental{}, &auth.ForbiddenError{Action: auth.ActionAdmin})
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/admin/rentals/3/restore", http.StatusOK},
+		{"/admin/rentals/4/restore", http.StatusNotFound},
+		{"/admin/rentals/5/restore", http.StatusForbidden},
+		{"/admin/rentals/x/restore", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", tt.path, bytes.NewBuffer(nil))
+			newAdminRouter(mockService).ServeHTTP(w, req)
+			assert.Equal(t, tt.code, w.Code)
+		})
+	}
+	mockService.AssertExpectations(t)
+}
+
+func TestPurgeRental(t *testing.T) {
+	mockService := new(mocks.RentalService)
+	mockService.On("PurgeRental", mock.Anything, uint(3)).Return(nil)
+	mockService.On("PurgeRental", mock.Anything, uint(4)).Return(domain.ErrRentalNotFound)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/admin/rentals/3/purge", nil)
+	newAdminRouter(mockService).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/admin/rentals/4/purge", nil)
+	newAdminRouter(mockService).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error": "rental not found"}`, w.Body.String())
+
+	mockService.AssertExpectations(t)
+}
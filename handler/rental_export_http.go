@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/plar/rentals-api/codec"
+	"github.com/plar/rentals-api/domain"
+	"github.com/plar/rentals-api/logs"
+)
+
+// exportFlushEvery is the number of rentals written between two flushes of the chunked response
+const exportFlushEvery = 100
+
+func negotiateExportFormat(c *gin.Context) (codec.Format, error) {
+	if f, ok := c.GetQuery("format"); ok {
+		format, err := codec.ParseFormat(f)
+		if err != nil {
+			return "", err
+		}
+		if format != codec.FormatNDJSON && format != codec.FormatCSV {
+			return "", fmt.Errorf("format %q is not supported by export", f)
+		}
+		return format, nil
+	}
+
+	mime := c.NegotiateFormat(codec.MIMENDJSON, codec.MIMECSV)
+	format, ok := codec.FormatFromMIME(mime)
+	if !ok {
+		return "", fmt.Errorf("unsupported media type %q", c.GetHeader("Accept"))
+	}
+	return format, nil
+}
+
+// ExportRentals streams every rental matching the selection filter (price, ids, near) as NDJSON or CSV.
+// Limit, offset and sort are not supported, rentals are written in ID order.
+func (h *rentalHandler) ExportRentals(c *gin.Context) {
+	format, err := negotiateExportFormat(c)
+	if err != nil {
+		c.JSON(http.StatusNotAcceptable, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter, err := createRentalSelectionFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	enc, err := codec.NewRentalEncoder(format, c.Writer)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=rentals.%s", format))
+	c.Status(http.StatusOK)
+
+	// the request context is canceled when the client goes away, stop reading rows then
+	ctx := c.Request.Context()
+	exported := 0
+	err = h.service.ExportRentals(ctx, filter, func(rental domain.Rental) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := enc.Encode(rental); err != nil {
+			return err
+		}
+		exported++
+		if exported%exportFlushEvery == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = enc.Close()
+		c.Writer.Flush()
+	}
+
+	if err != nil && !errors.Is(err, context.Canceled) && !c.Writer.Written() {
+		// nothing was sent yet (denied, failed before the first row), the client gets a proper error
+		c.Writer.Header().Del("Content-Disposition")
+		c.JSON(errorResponse(err, http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	log := logs.WithContext(ctx, h.logger)
+	switch {
+	case err == nil:
+		log.Debug("Rentals exported", zap.Int("count", exported))
+	case errors.Is(err, context.Canceled):
+		log.Info("Rentals export canceled by client", zap.Int("count", exported))
+	default:
+		// the status line is already sent, the client gets a truncated body
+		log.Error("Rentals export failed", zap.Int("count", exported), zap.Error(err))
+		c.Error(err)
+	}
+}
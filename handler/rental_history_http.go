@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/plar/rentals-api/domain"
+)
+
+type RentalHistoryRequest struct {
+	Limit  *uint `form:"limit,default=10" binding:"min=1,max=100"`
+	Offset *uint `form:"offset,default=0" binding:"omitempty,gte=0"`
+}
+
+// GetRentalHistory returns the revisions of a rental, the last one first, with who changed which fields and when
+func (h *rentalHandler) GetRentalHistory(c *gin.Context) {
+	var uri RentalByIDRequest
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rental ID"})
+		return
+	}
+	var req RentalHistoryRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := domain.NewRentalFilterBuilder().WithLimit(*req.Limit).WithOffset(*req.Offset).Build()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := h.service.GetRentalHistory(c.Request.Context(), uri.ID, &page)
+	if err != nil {
+		c.JSON(errorResponse(err, http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,88 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/plar/rentals-api/domain"
+	"github.com/plar/rentals-api/handler"
+	"github.com/plar/rentals-api/service/mocks"
+)
+
+func newHistoryRouter(mockService *mocks.RentalService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	h := handler.NewRentalHandler(mockService, nil)
+	router.GET("/rentals/:id", h.GetRentalByID)
+	router.GET("/rentals/:id/history", h.GetRentalHistory)
+	return router
+}
+
+func TestGetRentalHistory(t *testing.T) {
+	changedAt := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	mockService := new(mocks.RentalService)
+	mockService.On("GetRentalHistory", mock.Anything, uint(1), mock.MatchedBy(func(page domain.ViewFilter) bool {
+		limit, _ := page.Limit()
+		offset, _ := page.Offset()
+		return limit == 1 && offset == 2
+	})).Return(domain.Response[domain.RentalRevision]{
+		Paginator: domain.Paginator{Limit: 1, Offset: 2, TotalItems: 3},
+		Items: []domain.RentalRevision{{
+			ID: 1, RentalID: 1, Action: domain.RevisionUpdate, Actor: "7", ChangedAt: changedAt,
+			Diff: map[string]domain.FieldChange{"price.day": {Old: 16900, New: 15000}},
+		}},
+	}, nil)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/rentals/1/history?limit=1&offset=2", nil)
+	newHistoryRouter(mockService).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+		"Paginator": {"Limit": 1, "Offset": 2, "TotalItems": 3},
+		"Items": [{
+			"id": 1, "rental_id": 1, "action": "update", "actor": "7", "changed_at": "2023-05-01T12:00:00Z",
+			"diff": {"price.day": {"old": 16900, "new": 15000}}
+		}]
+	}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/rentals/1/history?limit=0", nil)
+	newHistoryRouter(mockService).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestGetRentalAsOf(t *testing.T) {
+	at := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	mockService := new(mocks.RentalService)
+	mockService.On("GetRentalAsOf", mock.Anything, uint(1), mock.MatchedBy(at.Equal)).Return(domain.Rental{ID: 1, Price: domain.Price{Day: 16900}}, nil)
+	mockService.On("GetRentalAsOf", mock.Anything, uint(2), mock.Anything).Return(domain.Rental{}, domain.ErrRentalNotFound)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/rentals/1?as_of=2023-05-01T14:00:00%2B02:00", nil)
+	newHistoryRouter(mockService).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var rental domain.Rental
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rental))
+	assert.Equal(t, 16900, rental.Price.Day)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/rentals/2?as_of=2023-05-01T12:00:00Z", nil)
+	newHistoryRouter(mockService).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/rentals/1?as_of=yesterday", nil)
+	newHistoryRouter(mockService).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	mockService.AssertExpectations(t)
+}
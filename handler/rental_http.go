@@ -5,17 +5,28 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 
+	"github.com/plar/rentals-api/codec"
 	"github.com/plar/rentals-api/domain"
+	"github.com/plar/rentals-api/logs"
 	"github.com/plar/rentals-api/service"
 )
 
 type RentalHandler interface {
 	GetRentalByID(c *gin.Context)
+	BatchGetRentals(c *gin.Context)
 	GetRentals(c *gin.Context)
+	ExportRentals(c *gin.Context)
+	ImportRentals(c *gin.Context)
+	GetDeletedRentals(c *gin.Context)
+	RestoreRental(c *gin.Context)
+	PurgeRental(c *gin.Context)
+	GetRentalHistory(c *gin.Context)
+	UpdateRental(c *gin.Context)
 }
 
 type rentalHandler struct {
@@ -37,37 +48,110 @@ type RentalByIDRequest struct {
 	ID uint `uri:"id"`
 }
 
+// RentalAsOfRequest asks for the rental as it was at an RFC 3339 time
+type RentalAsOfRequest struct {
+	AsOf *time.Time `form:"as_of" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+// GetRentalByID returns the current rental with its version as ETag, 304 when it matches If-None-Match,
+// or the rental as it was at the as_of time
 func (h *rentalHandler) GetRentalByID(c *gin.Context) {
 	var req RentalByIDRequest
 	if err := c.ShouldBindUri(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rental ID"})
 		return
 	}
-	rental, err := h.service.GetRentalByID(req.ID)
+	var asOf RentalAsOfRequest
+	if err := c.ShouldBindQuery(&asOf); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid as_of time, use RFC 3339"})
+		return
+	}
+
+	var (
+		rental domain.Rental
+		err    error
+	)
+	if asOf.AsOf != nil {
+		rental, err = h.service.GetRentalAsOf(c.Request.Context(), req.ID, *asOf.AsOf)
+	} else {
+		rental, err = h.service.GetRentalByID(c.Request.Context(), req.ID)
+	}
 
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "rental not found"})
+		c.JSON(errorResponse(err, http.StatusNotFound, "rental not found"))
 		return
 	}
 
+	// a past state has no version of its own
+	if asOf.AsOf == nil {
+		etag := rentalETag(rental.Version)
+		c.Header("ETag", etag)
+		if matchesETag(c.GetHeader("If-None-Match"), etag) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
 	c.JSON(http.StatusOK, rental)
 }
 
-type RentalsRequest struct {
+// RentalsBatchGetRequest accepts up to 100 IDs
+type RentalsBatchGetRequest struct {
+	IDs []uint `json:"ids" binding:"required,min=1,max=100,dive,gt=0"`
+}
+
+// BatchGetRentals returns rentals in the requested order along with the IDs which do not exist.
+// Unlike GetRentals?ids=... it is not paginated.
+func (h *rentalHandler) BatchGetRentals(c *gin.Context) {
+	var req RentalsBatchGetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := h.service.BatchGetRentals(c.Request.Context(), req.IDs)
+	if err != nil {
+		c.JSON(errorResponse(err, http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// CustomMethods dispatches custom methods such as POST /rentals:batchGet. gin cannot match a literal ':'
+// inside a path segment, so the route is registered as "/rentals:method" and the wildcard captures
+// ":batchGet" (including the colon), which is looked up in methods.
+func CustomMethods(methods map[string]gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h, ok := methods[c.Param("method")]; ok {
+			h(c)
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown method"})
+	}
+}
+
+// RentalsSelectionRequest holds the parameters which select rentals, it is shared by the listing and the export
+type RentalsSelectionRequest struct {
 	PriceMin *uint   `form:"price_min" binding:"omitempty,gte=0"`
 	PriceMax *uint   `form:"price_max" binding:"omitempty,gte=0"`
-	Limit    *uint   `form:"limit,default=10" binding:"min=1,max=100"`
-	Offset   *uint   `form:"offset,default=0" binding:"omitempty,gte=0"`
 	IDs      *string `form:"ids"`
 	Near     *string `form:"near"`
-	Sort     *string `form:"sort" binding:"omitempty,oneof=price price_asc price_desc year year_asc year_desc"`
 
 	parsedIDs  []int
 	parsedNear [2]float64
+}
+
+type RentalsRequest struct {
+	RentalsSelectionRequest
+
+	Limit  *uint   `form:"limit,default=10" binding:"min=1,max=100"`
+	Offset *uint   `form:"offset,default=0" binding:"omitempty,gte=0"`
+	Sort   *string `form:"sort" binding:"omitempty,oneof=price price_asc price_desc year year_asc year_desc"`
+
 	parsedSort domain.Sort
 }
 
-func (r *RentalsRequest) validate() (err error) {
+func (r *RentalsSelectionRequest) validate() (err error) {
 	if r.IDs != nil {
 		if r.parsedIDs, err = toIntSlice(*r.IDs); err != nil {
 			return fmt.Errorf("invalid ids input: %w", err)
@@ -80,6 +164,14 @@ func (r *RentalsRequest) validate() (err error) {
 		}
 	}
 
+	return nil
+}
+
+func (r *RentalsRequest) validate() (err error) {
+	if err = r.RentalsSelectionRequest.validate(); err != nil {
+		return err
+	}
+
 	r.parsedSort = domain.SortNone
 	if r.Sort != nil {
 		r.parsedSort = map[string]domain.Sort{
@@ -106,20 +198,83 @@ func createRentalFindFilter(c *gin.Context) (filter domain.RentalFindFilter, err
 	return toDomainRentalFilter(req)
 }
 
+func createRentalSelectionFilter(c *gin.Context) (filter domain.RentalFindFilter, err error) {
+	var req RentalsSelectionRequest
+	if err = c.ShouldBind(&req); err != nil {
+		return
+	} else if err = req.validate(); err != nil {
+		return
+	}
+
+	b := domain.NewRentalFilterBuilder()
+	applySelection(b, req)
+	return b.Build()
+}
+
 func (h *rentalHandler) GetRentals(c *gin.Context) {
+	format, err := negotiateFormat(c)
+	if err != nil {
+		c.JSON(http.StatusNotAcceptable, gin.H{"error": err.Error()})
+		return
+	}
+
 	filter, err := createRentalFindFilter(c)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	response, err := h.service.GetRentalsByFilter(filter)
+	response, err := h.service.GetRentalsByFilter(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(errorResponse(err, http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	if format == codec.FormatJSON {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	h.renderRentals(c, format, response)
+}
+
+// negotiateFormat picks the response format, explicit format= parameter wins over the Accept header
+func negotiateFormat(c *gin.Context) (codec.Format, error) {
+	if f, ok := c.GetQuery("format"); ok {
+		return codec.ParseFormat(f)
+	}
+
+	mime := c.NegotiateFormat(codec.MIMEs()...)
+	format, ok := codec.FormatFromMIME(mime)
+	if !ok {
+		return "", fmt.Errorf("unsupported media type %q", c.GetHeader("Accept"))
+	}
+	return format, nil
+}
+
+// renderRentals writes items in a non-JSON format, the body has no envelope so
+// the paginator goes to the response headers.
+func (h *rentalHandler) renderRentals(c *gin.Context, format codec.Format, response domain.Response[domain.Rental]) {
+	enc, err := codec.NewRentalEncoder(format, c.Writer)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	c.Header("X-Pagination-Limit", strconv.FormatUint(uint64(response.Paginator.Limit), 10))
+	c.Header("X-Pagination-Offset", strconv.FormatUint(uint64(response.Paginator.Offset), 10))
+	c.Header("X-Total-Count", strconv.FormatUint(uint64(response.Paginator.TotalItems), 10))
+	c.Header("Content-Type", format.ContentType())
+	c.Status(http.StatusOK)
+
+	for _, rental := range response.Items {
+		if err = enc.Encode(rental); err != nil {
+			logs.WithContext(c.Request.Context(), h.logger).Error("Cannot encode rental", zap.Uint("id", rental.ID), zap.Error(err))
+			return
+		}
+	}
+	if err = enc.Close(); err != nil {
+		logs.WithContext(c.Request.Context(), h.logger).Error("Cannot finish encoding", zap.String("format", string(format)), zap.Error(err))
+	}
 }
 
 func toIntSlice(s string) (ints []int, _ error) {
@@ -149,8 +304,7 @@ func toNear(s string) (near [2]float64, _ error) {
 	return
 }
 
-func toDomainRentalFilter(inp RentalsRequest) (domain.RentalFindFilter, error) {
-	b := domain.NewRentalFilterBuilder()
+func applySelection(b *domain.RentalFindFilterBuilder, inp RentalsSelectionRequest) {
 	if inp.PriceMin != nil {
 		b.WithPriceMin(*inp.PriceMin)
 	}
@@ -159,14 +313,6 @@ func toDomainRentalFilter(inp RentalsRequest) (domain.RentalFindFilter, error) {
 		b.WithPriceMax(*inp.PriceMax)
 	}
 
-	if inp.Limit != nil {
-		b.WithLimit(*inp.Limit)
-	}
-
-	if inp.Offset != nil {
-		b.WithOffset(*inp.Offset)
-	}
-
 	if inp.IDs != nil && len(*inp.IDs) > 0 {
 		b.WithRentalIDs(inp.parsedIDs)
 	}
@@ -174,6 +320,19 @@ func toDomainRentalFilter(inp RentalsRequest) (domain.RentalFindFilter, error) {
 	if inp.Near != nil {
 		b.WithCoords(inp.parsedNear)
 	}
+}
+
+func toDomainRentalFilter(inp RentalsRequest) (domain.RentalFindFilter, error) {
+	b := domain.NewRentalFilterBuilder()
+	applySelection(b, inp.RentalsSelectionRequest)
+
+	if inp.Limit != nil {
+		b.WithLimit(*inp.Limit)
+	}
+
+	if inp.Offset != nil {
+		b.WithOffset(*inp.Offset)
+	}
 
 	if inp.Sort != nil {
 		b.WithSort(inp.parsedSort)
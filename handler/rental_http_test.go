@@ -2,11 +2,16 @@ package handler_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/plar/rentals-api/auth"
 	"github.com/plar/rentals-api/domain"
 	"github.com/plar/rentals-api/handler"
 	"github.com/plar/rentals-api/service/mocks"
@@ -21,7 +26,7 @@ func TestGetRentalByID(t *testing.T) {
 
 	t.Run("/rentals/1", func(t *testing.T) {
 		mockService := new(mocks.RentalService)
-		mockService.On("GetRentalByID", mock.AnythingOfType("uint")).Return(mockRental, nil)
+		mockService.On("GetRentalByID", mock.Anything, mock.AnythingOfType("uint")).Return(mockRental, nil)
 
 		gin.SetMode(gin.TestMode)
 		router := gin.Default()
@@ -83,7 +88,7 @@ func TestGetRentals(t *testing.T) {
 
 	t.Run("/rentals (check filter default values)", func(t *testing.T) {
 		mockService := &mocks.RentalService{}
-		mockService.On("GetRentalsByFilter", mock.MatchedBy(func(f domain.RentalFindFilter) bool {
+		mockService.On("GetRentalsByFilter", mock.Anything, mock.MatchedBy(func(f domain.RentalFindFilter) bool {
 			// TODO: write a func to compare RentalFindFilter
 			if _, ok := f.PriceMin(); ok {
 				return false
@@ -129,7 +134,7 @@ func TestGetRentals(t *testing.T) {
 
 	t.Run("/rentals (check all filter values)", func(t *testing.T) {
 		mockService := &mocks.RentalService{}
-		mockService.On("GetRentalsByFilter", mock.MatchedBy(func(f domain.RentalFindFilter) bool {
+		mockService.On("GetRentalsByFilter", mock.Anything, mock.MatchedBy(func(f domain.RentalFindFilter) bool {
 			// TODO: write a func to compare RentalFindFilter
 			if pmin, ok := f.PriceMin(); !ok || pmin != uint(100) {
 				return false
@@ -175,4 +180,416 @@ func TestGetRentals(t *testing.T) {
 
 }
 
+func TestGetRentalsFormats(t *testing.T) {
+	mockResponse := domain.Response[domain.Rental]{
+		Paginator: domain.Paginator{
+			Limit:      10,
+			Offset:     0,
+			TotalItems: 2,
+		},
+		Items: []domain.Rental{
+			{ID: 1, Name: "Test Rental1", Location: domain.Location{Lat: 33.64, Lng: -117.93}},
+			{ID: 2, Name: "Test Rental2", Location: domain.Location{Lat: 45.51, Lng: -122.68}},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		url         string
+		accept      string
+		code        int
+		contentType string
+	}{
+		{"default", "/rentals", "", http.StatusOK, "application/json; charset=utf-8"},
+		{"accept any", "/rentals", "*/*", http.StatusOK, "application/json; charset=utf-8"},
+		{"accept geojson", "/rentals", "application/geo+json", http.StatusOK, "application/geo+json"},
+		{"accept csv", "/rentals", "text/csv", http.StatusOK, "text/csv"},
+		{"accept ndjson", "/rentals", "application/x-ndjson", http.StatusOK, "application/x-ndjson"},
+		{"format wins over accept", "/rentals?format=geojson", "text/csv", http.StatusOK, "application/geo+json"},
+		{"format json", "/rentals?format=json", "", http.StatusOK, "application/json; charset=utf-8"},
+		{"unknown format", "/rentals?format=xml", "", http.StatusNotAcceptable, "application/json; charset=utf-8"},
+		{"unknown accept", "/rentals", "application/xml", http.StatusNotAcceptable, "application/json; charset=utf-8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &mocks.RentalService{}
+			mockService.On("GetRentalsByFilter", mock.Anything, mock.Anything).Return(mockResponse, nil).Maybe()
+
+			gin.SetMode(gin.TestMode)
+			router := gin.Default()
+			handler := handler.NewRentalHandler(mockService, nil)
+			router.GET("/rentals", handler.GetRentals)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.url, bytes.NewBuffer(nil))
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.code, w.Code)
+			assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+
+			mockService.AssertExpectations(t)
+		})
+	}
+
+	t.Run("/rentals?format=geojson (body)", func(t *testing.T) {
+		mockService := &mocks.RentalService{}
+		mockService.On("GetRentalsByFilter", mock.Anything, mock.Anything).Return(mockResponse, nil)
+
+		gin.SetMode(gin.TestMode)
+		router := gin.Default()
+		handler := handler.NewRentalHandler(mockService, nil)
+		router.GET("/rentals", handler.GetRentals)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/rentals?format=geojson", bytes.NewBuffer(nil))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "2", w.Header().Get("X-Total-Count"))
+		assert.Equal(t, "10", w.Header().Get("X-Pagination-Limit"))
+
+		var fc struct {
+			Type     string
+			Features []struct {
+				ID       uint
+				Geometry struct {
+					Coordinates [2]float64
+				}
+			}
+		}
+		err := json.Unmarshal(w.Body.Bytes(), &fc)
+		assert.NoError(t, err)
+		assert.Equal(t, "FeatureCollection", fc.Type)
+		assert.Len(t, fc.Features, 2)
+		assert.Equal(t, [2]float64{-122.68, 45.51}, fc.Features[1].Geometry.Coordinates)
+
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("/rentals?format=csv (body)", func(t *testing.T) {
+		mockService := &mocks.RentalService{}
+		mockService.On("GetRentalsByFilter", mock.Anything, mock.Anything).Return(mockResponse, nil)
+
+		gin.SetMode(gin.TestMode)
+		router := gin.Default()
+		handler := handler.NewRentalHandler(mockService, nil)
+		router.GET("/rentals", handler.GetRentals)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/rentals?format=csv", bytes.NewBuffer(nil))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+		assert.Len(t, lines, 3)
+		assert.True(t, strings.HasPrefix(lines[0], "id,name,"))
+		assert.True(t, strings.HasPrefix(lines[1], "1,Test Rental1,"))
+
+		mockService.AssertExpectations(t)
+	})
+}
+
+func TestExportRentals(t *testing.T) {
+	mockRentals := []domain.Rental{
+		{ID: 1, Name: "Test Rental1"},
+		{ID: 2, Name: "Test Rental2"},
+	}
+	streamRentals := func(args mock.Arguments) {
+		fn := args.Get(2).(func(domain.Rental) error)
+		for _, r := range mockRentals {
+			if err := fn(r); err != nil {
+				return
+			}
+		}
+	}
+
+	t.Run("/rentals/export (ndjson)", func(t *testing.T) {
+		mockService := &mocks.RentalService{}
+		mockService.On("ExportRentals", mock.Anything, mock.MatchedBy(func(f domain.RentalFindFilter) bool {
+			pmin, ok := f.PriceMin()
+			if !ok || pmin != 100 {
+				return false
+			}
+			// export ignores pagination
+			_, limitOk := f.Limit()
+			_, offsetOk := f.Offset()
+			return !limitOk && !offsetOk
+		}), mock.Anything).Run(streamRentals).Return(nil)
+
+		gin.SetMode(gin.TestMode)
+		router := gin.Default()
+		handler := handler.NewRentalHandler(mockService, nil)
+		router.GET("/rentals/export", handler.ExportRentals)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/rentals/export?price_min=100", bytes.NewBuffer(nil))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+		lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+		assert.Len(t, lines, 2)
+		var rental domain.Rental
+		assert.NoError(t, json.Unmarshal([]byte(lines[1]), &rental))
+		assert.Equal(t, mockRentals[1], rental)
+
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("/rentals/export (csv)", func(t *testing.T) {
+		mockService := &mocks.RentalService{}
+		mockService.On("ExportRentals", mock.Anything, mock.Anything, mock.Anything).Run(streamRentals).Return(nil)
+
+		gin.SetMode(gin.TestMode)
+		router := gin.Default()
+		handler := handler.NewRentalHandler(mockService, nil)
+		router.GET("/rentals/export", handler.ExportRentals)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/rentals/export", bytes.NewBuffer(nil))
+		req.Header.Set("Accept", "text/csv")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+		assert.Equal(t, "attachment; filename=rentals.csv", w.Header().Get("Content-Disposition"))
+
+		lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+		assert.Len(t, lines, 3)
+
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("/rentals/export (geojson is not supported)", func(t *testing.T) {
+		mockService := &mocks.RentalService{}
+
+		gin.SetMode(gin.TestMode)
+		router := gin.Default()
+		handler := handler.NewRentalHandler(mockService, nil)
+		router.GET("/rentals/export", handler.ExportRentals)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/rentals/export?format=geojson", bytes.NewBuffer(nil))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotAcceptable, w.Code)
+
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("/rentals/export (forbidden)", func(t *testing.T) {
+		mockService := &mocks.RentalService{}
+		mockService.On("ExportRentals", mock.Anything, mock.Anything, mock.Anything).
+			Return(&auth.ForbiddenError{Subject: "7", Action: auth.ActionExport, Reason: "not granted to the caller roles"})
+
+		gin.SetMode(gin.TestMode)
+		router := gin.Default()
+		handler := handler.NewRentalHandler(mockService, nil)
+		router.GET("/rentals/export", handler.ExportRentals)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/rentals/export", bytes.NewBuffer(nil))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Empty(t, w.Header().Get("Content-Disposition"))
+		assert.JSONEq(t, `{"error":"rentals:export is not allowed: not granted to the caller roles"}`, w.Body.String())
+
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("/rentals/export (client disconnected)", func(t *testing.T) {
+		var streamErr error
+		mockService := &mocks.RentalService{}
+		mockService.On("ExportRentals", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			fn := args.Get(2).(func(domain.Rental) error)
+			streamErr = fn(mockRentals[0])
+		}).Return(context.Canceled)
+
+		gin.SetMode(gin.TestMode)
+		router := gin.Default()
+		handler := handler.NewRentalHandler(mockService, nil)
+		router.GET("/rentals/export", handler.ExportRentals)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(ctx, "GET", "/rentals/export", bytes.NewBuffer(nil))
+		router.ServeHTTP(w, req)
+		assert.ErrorIs(t, streamErr, context.Canceled)
+		assert.Empty(t, w.Body.String())
+
+		mockService.AssertExpectations(t)
+	})
+}
+
+func TestImportRentals(t *testing.T) {
+	csvBody := "name,type,price.day,user.id\nVan,camper-van,100,1\n"
+	okReport := domain.ImportReport{Total: 1, Valid: 1, Imported: 1, Errors: []domain.ImportRowError{}}
+	badReport := domain.ImportReport{DryRun: true, Total: 1, Errors: []domain.ImportRowError{{Line: 2, Errors: []string{"name: is required"}}}}
+
+	tests := []struct {
+		name        string
+		url         string
+		contentType string
+		body        string
+		dryRun      bool
+		report      *domain.ImportReport
+		code        int
+	}{
+		{"csv", "/rentals/import", "text/csv", csvBody, false, &okReport, http.StatusOK},
+		{"ndjson with charset", "/rentals/import", "application/x-ndjson; charset=utf-8", `{"name":"Van"}`, false, &okReport, http.StatusOK},
+		{"format param", "/rentals/import?format=csv", "text/plain", csvBody, false, &okReport, http.StatusOK},
+		{"dry run with errors", "/rentals/import?dry_run=true", "text/csv", csvBody, true, &badReport, http.StatusUnprocessableEntity},
+		{"unsupported content type", "/rentals/import", "application/json", "[]", false, nil, http.StatusUnsupportedMediaType},
+		{"bad csv header", "/rentals/import", "text/csv", "color\n", false, nil, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &mocks.RentalService{}
+			if tt.report != nil {
+				mockService.On("ImportRentals", mock.Anything, mock.AnythingOfType("[]domain.ImportRow"), tt.dryRun).Return(*tt.report, nil)
+			}
+
+			gin.SetMode(gin.TestMode)
+			router := gin.Default()
+			handler := handler.NewRentalHandler(mockService, nil)
+			router.POST("/rentals/import", handler.ImportRentals)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", tt.url, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.code, w.Code)
+
+			if tt.report != nil {
+				var report domain.ImportReport
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+				assert.Equal(t, *tt.report, report)
+			}
+
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestBatchGetRentals(t *testing.T) {
+	mockResponse := domain.BatchResponse[domain.Rental]{
+		Items:    []domain.Rental{{ID: 3, Name: "Test Rental3"}, {ID: 1, Name: "Test Rental1"}},
+		NotFound: []uint{42},
+	}
+
+	newRouter := func(mockService *mocks.RentalService) *gin.Engine {
+		gin.SetMode(gin.TestMode)
+		router := gin.Default()
+		rentalHandler := handler.NewRentalHandler(mockService, nil)
+		router.POST("/rentals:method", handler.CustomMethods(map[string]gin.HandlerFunc{
+			":batchGet": rentalHandler.BatchGetRentals,
+		}))
+		return router
+	}
+
+	t.Run("/rentals:batchGet", func(t *testing.T) {
+		mockService := &mocks.RentalService{}
+		mockService.On("BatchGetRentals", mock.Anything, []uint{3, 1, 42}).Return(mockResponse, nil)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/rentals:batchGet", strings.NewReader(`{"ids":[3,1,42]}`))
+		newRouter(mockService).ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var actualResponse struct {
+			Items    []domain.Rental `json:"items"`
+			NotFound []uint          `json:"not_found"`
+		}
+		err := json.Unmarshal(w.Body.Bytes(), &actualResponse)
+		assert.NoError(t, err)
+		assert.Equal(t, mockResponse.Items, actualResponse.Items)
+		assert.Equal(t, mockResponse.NotFound, actualResponse.NotFound)
+
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("/rentals:batchGet (invalid input)", func(t *testing.T) {
+		tooMany := make([]string, 101)
+		for i := range tooMany {
+			tooMany[i] = "1"
+		}
+
+		for _, body := range []string{``, `{}`, `{"ids":[]}`, `{"ids":[0]}`, `{"ids":["a"]}`, `{"ids":[` + strings.Join(tooMany, ",") + `]}`} {
+			mockService := &mocks.RentalService{}
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/rentals:batchGet", strings.NewReader(body))
+			newRouter(mockService).ServeHTTP(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code, body)
+
+			mockService.AssertExpectations(t)
+		}
+	})
+
+	t.Run("/rentals:unknown", func(t *testing.T) {
+		mockService := &mocks.RentalService{}
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/rentals:batchDelete", strings.NewReader(`{"ids":[1]}`))
+		newRouter(mockService).ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		mockService.AssertExpectations(t)
+	})
+}
+
+func TestRentalsContextErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{"canceled", fmt.Errorf("%w: canceling statement due to user request", context.Canceled), handler.StatusClientClosedRequest},
+		{"deadline exceeded", context.DeadlineExceeded, http.StatusServiceUnavailable},
+		{"not found", errors.New("record not found"), http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run("/rentals/1 "+tt.name, func(t *testing.T) {
+			mockService := new(mocks.RentalService)
+			mockService.On("GetRentalByID", mock.Anything, uint(1)).Return(domain.Rental{}, tt.err)
+
+			gin.SetMode(gin.TestMode)
+			router := gin.Default()
+			handler := handler.NewRentalHandler(mockService, nil)
+			router.GET("/rentals/:id", handler.GetRentalByID)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/rentals/1", bytes.NewBuffer(nil))
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.code, w.Code)
+
+			mockService.AssertExpectations(t)
+		})
+	}
+
+	t.Run("/rentals passes request context", func(t *testing.T) {
+		type ctxKey struct{}
+		mockService := &mocks.RentalService{}
+		mockService.On("GetRentalsByFilter", mock.MatchedBy(func(ctx context.Context) bool {
+			return ctx.Value(ctxKey{}) == "marker"
+		}), mock.Anything).Return(domain.Response[domain.Rental]{}, context.DeadlineExceeded)
+
+		gin.SetMode(gin.TestMode)
+		router := gin.Default()
+		handler := handler.NewRentalHandler(mockService, nil)
+		router.GET("/rentals", handler.GetRentals)
+
+		w := httptest.NewRecorder()
+		ctx := context.WithValue(context.Background(), ctxKey{}, "marker")
+		req, _ := http.NewRequestWithContext(ctx, "GET", "/rentals", bytes.NewBuffer(nil))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+		mockService.AssertExpectations(t)
+	})
+}
+
 // Add more handler layer tests
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/plar/rentals-api/service"
+)
+
+type RentalImageHandler interface {
+	AddRentalImage(c *gin.Context)
+	DeleteRentalImage(c *gin.Context)
+	ReorderRentalImages(c *gin.Context)
+}
+
+type rentalImageHandler struct {
+	service       service.RentalImageService
+	maxUploadSize int64
+	logger        *zap.Logger
+}
+
+// NewRentalImageHandler accepts uploads of up to maxUploadSize bytes
+func NewRentalImageHandler(service service.RentalImageService, maxUploadSize int64, logger *zap.Logger) RentalImageHandler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &rentalImageHandler{
+		service:       service,
+		maxUploadSize: maxUploadSize,
+		logger:        logger,
+	}
+}
+
+type RentalImageRequest struct {
+	ID      uint `uri:"id"`
+	ImageID uint `uri:"image_id"`
+}
+
+// RentalImagesOrderRequest lists the IDs of all the images of a rental in their new order
+type RentalImagesOrderRequest struct {
+	IDs []uint `json:"ids" binding:"required,min=1,dive,gt=0"`
+}
+
+// AddRentalImage stores the image of the multipart field "image" after the other images of the rental and
+// returns it with the URLs of its variants, 413 when the request is larger than the upload limit
+func (h *rentalImageHandler) AddRentalImage(c *gin.Context) {
+	var req RentalByIDRequest
+	if err := c.ShouldBindUri(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rental ID"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxUploadSize)
+	header, err := c.FormFile("image")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("the upload is larger than %d bytes", h.maxUploadSize)})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the image is missing, send it in the multipart field image"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	image, err := h.service.AddRentalImage(c.Request.Context(), req.ID, file)
+	if err != nil {
+		c.JSON(errorResponse(err, http.StatusInternalServerError, err.Error()))
+		return
+	}
+	c.JSON(http.StatusCreated, image)
+}
+
+// DeleteRentalImage removes an image of a rental, the next images move up
+func (h *rentalImageHandler) DeleteRentalImage(c *gin.Context) {
+	var req RentalImageRequest
+	if err := c.ShouldBindUri(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rental or image ID"})
+		return
+	}
+
+	if err := h.service.DeleteRentalImage(c.Request.Context(), req.ID, req.ImageID); err != nil {
+		c.JSON(errorResponse(err, http.StatusInternalServerError, err.Error()))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ReorderRentalImages puts the images of a rental in the order of the IDs of the body and returns them,
+// the first one becomes the primary image
+func (h *rentalImageHandler) ReorderRentalImages(c *gin.Context) {
+	var uri RentalByIDRequest
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rental ID"})
+		return
+	}
+	var req RentalImagesOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reordered, err := h.service.ReorderRentalImages(c.Request.Context(), uri.ID, req.IDs)
+	if err != nil {
+		c.JSON(errorResponse(err, http.StatusInternalServerError, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": reordered})
+}
@@ -0,0 +1,149 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/plar/rentals-api/domain"
+	"github.com/plar/rentals-api/handler"
+	"github.com/plar/rentals-api/service/mocks"
+)
+
+func newImageRouter(mockService *mocks.RentalImageService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	h := handler.NewRentalImageHandler(mockService, 1024, nil)
+	router.POST("/rentals/:id/images", h.AddRentalImage)
+	router.PUT("/rentals/:id/images/order", h.ReorderRentalImages)
+	router.DELETE("/rentals/:id/images/:image_id", h.DeleteRentalImage)
+	return router
+}
+
+// multipartBody returns a form with content in the file field
+func multipartBody(t *testing.T, field string, content []byte) (*bytes.Buffer, string) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile(field, "van.png")
+	require.NoError(t, err)
+	_, err = part.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, form.Close())
+	return &body, form.FormDataContentType()
+}
+
+func TestAddRentalImage(t *testing.T) {
+	mockService := new(mocks.RentalImageService)
+	uploaded := mock.MatchedBy(func(r io.Reader) bool {
+		data, _ := io.ReadAll(r)
+		return string(data) == "image data"
+	})
+	mockService.On("AddRentalImage", mock.Anything, uint(1), uploaded).
+		Return(domain.RentalImage{ID: 5, RentalID: 1, Position: 2, URL: "/images/rentals/1/ab/original.png", Key: "rentals/1/ab/original.png"}, nil).Once()
+	mockService.On("AddRentalImage", mock.Anything, uint(1), mock.Anything).Return(domain.RentalImage{}, fmt.Errorf("%w: unknown format", domain.ErrInvalidImage)).Once()
+	mockService.On("AddRentalImage", mock.Anything, uint(2), mock.Anything).Return(domain.RentalImage{}, domain.ErrRentalNotFound)
+
+	tests := []struct {
+		name  string
+		path  string
+		field string
+		data  []byte
+		code  int
+	}{
+		{"added", "/rentals/1/images", "image", []byte("image data"), http.StatusCreated},
+		{"invalid image", "/rentals/1/images", "image", []byte("text"), http.StatusUnprocessableEntity},
+		{"rental not found", "/rentals/2/images", "image", []byte("image data"), http.StatusNotFound},
+		{"missing field", "/rentals/1/images", "file", []byte("image data"), http.StatusBadRequest},
+		{"too large", "/rentals/1/images", "image", bytes.Repeat([]byte("x"), 2048), http.StatusRequestEntityTooLarge},
+		{"invalid rental id", "/rentals/x/images", "image", []byte("image data"), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, contentType := multipartBody(t, tt.field, tt.data)
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", tt.path, body)
+			req.Header.Set("Content-Type", contentType)
+			newImageRouter(mockService).ServeHTTP(w, req)
+			assert.Equal(t, tt.code, w.Code, w.Body.String())
+		})
+	}
+
+	w := httptest.NewRecorder()
+	body, contentType := multipartBody(t, "image", []byte("image data"))
+	mockService.On("AddRentalImage", mock.Anything, uint(3), mock.Anything).Return(domain.RentalImage{ID: 6, Key: "secret"}, nil)
+	req, _ := http.NewRequest("POST", "/rentals/3/images", body)
+	req.Header.Set("Content-Type", contentType)
+	newImageRouter(mockService).ServeHTTP(w, req)
+	assert.NotContains(t, w.Body.String(), "secret", "the storage keys are not exposed")
+	mockService.AssertExpectations(t)
+}
+
+func TestDeleteRentalImage(t *testing.T) {
+	mockService := new(mocks.RentalImageService)
+	mockService.On("DeleteRentalImage", mock.Anything, uint(1), uint(5)).Return(nil)
+	mockService.On("DeleteRentalImage", mock.Anything, uint(1), uint(6)).Return(domain.ErrImageNotFound)
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/rentals/1/images/5", http.StatusNoContent},
+		{"/rentals/1/images/6", http.StatusNotFound},
+		{"/rentals/1/images/x", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("DELETE", tt.path, nil)
+			newImageRouter(mockService).ServeHTTP(w, req)
+			assert.Equal(t, tt.code, w.Code)
+		})
+	}
+	mockService.AssertExpectations(t)
+}
+
+func TestReorderRentalImages(t *testing.T) {
+	mockService := new(mocks.RentalImageService)
+	mockService.On("ReorderRentalImages", mock.Anything, uint(1), []uint{6, 5}).
+		Return([]domain.RentalImage{{ID: 6, Position: 1}, {ID: 5, Position: 2}}, nil)
+	mockService.On("ReorderRentalImages", mock.Anything, uint(1), []uint{6}).Return([]domain.RentalImage(nil), domain.ErrImageOrder)
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"ids":[6,5]}`, http.StatusOK},
+		{`{"ids":[6]}`, http.StatusUnprocessableEntity},
+		{`{"ids":[]}`, http.StatusBadRequest},
+		{`{"ids":[0]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("PUT", "/rentals/1/images/order", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			newImageRouter(mockService).ServeHTTP(w, req)
+			assert.Equal(t, tt.code, w.Code)
+
+			if tt.code == http.StatusOK {
+				var resp struct {
+					Items []domain.RentalImage `json:"items"`
+				}
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, []uint{6, 5}, []uint{resp.Items[0].ID, resp.Items[1].ID})
+			}
+		})
+	}
+	mockService.AssertExpectations(t)
+}
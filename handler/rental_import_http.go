@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/plar/rentals-api/codec"
+)
+
+// maxImportSize is the largest accepted import body
+const maxImportSize = 32 << 20
+
+type RentalsImportRequest struct {
+	DryRun bool    `form:"dry_run"`
+	Format *string `form:"format" binding:"omitempty,oneof=csv ndjson"`
+}
+
+// importFormat detects the body format, explicit format= parameter wins over the Content-Type header
+func importFormat(c *gin.Context, req RentalsImportRequest) (codec.Format, error) {
+	if req.Format != nil {
+		return codec.ParseFormat(*req.Format)
+	}
+
+	switch c.ContentType() {
+	case codec.MIMECSV:
+		return codec.FormatCSV, nil
+	case codec.MIMENDJSON:
+		return codec.FormatNDJSON, nil
+	}
+	return "", fmt.Errorf("unsupported content type %q", c.ContentType())
+}
+
+// ImportRentals upserts rentals from a CSV or NDJSON body. With dry_run=true rows are only validated.
+// The response is an import report, 422 is returned when any row is invalid and nothing was written.
+func (h *rentalHandler) ImportRentals(c *gin.Context) {
+	var req RentalsImportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	format, err := importFormat(c, req)
+	if err != nil {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+	rows, err := codec.DecodeRentals(format, body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := h.service.ImportRentals(c.Request.Context(), rows, req.DryRun)
+	if err != nil {
+		c.JSON(errorResponse(err, http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	if report.HasErrors() {
+		c.JSON(http.StatusUnprocessableEntity, report)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
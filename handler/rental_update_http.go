@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/plar/rentals-api/domain"
+)
+
+// rentalETag is the strong entity tag of a rental version
+func rentalETag(version uint) string {
+	return `"` + strconv.FormatUint(uint64(version), 10) + `"`
+}
+
+// parseETag returns the version of a rental entity tag, weak tags do not name a version
+func parseETag(tag string) (uint, bool) {
+	tag = strings.TrimSpace(tag)
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+	version, err := strconv.ParseUint(tag[1:len(tag)-1], 10, 0)
+	if err != nil || version == 0 {
+		return 0, false
+	}
+	return uint(version), true
+}
+
+// matchesETag reports whether the If-None-Match header lists etag, weak tags compare as strong ones
+func matchesETag(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateRental overwrites a rental with the JSON body. If-Match must hold the ETag of the rental the update
+// is based on: 428 is returned when it is missing and 412 when the rental changed since.
+func (h *rentalHandler) UpdateRental(c *gin.Context) {
+	var uri RentalByIDRequest
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rental ID"})
+		return
+	}
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header is required, use the ETag of the rental"})
+		return
+	}
+	version, ok := parseETag(ifMatch)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid If-Match header, use the ETag of the rental"})
+		return
+	}
+
+	var rental domain.Rental
+	if err := c.ShouldBindJSON(&rental); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// the path and the precondition name the rental, not the body
+	rental.ID, rental.Version = uri.ID, version
+
+	updated, err := h.service.UpdateRental(c.Request.Context(), rental)
+	var verrs domain.ValidationErrors
+	if errors.As(err, &verrs) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid rental", "fields": verrs})
+		return
+	} else if err != nil {
+		c.JSON(errorResponse(err, http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	c.Header("ETag", rentalETag(updated.Version))
+	c.JSON(http.StatusOK, updated)
+}
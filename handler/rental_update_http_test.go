@@ -0,0 +1,87 @@
+package handler_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/plar/rentals-api/domain"
+	"github.com/plar/rentals-api/handler"
+	"github.com/plar/rentals-api/service/mocks"
+)
+
+func newUpdateRouter(mockService *mocks.RentalService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	h := handler.NewRentalHandler(mockService, nil)
+	router.GET("/rentals/:id", h.GetRentalByID)
+	router.PUT("/rentals/:id", h.UpdateRental)
+	return router
+}
+
+func TestGetRentalByIDETag(t *testing.T) {
+	mockService := new(mocks.RentalService)
+	mockService.On("GetRentalByID", mock.Anything, uint(1)).Return(domain.Rental{ID: 1, Version: 3}, nil)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/rentals/1", nil)
+	newUpdateRouter(mockService).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/rentals/1", nil)
+	req.Header.Set("If-None-Match", `"2", "3"`)
+	newUpdateRouter(mockService).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+}
+
+func TestUpdateRental(t *testing.T) {
+	body := `{"name": "Van", "type": "camper-van", "price": {"day": 100}, "user": {"id": 7}, "version": 9}`
+	mockService := new(mocks.RentalService)
+	// the version comes from If-Match, not from the body
+	mockService.On("UpdateRental", mock.Anything, mock.MatchedBy(func(r domain.Rental) bool { return r.ID == 1 && r.Version == 3 })).
+		Return(domain.Rental{ID: 1, Name: "Van", Version: 4}, nil)
+	mockService.On("UpdateRental", mock.Anything, mock.MatchedBy(func(r domain.Rental) bool { return r.ID == 1 && r.Version == 2 })).
+		Return(domain.Rental{}, &domain.ConflictError{ID: 1, Version: 2})
+	mockService.On("UpdateRental", mock.Anything, mock.MatchedBy(func(r domain.Rental) bool { return r.ID == 2 })).
+		Return(domain.Rental{}, domain.ErrRentalNotFound)
+	mockService.On("UpdateRental", mock.Anything, mock.MatchedBy(func(r domain.Rental) bool { return r.ID == 3 })).
+		Return(domain.Rental{}, domain.ValidationErrors{{Field: "name", Message: "is required"}})
+
+	tests := []struct {
+		name    string
+		path    string
+		ifMatch string
+		body    string
+		code    int
+		etag    string
+	}{
+		{"updated", "/rentals/1", `"3"`, body, http.StatusOK, `"4"`},
+		{"stale version", "/rentals/1", `"2"`, body, http.StatusPreconditionFailed, ""},
+		{"missing If-Match", "/rentals/1", "", body, http.StatusPreconditionRequired, ""},
+		{"weak If-Match", "/rentals/1", `W/"3"`, body, http.StatusBadRequest, ""},
+		{"invalid body", "/rentals/1", `"3"`, `{"name": 1}`, http.StatusBadRequest, ""},
+		{"not found", "/rentals/2", `"3"`, body, http.StatusNotFound, ""},
+		{"invalid rental", "/rentals/3", `"3"`, body, http.StatusUnprocessableEntity, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("PUT", tt.path, bytes.NewBufferString(tt.body))
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			newUpdateRouter(mockService).ServeHTTP(w, req)
+			assert.Equal(t, tt.code, w.Code)
+			assert.Equal(t, tt.etag, w.Header().Get("ETag"))
+		})
+	}
+	mockService.AssertExpectations(t)
+}
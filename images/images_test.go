@@ -0,0 +1,122 @@
+package images_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/image/webp"
+
+	"github.com/plar/rentals-api/images"
+)
+
+func TestLocal(t *testing.T) {
+	dir := t.TempDir()
+	storage := images.NewLocal(dir, "/images/")
+	ctx := context.Background()
+
+	require.NoError(t, storage.Put(ctx, "rentals/1/abc/thumb.jpg", strings.NewReader("first")))
+	require.NoError(t, storage.Put(ctx, "rentals/1/abc/thumb.jpg", strings.NewReader("second")))
+	data, err := os.ReadFile(filepath.Join(dir, "rentals", "1", "abc", "thumb.jpg"))
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(data))
+	assert.Equal(t, "/images/rentals/1/abc/thumb.jpg", storage.URL("rentals/1/abc/thumb.jpg"))
+
+	for _, key := range []string{"", "../secret", "/etc/passwd", "rentals/../../secret", "rentals//1"} {
+		assert.Error(t, storage.Put(ctx, key, strings.NewReader("x")), key)
+	}
+
+	// the directory of an image goes away with its last file
+	require.NoError(t, storage.Delete(ctx, "rentals/1/abc/thumb.jpg"))
+	require.NoError(t, storage.Delete(ctx, "rentals/1/abc/thumb.jpg"))
+	_, err = os.Stat(filepath.Join(dir, "rentals", "1", "abc"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Stat(dir)
+	assert.NoError(t, err)
+
+	// so do the directories of a rental under its prefix
+	require.NoError(t, storage.Put(ctx, "rentals/2/abc/thumb.jpg", strings.NewReader("x")))
+	require.NoError(t, storage.Put(ctx, "rentals/2/def/thumb.jpg", strings.NewReader("x")))
+	require.NoError(t, storage.Put(ctx, "rentals/20/abc/thumb.jpg", strings.NewReader("x")))
+	require.NoError(t, storage.DeleteAll(ctx, "rentals/2/"))
+	require.NoError(t, storage.DeleteAll(ctx, "rentals/2/"))
+	_, err = os.Stat(filepath.Join(dir, "rentals", "2"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Stat(filepath.Join(dir, "rentals", "20", "abc", "thumb.jpg"))
+	assert.NoError(t, err)
+	for _, prefix := range []string{"rentals/2", "../", "/"} {
+		assert.Error(t, storage.DeleteAll(ctx, prefix), prefix)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 8, 4))))
+	img, format, err := images.Decode(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, "png", format)
+	assert.Equal(t, image.Pt(8, 4), img.Bounds().Size())
+
+	_, _, err = images.Decode([]byte("not an image"))
+	assert.ErrorIs(t, err, images.ErrUnsupported)
+
+	// the size is checked before the pixels are decoded
+	buf.Reset()
+	require.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, 8000, 6000))))
+	_, _, err = images.Decode(buf.Bytes())
+	assert.ErrorIs(t, err, images.ErrUnsupported)
+
+	// so are the variants of a narrow image, which WebP cannot encode
+	for _, size := range []image.Point{{X: 1, Y: 20_000}, {X: 200, Y: 20_000}} {
+		buf.Reset()
+		require.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, size.X, size.Y))))
+		_, _, err = images.Decode(buf.Bytes())
+		assert.ErrorIs(t, err, images.ErrUnsupported, size)
+	}
+
+	// the tallest image whose variants fit
+	buf.Reset()
+	require.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, 10, 16384))))
+	img, _, err = images.Decode(buf.Bytes())
+	require.NoError(t, err)
+	_, err = images.Variants(img)
+	assert.NoError(t, err)
+}
+
+func TestVariants(t *testing.T) {
+	// a transparent image, narrower than the medium size
+	img := image.NewNRGBA(image.Rect(0, 0, 400, 300))
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 400; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 100, A: uint8(255 - y/2)})
+		}
+	}
+
+	variants, err := images.Variants(img)
+	require.NoError(t, err)
+	require.Len(t, variants, 2*len(images.Sizes))
+	sizes := map[string]image.Point{"thumb": {160, 120}, "small": {320, 240}, "medium": {400, 300}}
+	for _, variant := range variants {
+		var decoded image.Image
+		switch variant.Format {
+		case images.FormatJPEG:
+			decoded, err = jpeg.Decode(bytes.NewReader(variant.Data))
+		case images.FormatWebP:
+			decoded, err = webp.Decode(bytes.NewReader(variant.Data))
+		}
+		require.NoError(t, err, variant.Size+" "+variant.Format)
+		assert.Equal(t, sizes[variant.Size], decoded.Bounds().Size(), variant.Size+" "+variant.Format)
+		assert.Equal(t, sizes[variant.Size], image.Pt(variant.Width, variant.Height))
+	}
+	assert.Equal(t, "jpg", images.Extension(images.FormatJPEG))
+	assert.Equal(t, "webp", images.Extension(images.FormatWebP))
+}
@@ -0,0 +1,108 @@
+// Package images stores the uploaded images of the rentals and their resized variants.
+package images
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Storage keeps the files of the images under slash separated keys
+type Storage interface {
+	// Put stores the content under key, replacing a previous one
+	Put(ctx context.Context, key string, content io.Reader) error
+	// Delete removes the content of key, a missing key is not an error
+	Delete(ctx context.Context, key string) error
+	// DeleteAll removes the content of every key under the prefix, which ends with a slash
+	DeleteAll(ctx context.Context, prefix string) error
+	// URL is the address the content of key is served at
+	URL(key string) string
+}
+
+// Local stores the files in a directory, which is served at baseURL
+type Local struct {
+	dir     string
+	baseURL string
+}
+
+var _ Storage = (*Local)(nil)
+
+func NewLocal(dir, baseURL string) *Local {
+	return &Local{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// path returns the file of key, the keys cannot leave the directory
+func (s *Local) path(key string) (string, error) {
+	if key == "" || path.IsAbs(key) || path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") {
+		return "", fmt.Errorf("invalid image key %q", key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes a temporary file renamed to the file of key, a reader never sees a partial file
+func (s *Local) Put(ctx context.Context, key string, content io.Reader) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err = io.Copy(f, content); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(f.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// Delete removes the file of key and its directory once it is empty
+func (s *Local) Delete(_ context.Context, key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	// fails while other files are left
+	if dir := filepath.Dir(name); dir != filepath.Clean(s.dir) {
+		_ = os.Remove(dir)
+	}
+	return nil
+}
+
+// DeleteAll removes the directory of prefix
+func (s *Local) DeleteAll(_ context.Context, prefix string) error {
+	if !strings.HasSuffix(prefix, "/") {
+		return fmt.Errorf("invalid image prefix %q", prefix)
+	}
+	name, err := s.path(strings.TrimSuffix(prefix, "/"))
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(name)
+}
+
+func (s *Local) URL(key string) string {
+	return s.baseURL + "/" + key
+}
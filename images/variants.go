@@ -0,0 +1,131 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+
+	// decoders of the accepted uploads
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	FormatJPEG = "jpeg"
+	FormatWebP = "webp"
+
+	// MaxPixels bounds the size of the decoded uploads, a small file can hold a huge image
+	MaxPixels = 40_000_000
+	// jpegQuality is the quality of the JPEG variants
+	jpegQuality = 85
+)
+
+// ErrUnsupported is returned for uploads which are not images in a known format or are too large
+var ErrUnsupported = errors.New("unsupported image")
+
+// Size is a width the variants are scaled down to, keeping the aspect ratio of the image
+type Size struct {
+	Name  string
+	Width int
+}
+
+// Sizes are the variants generated for every image, in JPEG and WebP
+var Sizes = []Size{
+	{Name: "thumb", Width: 160},
+	{Name: "small", Width: 320},
+	{Name: "medium", Width: 640},
+}
+
+// Variant is an encoded image scaled down to one of the sizes
+type Variant struct {
+	Size   string
+	Format string
+	Width  int
+	Height int
+	Data   []byte
+}
+
+// Decode decodes a GIF, JPEG, PNG or WebP image of at most MaxPixels and returns its format
+func Decode(data []byte) (image.Image, string, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, "", fmt.Errorf("%w: %dx%d pixels, more than %d", ErrUnsupported, cfg.Width, cfg.Height, MaxPixels)
+	}
+	// a narrow image keeps its height in the variants, which WebP bounds
+	for _, size := range Sizes {
+		if width, height := scaledSize(cfg.Width, cfg.Height, size.Width); height > maxWebPSize {
+			return nil, "", fmt.Errorf("%w: %dx%d pixels, its %s variant is %dx%d, more than %d high", ErrUnsupported,
+				cfg.Width, cfg.Height, size.Name, width, height, maxWebPSize)
+		}
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	return img, format, nil
+}
+
+// Extension is the file extension of a format
+func Extension(format string) string {
+	if format == FormatJPEG {
+		return "jpg"
+	}
+	return format
+}
+
+// Variants scales img down to every size and encodes it in every format, an image narrower than a size
+// is not enlarged
+func Variants(img image.Image) ([]Variant, error) {
+	variants := make([]Variant, 0, 2*len(Sizes))
+	for _, size := range Sizes {
+		scaled := Resize(img, size.Width)
+
+		// JPEG has no transparency, the transparent parts become white
+		flat := image.NewRGBA(scaled.Bounds())
+		draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.Draw(flat, flat.Bounds(), scaled, image.Point{}, draw.Over)
+		var jpg bytes.Buffer
+		if err := jpeg.Encode(&jpg, flat, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+
+		var webp bytes.Buffer
+		if err := EncodeWebP(&webp, scaled); err != nil {
+			return nil, err
+		}
+
+		b := scaled.Bounds()
+		variants = append(variants,
+			Variant{Size: size.Name, Format: FormatJPEG, Width: b.Dx(), Height: b.Dy(), Data: jpg.Bytes()},
+			Variant{Size: size.Name, Format: FormatWebP, Width: b.Dx(), Height: b.Dy(), Data: webp.Bytes()},
+		)
+	}
+	return variants, nil
+}
+
+// Resize scales img to width, or keeps its width when it is narrower
+func Resize(img image.Image, width int) *image.NRGBA {
+	b := img.Bounds()
+	width, height := scaledSize(b.Dx(), b.Dy(), width)
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// scaledSize is the size of a width x height image scaled down to maxWidth, keeping the aspect ratio
+func scaledSize(width, height, maxWidth int) (int, int) {
+	if maxWidth > width {
+		maxWidth = width
+	}
+	return maxWidth, int(math.Max(1, math.Round(float64(height)*float64(maxWidth)/float64(width))))
+}
@@ -0,0 +1,518 @@
+package images
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"sort"
+)
+
+// The encoder writes lossless WebP (VP8L, RFC 9649) without cgo: the subtract green and predictor
+// transforms followed by a single group of prefix codes, without color cache and backward references.
+// Photos come out larger than their lossy JPEG variants, which is acceptable for thumbnails.
+
+const (
+	// maxWebPSize is the largest width and height VP8L can hold
+	maxWebPSize = 1 << 14
+	// predictorBits is the log2 of the size of the blocks sharing a predictor mode
+	predictorBits = 4
+
+	transformPredictor     = 0
+	transformSubtractGreen = 2
+
+	// the alphabets of the green (with the unused length prefixes), red, blue and alpha prefix codes
+	greenAlphabet   = 256 + 24
+	literalAlphabet = 256
+	// maxCodeLength and maxCodeLengthCodeLength bound the lengths of the prefix codes
+	maxCodeLength           = 15
+	maxCodeLengthCodeLength = 7
+)
+
+// codeLengthCodeOrder is the order the lengths of the code length code are written in
+var codeLengthCodeOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// EncodeWebP writes img as a lossless WebP
+func EncodeWebP(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width < 1 || height < 1 || width > maxWebPSize || height > maxWebPSize {
+		return fmt.Errorf("webp: cannot encode an image of %dx%d pixels", width, height)
+	}
+	argb, opaque := toARGB(img)
+
+	var bw bitWriter
+	bw.write(0x2f, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if opaque {
+		bw.write(0, 1)
+	} else {
+		bw.write(1, 1)
+	}
+	bw.write(0, 3)
+
+	// the decoder undoes the transforms in reverse order: the predictor first, then the subtract green
+	bw.write(1, 1)
+	bw.write(transformSubtractGreen, 2)
+	subtractGreen(argb)
+
+	bw.write(1, 1)
+	bw.write(transformPredictor, 2)
+	bw.write(predictorBits-2, 3)
+	modes, residuals := predict(argb, width, height)
+	tiles := func(size int) int { return (size + 1<<predictorBits - 1) >> predictorBits }
+	writeEntropyImage(&bw, modes, tiles(width)*tiles(height), false)
+	bw.write(0, 1)
+
+	writeEntropyImage(&bw, residuals, width*height, true)
+
+	data := bw.bytes()
+	chunk := len(data) + len(data)&1
+	header := make([]byte, 20, 20+chunk)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(12+chunk))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(data)))
+	out := append(header, data...)
+	if len(data)&1 == 1 {
+		out = append(out, 0)
+	}
+	_, err := w.Write(out)
+	return err
+}
+
+// toARGB returns the non-premultiplied pixels of img, row by row, and whether they are all opaque
+func toARGB(img image.Image) ([]uint32, bool) {
+	b := img.Bounds()
+	argb := make([]uint32, 0, b.Dx()*b.Dy())
+	opaque := true
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			var c color.NRGBA
+			if nrgba, ok := img.(*image.NRGBA); ok {
+				c = nrgba.NRGBAAt(x, y)
+			} else {
+				c = color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			}
+			opaque = opaque && c.A == 0xff
+			argb = append(argb, uint32(c.A)<<24|uint32(c.R)<<16|uint32(c.G)<<8|uint32(c.B))
+		}
+	}
+	return argb, opaque
+}
+
+func subtractGreen(argb []uint32) {
+	for i, p := range argb {
+		green := (p >> 8) & 0xff
+		red := ((p >> 16) - green) & 0xff
+		blue := (p - green) & 0xff
+		argb[i] = p&0xff00ff00 | red<<16 | blue
+	}
+}
+
+// predict chooses for every block the predictor mode with the smallest residuals, it returns the image of
+// the modes and the residuals of the pixels
+func predict(argb []uint32, width, height int) ([]uint32, []uint32) {
+	size := 1 << predictorBits
+	tilesX := (width + size - 1) / size
+	tilesY := (height + size - 1) / size
+	modes := make([]uint32, tilesX*tilesY)
+	residuals := make([]uint32, len(argb))
+
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			best, bestCost := 0, -1
+			for mode := 0; mode < 14; mode++ {
+				cost := 0
+				for y := ty * size; y < (ty+1)*size && y < height; y++ {
+					for x := tx * size; x < (tx+1)*size && x < width; x++ {
+						cost += residualCost(argb[y*width+x], prediction(argb, width, x, y, mode))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+			modes[ty*tilesX+tx] = 0xff000000 | uint32(best)<<8
+			for y := ty * size; y < (ty+1)*size && y < height; y++ {
+				for x := tx * size; x < (tx+1)*size && x < width; x++ {
+					residuals[y*width+x] = subPixels(argb[y*width+x], prediction(argb, width, x, y, best))
+				}
+			}
+		}
+	}
+	return modes, residuals
+}
+
+// prediction is the value the decoder predicts for the pixel at x, y with mode, the first row is predicted
+// from the left pixel and the first column from the top one whatever the mode
+func prediction(argb []uint32, width, x, y, mode int) uint32 {
+	i := y*width + x
+	switch {
+	case x == 0 && y == 0:
+		return 0xff000000
+	case y == 0:
+		return argb[i-1]
+	case x == 0:
+		return argb[i-width]
+	}
+	// the top right pixel of the last column is the first pixel of the current row
+	l, t, tr, tl := argb[i-1], argb[i-width], argb[i-width+1], argb[i-width-1]
+	switch mode {
+	case 0:
+		return 0xff000000
+	case 1:
+		return l
+	case 2:
+		return t
+	case 3:
+		return tr
+	case 4:
+		return tl
+	case 5:
+		return average2(average2(l, tr), t)
+	case 6:
+		return average2(l, tl)
+	case 7:
+		return average2(l, t)
+	case 8:
+		return average2(tl, t)
+	case 9:
+		return average2(t, tr)
+	case 10:
+		return average2(average2(l, tl), average2(t, tr))
+	case 11:
+		return selectPixel(l, t, tl)
+	case 12:
+		return clampAddSubtractFull(l, t, tl)
+	default:
+		return clampAddSubtractHalf(average2(l, t), tl)
+	}
+}
+
+func channel(p uint32, shift uint) int {
+	return int(p>>shift) & 0xff
+}
+
+func clampByte(v int) uint32 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint32(v)
+}
+
+func average2(a, b uint32) uint32 {
+	return (((a ^ b) & 0xfefefefe) >> 1) + (a & b)
+}
+
+func selectPixel(l, t, tl uint32) uint32 {
+	distL, distT := 0, 0
+	for shift := uint(0); shift < 32; shift += 8 {
+		distL += abs(channel(t, shift) - channel(tl, shift))
+		distT += abs(channel(l, shift) - channel(tl, shift))
+	}
+	if distL < distT {
+		return l
+	}
+	return t
+}
+
+func clampAddSubtractFull(a, b, c uint32) uint32 {
+	var p uint32
+	for shift := uint(0); shift < 32; shift += 8 {
+		p |= clampByte(channel(a, shift)+channel(b, shift)-channel(c, shift)) << shift
+	}
+	return p
+}
+
+func clampAddSubtractHalf(a, b uint32) uint32 {
+	var p uint32
+	for shift := uint(0); shift < 32; shift += 8 {
+		p |= clampByte(channel(a, shift)+(channel(a, shift)-channel(b, shift))/2) << shift
+	}
+	return p
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// subPixels subtracts the channels of b from the ones of a modulo 256
+func subPixels(a, b uint32) uint32 {
+	var p uint32
+	for shift := uint(0); shift < 32; shift += 8 {
+		p |= uint32(channel(a, shift)-channel(b, shift)) & 0xff << shift
+	}
+	return p
+}
+
+// residualCost estimates the bits of a residual, the small positive and negative values are the cheap ones
+func residualCost(pixel, predicted uint32) int {
+	cost := 0
+	r := subPixels(pixel, predicted)
+	for shift := uint(0); shift < 32; shift += 8 {
+		v := channel(r, shift)
+		if v > 128 {
+			v = 256 - v
+		}
+		cost += v
+	}
+	return cost
+}
+
+// writeEntropyImage writes the pixels with a prefix code per channel, the top level image declares that it
+// has a single group of prefix codes
+func writeEntropyImage(bw *bitWriter, argb []uint32, n int, topLevel bool) {
+	bw.write(0, 1)
+	if topLevel {
+		bw.write(0, 1)
+	}
+
+	green := make([]uint32, greenAlphabet)
+	red := make([]uint32, literalAlphabet)
+	blue := make([]uint32, literalAlphabet)
+	alpha := make([]uint32, literalAlphabet)
+	for _, p := range argb[:n] {
+		green[channel(p, 8)]++
+		red[channel(p, 16)]++
+		blue[channel(p, 0)]++
+		alpha[channel(p, 24)]++
+	}
+	codes := [4]prefixCode{newPrefixCode(green), newPrefixCode(red), newPrefixCode(blue), newPrefixCode(alpha)}
+	for _, code := range codes {
+		code.writeTo(bw)
+	}
+	// no backward references, the distance code holds a single symbol
+	newPrefixCode([]uint32{1}).writeTo(bw)
+
+	for _, p := range argb[:n] {
+		codes[0].writeSymbol(bw, channel(p, 8))
+		codes[1].writeSymbol(bw, channel(p, 16))
+		codes[2].writeSymbol(bw, channel(p, 0))
+		codes[3].writeSymbol(bw, channel(p, 24))
+	}
+}
+
+// prefixCode is a canonical Huffman code, the codes are stored bit-reversed as the stream is read from the
+// least significant bit
+type prefixCode struct {
+	lengths []uint32
+	codes   []uint32
+	// symbols holds the used symbols when there are at most two of them, the code is written in its
+	// simple form then
+	symbols []int
+}
+
+func newPrefixCode(histogram []uint32) prefixCode {
+	var used []int
+	for symbol, count := range histogram {
+		if count > 0 {
+			used = append(used, symbol)
+		}
+	}
+	code := prefixCode{lengths: make([]uint32, len(histogram))}
+	switch {
+	case len(used) == 0:
+		code.symbols = []int{0}
+	case len(used) <= 2 && used[len(used)-1] < literalAlphabet:
+		code.symbols = used
+		if len(used) == 2 {
+			code.lengths[used[0]], code.lengths[used[1]] = 1, 1
+		}
+	default:
+		code.lengths = codeLengths(histogram, maxCodeLength)
+	}
+	code.codes = canonicalCodes(code.lengths)
+	return code
+}
+
+func (c prefixCode) writeTo(bw *bitWriter) {
+	if c.symbols != nil {
+		bw.write(1, 1)
+		bw.write(uint32(len(c.symbols)-1), 1)
+		if c.symbols[0] <= 1 {
+			bw.write(0, 1)
+			bw.write(uint32(c.symbols[0]), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(c.symbols[0]), 8)
+		}
+		if len(c.symbols) == 2 {
+			bw.write(uint32(c.symbols[1]), 8)
+		}
+		return
+	}
+
+	// the lengths are written with the code length code, without the run length symbols
+	histogram := make([]uint32, len(codeLengthCodeOrder))
+	for _, length := range c.lengths {
+		histogram[length]++
+	}
+	lengthCode := prefixCode{lengths: codeLengths(histogram, maxCodeLengthCodeLength)}
+	lengthCode.codes = canonicalCodes(lengthCode.lengths)
+
+	n := len(codeLengthCodeOrder)
+	for n > 4 && lengthCode.lengths[codeLengthCodeOrder[n-1]] == 0 {
+		n--
+	}
+	bw.write(0, 1)
+	bw.write(uint32(n-4), 4)
+	for _, symbol := range codeLengthCodeOrder[:n] {
+		bw.write(lengthCode.lengths[symbol], 3)
+	}
+	bw.write(0, 1)
+	for _, length := range c.lengths {
+		lengthCode.writeSymbol(bw, int(length))
+	}
+}
+
+func (c prefixCode) writeSymbol(bw *bitWriter, symbol int) {
+	bw.write(c.codes[symbol], uint(c.lengths[symbol]))
+}
+
+// codeLengths returns the lengths of a Huffman code of the histogram, at most limit long. Every tree has
+// two leaves at least, a single used symbol is paired with an unused one. When the tree is too deep
+// the small counts are raised until it fits.
+func codeLengths(histogram []uint32, limit uint32) []uint32 {
+	counts := append([]uint32(nil), histogram...)
+	used := 0
+	for _, count := range counts {
+		if count > 0 {
+			used++
+		}
+	}
+	if used < 2 {
+		for symbol := range counts {
+			if counts[symbol] == 0 {
+				counts[symbol] = 1
+				if used++; used == 2 {
+					break
+				}
+			}
+		}
+	}
+
+	for minCount := uint32(1); ; minCount *= 2 {
+		lengths := huffmanLengths(counts, minCount)
+		longest := uint32(0)
+		for _, length := range lengths {
+			if length > longest {
+				longest = length
+			}
+		}
+		if longest <= limit {
+			return lengths
+		}
+	}
+}
+
+// huffmanLengths builds a Huffman tree of the used symbols, whose counts are raised to minCount, and
+// returns the depths of the leaves
+func huffmanLengths(counts []uint32, minCount uint32) []uint32 {
+	type node struct {
+		weight      uint64
+		symbol      int
+		left, right int
+	}
+	var nodes []node
+	for symbol, count := range counts {
+		if count > 0 {
+			if count < minCount {
+				count = minCount
+			}
+			nodes = append(nodes, node{weight: uint64(count), symbol: symbol, left: -1, right: -1})
+		}
+	}
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].weight < nodes[j].weight })
+
+	// two queues: the sorted leaves and the internal nodes, which are created in increasing weights
+	nLeaves := len(nodes)
+	leaf, internal := 0, nLeaves
+	pop := func() int {
+		if leaf < nLeaves && (internal == len(nodes) || nodes[leaf].weight <= nodes[internal].weight) {
+			leaf++
+			return leaf - 1
+		}
+		internal++
+		return internal - 1
+	}
+	for remaining := nLeaves; remaining > 1; remaining-- {
+		a, b := pop(), pop()
+		nodes = append(nodes, node{weight: nodes[a].weight + nodes[b].weight, symbol: -1, left: a, right: b})
+	}
+
+	lengths := make([]uint32, len(counts))
+	var walk func(i int, depth uint32)
+	walk = func(i int, depth uint32) {
+		if nodes[i].left < 0 {
+			lengths[nodes[i].symbol] = depth
+			return
+		}
+		walk(nodes[i].left, depth+1)
+		walk(nodes[i].right, depth+1)
+	}
+	walk(len(nodes)-1, 0)
+	return lengths
+}
+
+// canonicalCodes assigns the codes in the order of the lengths, then of the symbols, and reverses them
+func canonicalCodes(lengths []uint32) []uint32 {
+	var count [maxCodeLength + 2]uint32
+	for _, length := range lengths {
+		count[length]++
+	}
+	count[0] = 0
+	var next [maxCodeLength + 2]uint32
+	code := uint32(0)
+	for length := 1; length < len(next); length++ {
+		code = (code + count[length-1]) << 1
+		next[length] = code
+	}
+
+	codes := make([]uint32, len(lengths))
+	for symbol, length := range lengths {
+		if length == 0 {
+			continue
+		}
+		code := next[length]
+		next[length]++
+		var reversed uint32
+		for i := uint32(0); i < length; i++ {
+			reversed = reversed<<1 | (code>>i)&1
+		}
+		codes[symbol] = reversed
+	}
+	return codes
+}
+
+// bitWriter packs values from their least significant bit on
+type bitWriter struct {
+	buf  []byte
+	acc  uint64
+	nacc uint
+}
+
+func (w *bitWriter) write(bits uint32, n uint) {
+	w.acc |= uint64(bits) << w.nacc
+	w.nacc += n
+	for w.nacc >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nacc -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.nacc > 0 {
+		return append(w.buf, byte(w.acc))
+	}
+	return w.buf
+}
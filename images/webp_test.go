@@ -0,0 +1,85 @@
+package images_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/image/webp"
+
+	"github.com/plar/rentals-api/images"
+)
+
+// decodes back with the x/image decoder, lossless means the same pixels
+func TestEncodeWebP(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	tests := []struct {
+		name  string
+		image func() image.Image
+	}{
+		{"single pixel", func() image.Image { return solid(1, 1, color.NRGBA{R: 200, G: 10, B: 30, A: 255}) }},
+		{"solid", func() image.Image { return solid(33, 17, color.NRGBA{R: 12, G: 120, B: 250, A: 255}) }},
+		{"gradient", func() image.Image {
+			img := image.NewNRGBA(image.Rect(0, 0, 130, 70))
+			for y := 0; y < 70; y++ {
+				for x := 0; x < 130; x++ {
+					img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 2), G: uint8(y * 3), B: uint8(x + y), A: 255})
+				}
+			}
+			return img
+		}},
+		{"noise with alpha", func() image.Image {
+			img := image.NewNRGBA(image.Rect(0, 0, 67, 45))
+			rnd.Read(img.Pix)
+			return img
+		}},
+		{"two colors", func() image.Image {
+			img := solid(20, 20, color.NRGBA{A: 255})
+			for i := 0; i < 20; i++ {
+				img.SetNRGBA(i, i, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+			}
+			return img
+		}},
+		{"offset bounds", func() image.Image {
+			img := image.NewRGBA(image.Rect(5, 7, 40, 30))
+			rnd.Read(img.Pix)
+			for i := 3; i < len(img.Pix); i += 4 {
+				img.Pix[i] = 255
+			}
+			return img
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := tt.image()
+			var buf bytes.Buffer
+			require.NoError(t, images.EncodeWebP(&buf, img))
+
+			decoded, err := webp.Decode(&buf)
+			require.NoError(t, err)
+			b := img.Bounds()
+			require.Equal(t, b.Size(), decoded.Bounds().Size())
+			for y := 0; y < b.Dy(); y++ {
+				for x := 0; x < b.Dx(); x++ {
+					want := color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y))
+					got := color.NRGBAModel.Convert(decoded.At(x, y))
+					if !assert.Equal(t, want, got, "pixel %d,%d", x, y) {
+						return
+					}
+				}
+			}
+		})
+	}
+}
+
+func solid(width, height int, c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"go.uber.org/zap"
+
+	"github.com/plar/rentals-api/auth"
+	"github.com/plar/rentals-api/codec"
+	"github.com/plar/rentals-api/config"
+	"github.com/plar/rentals-api/repository"
+	"github.com/plar/rentals-api/service"
+)
+
+// runImport implements `rentals-api import [-dry-run] [-format csv|ndjson] [config flags] FILE`, the import
+// report is printed to stdout as JSON. It returns the process exit code.
+func runImport(log *zap.Logger, args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "validate rows without writing them")
+	formatName := fs.String("format", "", "input format: csv or ndjson (default: detected from the file extension)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: rentals-api import [-dry-run] [-format csv|ndjson] [config flags] FILE")
+		fs.PrintDefaults()
+	}
+	cfg, err := config.Load(fs, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	} else if err != nil {
+		log.Error("Invalid configuration", zap.Error(err))
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	path := fs.Arg(0)
+
+	if *formatName == "" {
+		*formatName = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+	format, err := codec.ParseFormat(*formatName)
+	if err != nil || (format != codec.FormatCSV && format != codec.FormatNDJSON) {
+		log.Error("Unsupported import format", zap.String("format", *formatName))
+		return 2
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Error("Cannot open import file", zap.Error(err))
+		return 1
+	}
+	defer f.Close()
+
+	rows, err := codec.DecodeRentals(format, f)
+	if err != nil {
+		log.Error("Cannot decode import file", zap.Error(err))
+		return 1
+	}
+
+	db, err := openDB(log, cfg)
+	if err != nil {
+		log.Error("Failed to connect to database", zap.Error(err))
+		return 1
+	}
+	defer closeDB(log, db)
+
+	rentalRepo := repository.NewRentalRepository(db, cfg.Repository, log)
+	rentalRepoLog := repository.NewRentalRepositoryLogger(rentalRepo, log)
+	// the command line is trusted, the authorization policy applies to HTTP callers only
+	rentalSvc := service.NewRentalService(rentalRepoLog, log)
+
+	// Ctrl+C cancels the import transaction
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// the revisions of the imported rentals are attributed to the user running the command
+	ctx = auth.NewContext(ctx, auth.Identity{Subject: cliActor()})
+
+	report, err := rentalSvc.ImportRentals(ctx, rows, *dryRun)
+	if err != nil {
+		log.Error("Import failed", zap.Error(err))
+		return 1
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "    ")
+	if err = enc.Encode(report); err != nil {
+		log.Error("Cannot write import report", zap.Error(err))
+		return 1
+	}
+	if report.HasErrors() {
+		return 1
+	}
+	return 0
+}
+
+// cliActor names the OS user running a command
+func cliActor() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return "cli:" + u.Username
+	}
+	return "cli"
+}
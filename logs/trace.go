@@ -0,0 +1,28 @@
+package logs
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// TraceFields returns the trace_id and span_id fields of the span in ctx, none when ctx carries no span
+func TraceFields(ctx context.Context) []zap.Field {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil
+	}
+	return []zap.Field{
+		zap.String("trace_id", sc.TraceID().String()),
+		zap.String("span_id", sc.SpanID().String()),
+	}
+}
+
+// WithContext returns logger annotated with the trace of ctx, the log line can be joined with the trace
+func WithContext(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	if fields := TraceFields(ctx); fields != nil {
+		return logger.With(fields...)
+	}
+	return logger
+}
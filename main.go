@@ -2,80 +2,310 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gin-contrib/zap"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 	"moul.io/zapgorm2"
 
+	"github.com/plar/rentals-api/auth"
+	"github.com/plar/rentals-api/cache"
+	"github.com/plar/rentals-api/certs"
 	"github.com/plar/rentals-api/config"
+	"github.com/plar/rentals-api/domain"
 	"github.com/plar/rentals-api/handler"
+	"github.com/plar/rentals-api/images"
 	"github.com/plar/rentals-api/logs"
+	"github.com/plar/rentals-api/middleware"
+	"github.com/plar/rentals-api/ratelimit"
 	"github.com/plar/rentals-api/repository"
 	"github.com/plar/rentals-api/service"
+	"github.com/plar/rentals-api/tracing"
 )
 
-func main() {
-	log := logs.Init()
-	defer log.Sync()
+// version and commit are set at build time, see the Makefile
+var (
+	version = "dev"
+	commit  = "unknown"
+)
+
+var gormLogLevels = map[string]logger.LogLevel{
+	"silent": logger.Silent,
+	"error":  logger.Error,
+	"warn":   logger.Warn,
+	"info":   logger.Info,
+}
+
+// openDB opens the database of the backend, the SQLite file or the PostgreSQL primary
+func openDB(log *zap.Logger, cfg config.Config) (*gorm.DB, error) {
+	if cfg.Repository.Backend == "sqlite" {
+		return openGorm(log, sqlite.Open(cfg.DB.SQLiteDSN()), cfg.DB.LogLevel, false)
+	}
+	return openGorm(log, postgres.Open(cfg.DB.DSN()), cfg.DB.LogLevel, false)
+}
 
+func openGorm(log *zap.Logger, dialector gorm.Dialector, logLevel string, lazy bool) (*gorm.DB, error) {
 	// configure gorm logger to use zap logger
 	gormLogger := zapgorm2.New(log)
 	gormLogger.SetAsDefault()
+	gormLogger.Context = logs.TraceFields
 	// ... and create gorm
-	db, err := gorm.Open(postgres.Open(config.DBConnectionString()), &gorm.Config{
-		Logger: gormLogger.LogMode(logger.Info),
+	return gorm.Open(dialector, &gorm.Config{
+		Logger:               gormLogger.LogMode(gormLogLevels[logLevel]),
+		DisableAutomaticPing: lazy,
 	})
-	if err != nil {
-		log.Fatal("Failed to connect to database", zap.Error(err))
-	}
+}
 
-	// close DB connection
-	defer func() {
-		dbInst, err := db.DB()
+// openReplicas opens the read replicas, the name of a replica is its host. A replica which is down does
+// not stop the service, its reads go to the primary until it answers.
+func openReplicas(log *zap.Logger, cfg config.DBConfig) ([]repository.Replica, error) {
+	var replicas []repository.Replica
+	for _, replicaURL := range cfg.Replicas.URLs {
+		dsn, weight, err := config.ReplicaURL(replicaURL)
 		if err != nil {
-			log.Error("Cannot get DB", zap.Error(err))
+			return nil, err
 		}
-		if err = dbInst.Close(); err != nil {
-			log.Error("Cannot close DB", zap.Error(err))
+		u, _ := url.Parse(dsn)
+		db, err := openGorm(log.With(zap.String("replica", u.Host)), postgres.Open(dsn), cfg.LogLevel, true)
+		if err != nil {
+			return nil, fmt.Errorf("replica %s: %w", u.Host, err)
 		}
-	}()
+		replicas = append(replicas, repository.Replica{Name: u.Host, DB: db, Weight: weight})
+	}
+	return replicas, nil
+}
+
+func closeDB(log *zap.Logger, db *gorm.DB) {
+	dbInst, err := db.DB()
+	if err != nil {
+		log.Error("Cannot get DB", zap.Error(err))
+		return
+	}
+	if err = dbInst.Close(); err != nil {
+		log.Error("Cannot close DB", zap.Error(err))
+	}
+}
+
+func replicaDBs(replicas []repository.Replica) []*gorm.DB {
+	dbs := make([]*gorm.DB, len(replicas))
+	for i, replica := range replicas {
+		dbs[i] = replica.DB
+	}
+	return dbs
+}
+
+func firstArg() string {
+	if len(os.Args) > 1 {
+		return os.Args[1]
+	}
+	return ""
+}
+
+func main() {
+	log := logs.Init()
+	defer log.Sync()
+
+	// subcommands
+	subcommands := map[string]func(*zap.Logger, []string) int{
+		"import":  runImport,
+		"apikey":  runAPIKey,
+		"migrate": runMigrate,
+	}
+	if run, ok := subcommands[firstArg()]; ok {
+		code := run(log, os.Args[2:])
+		log.Sync()
+		os.Exit(code)
+	}
+
+	printConfig := flag.Bool("print-config", false, "print the effective configuration with secrets redacted and exit")
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatal("Invalid configuration", zap.Error(err))
+	}
+	if *printConfig {
+		fmt.Print(cfg)
+		return
+	}
+	log.Info("Effective configuration", zap.Any("config", cfg.Redacted()))
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing, version)
+	if err != nil {
+		log.Fatal("Failed to setup tracing", zap.Error(err))
+	}
+	tp := otel.GetTracerProvider()
+
+	// setup metrics
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+
+	var store storage
+	switch cfg.Repository.Backend {
+	case "memory":
+		store = openMemory(log, cfg.Repository)
+	case "sqlite":
+		store = openSQLite(log, cfg, tp, registry)
+	default:
+		store = openPostgres(watchCtx, log, cfg, tp, registry)
+	}
+	defer store.close()
 
 	// setup app
-	rentalRepo := repository.NewRentalRepository(db, log)
-	rentalRepoLog := repository.NewRentalRepositoryLogger(rentalRepo, log)
-	rentalSvc := service.NewRentalService(rentalRepoLog, log)
-	rentalHandler := handler.NewRentalHandler(rentalSvc, log)
+	rentalRepoMetrics := repository.NewRentalRepositoryMetrics(store.rentals, registry)
+	rentalRepoLog := repository.NewRentalRepositoryLogger(rentalRepoMetrics, log)
+	rentalRepoTracer := repository.NewRentalRepositoryTracer(rentalRepoLog, tp)
+	// cache hits skip the repository metrics and spans, they measure the database calls
+	var rentalRepoCache domain.RentalRepository = rentalRepoTracer
+	if cfg.Cache.Backend == "memory" {
+		rentalRepoCache = repository.NewRentalRepositoryCache(rentalRepoTracer, cache.NewMemory(cfg.Cache.MaxEntries, nil), cfg.Cache.TTL, store.router, registry, log)
+	}
+	imageStore := images.NewLocal(cfg.Images.Dir, cfg.Images.BaseURL)
+	rentalSvc := service.NewRentalService(rentalRepoCache, log)
+	rentalSvcImages := service.NewRentalServiceImages(rentalSvc, store.images, imageStore, log)
+	rentalSvcPolicy := service.NewRentalServicePolicy(rentalSvcImages, rentalRepoCache, auth.DefaultPolicy)
+	rentalSvcTracer := service.NewRentalServiceTracer(rentalSvcPolicy, tp)
+	rentalHandler := handler.NewRentalHandler(rentalSvcTracer, log)
+	rentalImageSvc := service.NewRentalImageService(rentalRepoCache, store.images, imageStore, log)
+	rentalImageSvcPolicy := service.NewRentalImageServicePolicy(rentalImageSvc, rentalRepoCache, auth.DefaultPolicy)
+	rentalImageSvcTracer := service.NewRentalImageServiceTracer(rentalImageSvcPolicy, tp)
+	rentalImageHandler := handler.NewRentalImageHandler(rentalImageSvcTracer, int64(cfg.Images.MaxUploadSize), log)
+	apiKeys := auth.NewAPIKeyAuthenticator(store.apiKeys)
+
+	// rentals soft-deleted longer than the retention are purged in the background, with their images
+	if cfg.Repository.Purge.Retention > 0 {
+		go service.PurgeDeletedRentals(watchCtx, rentalSvcImages, cfg.Repository.Purge.Retention, cfg.Repository.Purge.Interval, log)
+	}
+
+	healthHandler := handler.NewHealthHandler(store.db, store.migrated, handler.BuildInfo{Version: version, Commit: commit}, log)
 
-	// run migrations
-	repository.RentalRepositoryMigrate(db)
+	authn, err := auth.NewAuthenticator(cfg.Auth)
+	if err != nil {
+		log.Fatal("Failed to setup authentication", zap.Error(err))
+	}
+	if !authn.Configured() {
+		log.Warn("Neither auth.jwt_secret nor auth.jwks_file is set, authenticated endpoints reject every request")
+	}
 
 	router := gin.New()
-	router.Use(ginzap.Ginzap(log, time.RFC3339, true))
+	// the anonymous rate limit is per client IP, only the configured proxies may set it
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatal("Invalid trusted proxies", zap.Error(err))
+	}
+	// probes and scrapers hit these every few seconds, they are neither logged nor traced
+	quietPaths := []string{"/healthz", "/readyz", "/metrics"}
+	// preflight requests are answered before authentication and rate limits
+	router.Use(middleware.CORS(cfg.CORS))
+	router.Use(middleware.Metrics(registry))
+	router.Use(otelgin.Middleware(tracing.ServiceName, otelgin.WithFilter(func(r *http.Request) bool {
+		for _, path := range quietPaths {
+			if r.URL.Path == path {
+				return false
+			}
+		}
+		return true
+	})))
+	router.Use(ginzap.GinzapWithConfig(log, &ginzap.Config{
+		TimeFormat: time.RFC3339,
+		UTC:        true,
+		SkipPaths:  quietPaths,
+		Context: func(c *gin.Context) []zapcore.Field {
+			return logs.TraceFields(c.Request.Context())
+		},
+	}))
 	router.Use(ginzap.RecoveryWithZap(log, true))
 
-	// regisyer handlers
-	router.GET("/rentals/:id", rentalHandler.GetRentalByID)
-	router.GET("/rentals", rentalHandler.GetRentals)
+	// register handlers
+	router.GET("/healthz", healthHandler.Healthz)
+	router.GET("/readyz", healthHandler.Readyz)
+	router.GET("/status", healthHandler.Status)
+	router.GET("/metrics", gin.WrapH(promhttp.HandlerFor(registry, promhttp.HandlerOpts{})))
+
+	// API keys and rate limits apply to every rental endpoint
+	limiter := middleware.APIKey(apiKeys, ratelimit.NewMemoryStore(nil), cfg.RateLimit)
+
+	// reads are public, the caller identity is available when a token or an API key is sent
+	api := router.Group("/", middleware.Timeout(cfg.Server.RequestTimeout), limiter, middleware.OptionalAuth(authn))
+	api.GET("/rentals/:id", rentalHandler.GetRentalByID)
+	api.GET("/rentals", rentalHandler.GetRentals)
+	api.GET("/rentals/:id/history", rentalHandler.GetRentalHistory)
+	api.POST("/rentals:method", handler.CustomMethods(map[string]gin.HandlerFunc{
+		":batchGet": rentalHandler.BatchGetRentals,
+	}))
+	// updates require a token or an API key, the policy lets owners update their own rentals only
+	writes := router.Group("/", middleware.Timeout(cfg.Server.RequestTimeout), limiter, middleware.RequireAuth(authn))
+	writes.PUT("/rentals/:id", rentalHandler.UpdateRental)
+	writes.POST("/rentals/:id/images", rentalImageHandler.AddRentalImage)
+	writes.PUT("/rentals/:id/images/order", rentalImageHandler.ReorderRentalImages)
+	writes.DELETE("/rentals/:id/images/:image_id", rentalImageHandler.DeleteRentalImage)
+	// the images are public, a base_url of another server, e.g. a CDN, serves them from there
+	if strings.HasPrefix(cfg.Images.BaseURL, "/") {
+		router.Static(cfg.Images.BaseURL, cfg.Images.Dir)
+	}
+	// admin endpoints require a token or an API key, export and import are long running and have no request deadline
+	admin := router.Group("/", limiter, middleware.RequireAuth(authn))
+	admin.GET("/rentals/export", rentalHandler.ExportRentals)
+	admin.POST("/rentals/import", rentalHandler.ImportRentals)
+	// maintenance of the soft-deleted rentals, the policy allows it to admins only
+	maintenance := router.Group("/admin", middleware.Timeout(cfg.Server.RequestTimeout), limiter, middleware.RequireAuth(authn))
+	maintenance.GET("/rentals/deleted", rentalHandler.GetDeletedRentals)
+	maintenance.POST("/rentals/:id/restore", rentalHandler.RestoreRental)
+	maintenance.DELETE("/rentals/:id/purge", rentalHandler.PurgeRental)
 
 	// run HTTP server
 	srv := &http.Server{
-		Addr:    ":8080",
+		Addr:    cfg.Server.Addr,
 		Handler: router,
 	}
 
+	// the certificate reloads on SIGHUP and when its files change
+	var reloader *certs.Reloader
+	reload := make(chan os.Signal, 1)
+	if cfg.Server.TLS.Enabled() {
+		if reloader, err = certs.NewReloader(cfg.Server.TLS, log); err != nil {
+			log.Fatal("Failed to load TLS certificate", zap.Error(err))
+		}
+		srv.TLSConfig = reloader.TLSConfig()
+		signal.Notify(reload, syscall.SIGHUP)
+
+		if cfg.Server.TLS.ReloadInterval > 0 {
+			go reloader.Watch(watchCtx, cfg.Server.TLS.ReloadInterval)
+		}
+	}
+
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if reloader != nil {
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatal("Failed to start server", zap.Error(err))
 		}
 	}()
@@ -84,15 +314,33 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	// wait for quit signal...
-	<-quit
+	for waiting := true; waiting; {
+		select {
+		case <-reload:
+			if err := reloader.Reload(); err != nil {
+				log.Error("Cannot reload TLS certificate", zap.Error(err))
+			}
+		case <-quit:
+			waiting = false
+		}
+	}
 
-	// enforce shutdown in 5s
+	// fail readiness first and keep serving for server.shutdown_delay, so the orchestrator
+	// stops routing traffic to this instance before it stops accepting requests
 	log.Info("Shutting down server...")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	healthHandler.ShutdownStarted()
+	time.Sleep(cfg.Server.ShutdownDelay)
+
+	// enforce shutdown in server.shutdown_timeout
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatal("Server forced to shutdown:", zap.Error(err))
 	}
 
+	if err := shutdownTracing(ctx); err != nil {
+		log.Error("Cannot flush spans", zap.Error(err))
+	}
+
 	log.Info("Server exiting")
 }
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/plar/rentals-api/auth"
+)
+
+// OptionalAuth authenticates the bearer token when the request has one and lets anonymous requests
+// through. A request with an invalid token is rejected with 401 all the same.
+func OptionalAuth(authn *auth.Authenticator) gin.HandlerFunc {
+	return authenticate(authn, false)
+}
+
+// RequireAuth rejects requests without a valid bearer token, or an identity set by the APIKey
+// middleware, with 401
+func RequireAuth(authn *auth.Authenticator) gin.HandlerFunc {
+	return authenticate(authn, true)
+}
+
+// authenticate puts the identity of the token into the request context, see auth.FromContext
+func authenticate(authn *auth.Authenticator, required bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			// the caller is authenticated already, with an API key
+			if _, ok := auth.FromContext(c.Request.Context()); ok {
+				c.Next()
+				return
+			}
+			if required {
+				c.Header("WWW-Authenticate", `Bearer realm="rentals-api"`)
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+				return
+			}
+			c.Next()
+			return
+		}
+
+		scheme, token, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			c.Header("WWW-Authenticate", `Bearer realm="rentals-api", error="invalid_request"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "malformed authorization header"})
+			return
+		}
+
+		id, err := authn.Authenticate(strings.TrimSpace(token))
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer realm="rentals-api", error="invalid_token"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), id))
+		c.Next()
+	}
+}
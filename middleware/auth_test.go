@@ -0,0 +1,84 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/plar/rentals-api/auth"
+	"github.com/plar/rentals-api/config"
+	"github.com/plar/rentals-api/middleware"
+)
+
+func TestAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	authn, err := auth.NewAuthenticator(config.AuthConfig{JWTSecret: "test-secret"})
+	require.NoError(t, err)
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		Roles: []string{"admin"},
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "user-1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}).SignedString([]byte("test-secret"))
+	require.NoError(t, err)
+
+	var identity *auth.Identity
+	router := gin.New()
+	handle := func(c *gin.Context) {
+		identity = nil
+		if id, ok := auth.FromContext(c.Request.Context()); ok {
+			identity = &id
+		}
+		c.Status(http.StatusOK)
+	}
+	router.GET("/public", middleware.OptionalAuth(authn), handle)
+	router.GET("/admin", middleware.RequireAuth(authn), handle)
+
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		code          int
+		subject       string
+	}{
+		{name: "public anonymous", path: "/public", code: http.StatusOK},
+		{name: "public with token", path: "/public", authorization: "Bearer " + token, code: http.StatusOK, subject: "user-1"},
+		{name: "public with invalid token", path: "/public", authorization: "Bearer nope", code: http.StatusUnauthorized},
+		{name: "admin anonymous", path: "/admin", code: http.StatusUnauthorized},
+		{name: "admin with token", path: "/admin", authorization: "bearer " + token, code: http.StatusOK, subject: "user-1"},
+		{name: "admin basic auth", path: "/admin", authorization: "Basic dXNlcjpwYXNz", code: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			identity = nil
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if tt.code == http.StatusUnauthorized {
+				assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Bearer")
+			}
+			if tt.subject != "" {
+				require.NotNil(t, identity)
+				assert.Equal(t, tt.subject, identity.Subject)
+				assert.True(t, identity.HasRole("admin"))
+			} else {
+				assert.Nil(t, identity)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/plar/rentals-api/config"
+)
+
+// originMatcher matches an exact origin, any origin (*) or the subdomains of a wildcard origin
+// (https://*.example.com matches https://app.example.com and https://a.b.example.com, not https://example.com)
+type originMatcher struct {
+	any    bool
+	exact  map[string]bool
+	suffix [][2]string // scheme://, .domain[:port]
+}
+
+func newOriginMatcher(origins []string) originMatcher {
+	m := originMatcher{exact: make(map[string]bool)}
+	for _, origin := range origins {
+		origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+		switch {
+		case origin == "*":
+			m.any = true
+		case strings.Contains(origin, "://*."):
+			scheme, domain, _ := strings.Cut(origin, "://*")
+			m.suffix = append(m.suffix, [2]string{scheme + "://", domain})
+		default:
+			m.exact[origin] = true
+		}
+	}
+	return m
+}
+
+func (m originMatcher) match(origin string) bool {
+	origin = strings.ToLower(origin)
+	if m.any || m.exact[origin] {
+		return true
+	}
+	for _, s := range m.suffix {
+		if host, ok := strings.CutPrefix(origin, s[0]); ok && strings.HasSuffix(host, s[1]) && len(host) > len(s[1]) {
+			// the subdomain must not hide another domain or a port
+			sub := strings.TrimSuffix(host, s[1])
+			if !strings.ContainsAny(sub, ":/@") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CORS answers the preflight requests and sets the CORS headers of the actual requests of the allowed
+// origins. Register it on the engine so preflight requests of every route are answered before
+// authentication and rate limits. Without allowed origins the middleware does nothing.
+func CORS(cfg config.CORSConfig) gin.HandlerFunc {
+	origins := newOriginMatcher(cfg.AllowedOrigins)
+	methods := make(map[string]bool, len(cfg.AllowedMethods))
+	for _, m := range cfg.AllowedMethods {
+		methods[strings.ToUpper(m)] = true
+	}
+	headers := make(map[string]bool, len(cfg.AllowedHeaders))
+	for _, h := range cfg.AllowedHeaders {
+		headers[http.CanonicalHeaderKey(h)] = true
+	}
+	allowMethods := strings.Join(cfg.AllowedMethods, ", ")
+	allowHeaders := strings.Join(cfg.AllowedHeaders, ", ")
+	exposeHeaders := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		if len(cfg.AllowedOrigins) == 0 {
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Origin")
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if preflight {
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+		if origin == "" {
+			c.Next()
+			return
+		}
+		if !origins.match(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			// the browser blocks the response without the CORS headers
+			c.Next()
+			return
+		}
+
+		if origins.any && !cfg.AllowCredentials {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if cfg.AllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if exposeHeaders != "" {
+				c.Header("Access-Control-Expose-Headers", exposeHeaders)
+			}
+			c.Next()
+			return
+		}
+
+		if !methods[strings.ToUpper(c.GetHeader("Access-Control-Request-Method"))] {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		for _, h := range strings.Split(c.GetHeader("Access-Control-Request-Headers"), ",") {
+			if h = strings.TrimSpace(h); h != "" && !headers[http.CanonicalHeaderKey(h)] {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+		}
+		c.Header("Access-Control-Allow-Methods", allowMethods)
+		c.Header("Access-Control-Allow-Headers", allowHeaders)
+		if cfg.MaxAge > 0 {
+			c.Header("Access-Control-Max-Age", maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,134 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/plar/rentals-api/config"
+	"github.com/plar/rentals-api/middleware"
+)
+
+func TestCORS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.Default().CORS
+	cfg.AllowedOrigins = []string{"https://rentals.example.org", "https://*.example.com"}
+	cfg.AllowCredentials = true
+
+	router := gin.New()
+	router.Use(middleware.CORS(cfg))
+	// preflight requests never reach the group middleware
+	api := router.Group("/", func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.AbortWithStatus(http.StatusUnauthorized)
+		}
+	})
+	api.GET("/rentals", func(c *gin.Context) { c.Status(http.StatusOK) })
+	api.GET("/rentals/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	api.POST("/rentals:method", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	serve := func(method, path, origin string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("allowed origins", func(t *testing.T) {
+		for _, origin := range []string{"https://rentals.example.org", "https://app.example.com", "https://a.b.example.com"} {
+			w := serve("GET", "/rentals", origin, map[string]string{"Authorization": "Bearer token"})
+			assert.Equal(t, http.StatusOK, w.Code, origin)
+			assert.Equal(t, origin, w.Header().Get("Access-Control-Allow-Origin"), origin)
+			assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"), origin)
+			assert.Contains(t, w.Header().Get("Access-Control-Expose-Headers"), "X-RateLimit-Remaining", origin)
+			assert.Contains(t, w.Header().Values("Vary"), "Origin", origin)
+		}
+	})
+
+	t.Run("rejected origins", func(t *testing.T) {
+		for _, origin := range []string{"https://example.com", "http://app.example.com", "https://app.example.com.evil.io",
+			"https://evil.io", "https://rentals.example.org:8443"} {
+			w := serve("GET", "/rentals", origin, map[string]string{"Authorization": "Bearer token"})
+			assert.Equal(t, http.StatusOK, w.Code, origin)
+			assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"), origin)
+			assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"), origin)
+
+			w = serve("OPTIONS", "/rentals", origin, map[string]string{"Access-Control-Request-Method": "GET"})
+			assert.Equal(t, http.StatusForbidden, w.Code, origin)
+			assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"), origin)
+		}
+	})
+
+	t.Run("preflight for every route", func(t *testing.T) {
+		for _, path := range []string{"/rentals", "/rentals/42", "/rentals:batchGet"} {
+			w := serve("OPTIONS", path, "https://app.example.com", map[string]string{
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "authorization, content-type, x-api-key",
+			})
+			assert.Equal(t, http.StatusNoContent, w.Code, path)
+			assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"), path)
+			assert.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), "POST", path)
+			assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "X-API-Key", path)
+			assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"), path)
+		}
+	})
+
+	t.Run("preflight with a method or header not allowed", func(t *testing.T) {
+		w := serve("OPTIONS", "/rentals", "https://app.example.com", map[string]string{"Access-Control-Request-Method": "TRACE"})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = serve("OPTIONS", "/rentals", "https://app.example.com", map[string]string{
+			"Access-Control-Request-Method":  "GET",
+			"Access-Control-Request-Headers": "X-Debug",
+		})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("same origin requests", func(t *testing.T) {
+		w := serve("GET", "/rentals", "", map[string]string{"Authorization": "Bearer token"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	})
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(middleware.CORS(config.CORSConfig{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}, MaxAge: time.Minute}))
+	router.GET("/rentals", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest("GET", "/rentals", nil)
+	req.Header.Set("Origin", "https://anywhere.io")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+}
+
+func TestCORSDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(middleware.CORS(config.Default().CORS))
+	router.GET("/rentals", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest("GET", "/rentals", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Values("Vary"))
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// unmatchedRoute labels requests which did not match any route, the raw path would explode the
+// number of series
+const unmatchedRoute = "unmatched"
+
+// Metrics counts the HTTP requests and records their latency, labelled by method, route template
+// (/rentals/:id rather than /rentals/42) and status code. The collectors are registered on reg.
+func Metrics(reg prometheus.Registerer) gin.HandlerFunc {
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "rentals",
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of HTTP requests.",
+	}, []string{"method", "route", "status"})
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "rentals",
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of the HTTP requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+	inFlight := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "rentals",
+		Subsystem: "http",
+		Name:      "requests_in_flight",
+		Help:      "Number of HTTP requests being served.",
+	})
+	reg.MustRegister(requests, duration, inFlight)
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		requests.WithLabelValues(c.Request.Method, route, status).Inc()
+		duration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
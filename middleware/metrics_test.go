@@ -0,0 +1,44 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/plar/rentals-api/middleware"
+)
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	reg := prometheus.NewRegistry()
+	router := gin.New()
+	router.Use(middleware.Metrics(reg))
+	router.GET("/rentals/:id", func(c *gin.Context) {
+		if c.Param("id") == "0" {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	for _, path := range []string{"/rentals/1", "/rentals/2", "/rentals/0", "/unknown"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	expected := `
+# HELP rentals_http_requests_total Number of HTTP requests.
+# TYPE rentals_http_requests_total counter
+rentals_http_requests_total{method="GET",route="/rentals/:id",status="200"} 2
+rentals_http_requests_total{method="GET",route="/rentals/:id",status="404"} 1
+rentals_http_requests_total{method="GET",route="unmatched",status="404"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected), "rentals_http_requests_total"))
+	assert.Equal(t, 3, testutil.CollectAndCount(reg, "rentals_http_request_duration_seconds"))
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/plar/rentals-api/auth"
+	"github.com/plar/rentals-api/config"
+	"github.com/plar/rentals-api/ratelimit"
+)
+
+// APIKey authenticates the X-API-Key header and rate limits the request with the token bucket of
+// the key, requests without a key are limited per client IP with the anonymous limit. The partner
+// identity of the key goes into the request context, see auth.FromContext.
+func APIKey(keys *auth.APIKeyAuthenticator, store ratelimit.Store, cfg config.RateLimitConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(auth.APIKeyHeader)
+		if key == "" {
+			if cfg.AnonymousRate > 0 {
+				limit := ratelimit.Limit{Rate: cfg.AnonymousRate, Burst: cfg.AnonymousBurst}
+				if !takeToken(c, store, "ip:"+c.ClientIP(), limit) {
+					return
+				}
+			}
+			c.Next()
+			return
+		}
+
+		apiKey, id, err := keys.Authenticate(c.Request.Context(), key)
+		if errors.Is(err, auth.ErrInvalidAPIKey) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "cannot verify api key"})
+			c.Error(err)
+			return
+		}
+
+		limit := ratelimit.Limit{Rate: apiKey.Rate, Burst: apiKey.Burst}
+		if limit.Rate <= 0 || limit.Burst < 1 {
+			limit = ratelimit.Limit{Rate: cfg.KeyRate, Burst: cfg.KeyBurst}
+		}
+		if !takeToken(c, store, "key:"+apiKey.Prefix, limit) {
+			return
+		}
+
+		c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// takeToken sets the X-RateLimit-* headers and aborts with 429 when the bucket is empty. The request
+// goes through when the store fails, an unavailable limiter must not take the API down.
+func takeToken(c *gin.Context, store ratelimit.Store, bucket string, limit ratelimit.Limit) bool {
+	result, err := store.Take(c.Request.Context(), bucket, limit)
+	if err != nil {
+		c.Error(err)
+		return true
+	}
+
+	c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("X-RateLimit-Reset", ceilSeconds(result.Reset))
+	if !result.Allowed {
+		c.Header("Retry-After", ceilSeconds(result.RetryAfter))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+		return false
+	}
+	return true
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
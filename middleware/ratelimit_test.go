@@ -0,0 +1,124 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/plar/rentals-api/auth"
+	"github.com/plar/rentals-api/config"
+	"github.com/plar/rentals-api/domain"
+	"github.com/plar/rentals-api/middleware"
+	"github.com/plar/rentals-api/ratelimit"
+	"github.com/plar/rentals-api/repository/mocks"
+)
+
+func TestAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const (
+		partnerKey = "rk_0011aabb_partner-secret"
+		revokedKey = "rk_22334455_revoked-secret"
+	)
+	revokedAt := time.Now()
+	mockRepo := &mocks.APIKeyRepository{}
+	mockRepo.On("FindByHash", mock.Anything, auth.HashAPIKey(partnerKey)).
+		Return(domain.APIKey{Prefix: "rk_0011aabb", Scopes: []string{"rentals:read"}, Rate: 1, Burst: 2}, nil)
+	mockRepo.On("FindByHash", mock.Anything, auth.HashAPIKey(revokedKey)).
+		Return(domain.APIKey{Prefix: "rk_22334455", RevokedAt: &revokedAt}, nil)
+	mockRepo.On("FindByHash", mock.Anything, mock.Anything).Return(domain.APIKey{}, domain.ErrAPIKeyNotFound)
+
+	cfg := config.RateLimitConfig{KeyRate: 10, KeyBurst: 20, AnonymousRate: 1, AnonymousBurst: 1}
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	store := ratelimit.NewMemoryStore(func() time.Time { return now })
+
+	var identity auth.Identity
+	router := gin.New()
+	router.Use(middleware.APIKey(auth.NewAPIKeyAuthenticator(mockRepo), store, cfg))
+	router.GET("/rentals", func(c *gin.Context) {
+		identity, _ = auth.FromContext(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+
+	serve := func(key string, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/rentals", nil)
+		req.RemoteAddr = remoteAddr
+		if key != "" {
+			req.Header.Set(auth.APIKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("partner key", func(t *testing.T) {
+		w := serve(partnerKey, "10.0.0.1:1234")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+		assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+		assert.Equal(t, "1", w.Header().Get("X-RateLimit-Reset"))
+		assert.Equal(t, "apikey:rk_0011aabb", identity.Subject)
+		assert.Equal(t, []string{"partner"}, identity.Roles)
+		assert.Equal(t, []string{"rentals:read"}, identity.Scopes)
+
+		assert.Equal(t, http.StatusOK, serve(partnerKey, "10.0.0.1:1234").Code)
+
+		w = serve(partnerKey, "10.0.0.2:1234")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "1", w.Header().Get("Retry-After"))
+		assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+		assert.JSONEq(t, `{"error":"rate limit exceeded"}`, w.Body.String())
+
+		now = now.Add(time.Second)
+		assert.Equal(t, http.StatusOK, serve(partnerKey, "10.0.0.1:1234").Code)
+	})
+
+	t.Run("anonymous per client IP", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve("", "10.0.0.3:1234").Code)
+		assert.Equal(t, http.StatusTooManyRequests, serve("", "10.0.0.3:1234").Code)
+		assert.Equal(t, http.StatusOK, serve("", "10.0.0.4:1234").Code)
+	})
+
+	t.Run("invalid keys", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, serve("nope", "10.0.0.5:1234").Code)
+		assert.Equal(t, http.StatusUnauthorized, serve("rk_99999999_unknown", "10.0.0.5:1234").Code)
+
+		w := serve(revokedKey, "10.0.0.5:1234")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.JSONEq(t, `{"error":"invalid api key: key rk_22334455 is revoked"}`, w.Body.String())
+	})
+}
+
+func TestAPIKeyForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.RateLimitConfig{AnonymousRate: 1, AnonymousBurst: 1}
+	store := ratelimit.NewMemoryStore(func() time.Time { return time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC) })
+	router := gin.New()
+	assert.NoError(t, router.SetTrustedProxies([]string{"10.1.0.0/16"}))
+	router.Use(middleware.APIKey(auth.NewAPIKeyAuthenticator(&mocks.APIKeyRepository{}), store, cfg))
+	router.GET("/rentals", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	serve := func(remoteAddr string, forwardedFor string) int {
+		req := httptest.NewRequest("GET", "/rentals", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// a forged header of an untrusted caller shares the bucket of its address
+	assert.Equal(t, http.StatusOK, serve("10.0.0.1:1234", "192.0.2.1"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("10.0.0.1:1234", "192.0.2.2"))
+
+	// the trusted proxies forward the client IP
+	assert.Equal(t, http.StatusOK, serve("10.1.0.1:1234", "192.0.2.3"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("10.1.0.2:1234", "192.0.2.3"))
+	assert.Equal(t, http.StatusOK, serve("10.1.0.1:1234", "192.0.2.4"))
+}
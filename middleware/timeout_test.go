@@ -0,0 +1,60 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/plar/rentals-api/middleware"
+)
+
+func TestTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("deadline is set", func(t *testing.T) {
+		var deadline time.Time
+		var ok bool
+
+		router := gin.New()
+		router.Use(middleware.Timeout(time.Second))
+		router.GET("/", func(c *gin.Context) {
+			deadline, ok = c.Request.Context().Deadline()
+		})
+
+		start := time.Now()
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		assert.True(t, ok)
+		assert.WithinDuration(t, start.Add(time.Second), deadline, 100*time.Millisecond)
+	})
+
+	t.Run("deadline expires", func(t *testing.T) {
+		router := gin.New()
+		router.Use(middleware.Timeout(10 * time.Millisecond))
+		router.GET("/", func(c *gin.Context) {
+			<-c.Request.Context().Done()
+			c.String(http.StatusServiceUnavailable, c.Request.Context().Err().Error())
+		})
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "context deadline exceeded", w.Body.String())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		var ok bool
+
+		router := gin.New()
+		router.Use(middleware.Timeout(0))
+		router.GET("/", func(c *gin.Context) {
+			_, ok = c.Request.Context().Deadline()
+		})
+
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,356 @@
+// Package migrate applies the versioned SQL migrations embedded in the binary and records them in
+// the schema_migrations table.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+//go:embed migrations/postgres/*.sql migrations/sqlite/*.sql
+var embedded embed.FS
+
+// lockID is the key of the advisory lock which serializes the migrations of concurrent replicas
+const lockID = 0x72656e74616c73 // "rentals"
+
+// Dialect is the SQL of the schema_migrations bookkeeping on a database, its migrations are in the
+// migrations directory of the same name
+type Dialect struct {
+	name string
+	// lock and unlock serialize the migrations, they are skipped when empty
+	lock        string
+	unlock      string
+	createTable string
+	tableExists string
+	insert      string
+	delete      string
+}
+
+var (
+	Postgres = Dialect{
+		name:   "postgres",
+		lock:   `SELECT pg_advisory_lock($1)`,
+		unlock: `SELECT pg_advisory_unlock($1)`,
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version bigint PRIMARY KEY,
+    name text NOT NULL,
+    applied_at timestamp with time zone NOT NULL DEFAULT now()
+)`,
+		tableExists: `SELECT to_regclass('schema_migrations') IS NOT NULL`,
+		insert:      `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`,
+		delete:      `DELETE FROM schema_migrations WHERE version = $1`,
+	}
+	// SQLite has no advisory lock, the migration transactions of concurrent processes are serialized by
+	// the database lock and the second one to record a version fails
+	SQLite = Dialect{
+		name: "sqlite",
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version integer PRIMARY KEY,
+    name text NOT NULL,
+    applied_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`,
+		tableExists: `SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations')`,
+		insert:      `INSERT INTO schema_migrations (version, name) VALUES (?, ?)`,
+		delete:      `DELETE FROM schema_migrations WHERE version = ?`,
+	}
+)
+
+// DialectOf returns the dialect of a GORM dialector name, postgres or sqlite
+func DialectOf(name string) (Dialect, error) {
+	switch name {
+	case "postgres":
+		return Postgres, nil
+	case "sqlite":
+		return SQLite, nil
+	}
+	return Dialect{}, fmt.Errorf("migrations of %q databases are not supported", name)
+}
+
+func (d Dialect) String() string {
+	return d.name
+}
+
+// ErrUnexpectedVersion is returned by Check when the schema does not match the migrations of the build
+var ErrUnexpectedVersion = errors.New("unexpected schema version")
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and the time it was applied, AppliedAt is nil when it is pending
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Embedded returns the migrations of the build for the dialect
+func Embedded(dialect Dialect) ([]Migration, error) {
+	sub, err := fs.Sub(embedded, "migrations/"+dialect.name)
+	if err != nil {
+		return nil, err
+	}
+	return Load(sub)
+}
+
+// Load reads the NNNN_name.up.sql and NNNN_name.down.sql files of fsys, versions start at 1 and
+// have no gaps
+func Load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		m := fileName.FindStringSubmatch(file)
+		if m == nil {
+			return nil, fmt.Errorf("migration file name %s is not NNNN_name.up.sql or NNNN_name.down.sql", file)
+		}
+		version, _ := strconv.Atoi(m[1])
+		body, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, mig := range migrations {
+		if mig.Version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+	}
+	return migrations, nil
+}
+
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+	log        *zap.Logger
+}
+
+func New(db *sql.DB, dialect Dialect, migrations []Migration, log *zap.Logger) *Migrator {
+	if log == nil {
+		log = zap.NewNop()
+	}
+	return &Migrator{db: db, dialect: dialect, migrations: migrations, log: log}
+}
+
+// Latest is the version the schema has once every migration is applied
+func (m *Migrator) Latest() int {
+	return len(m.migrations)
+}
+
+// Version is the version of the last applied migration, 0 for an empty database
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	return m.version(ctx, m.db)
+}
+
+// Check reports an ErrUnexpectedVersion unless every migration of the build is applied, the service
+// refuses to run on an older or newer schema
+func (m *Migrator) Check(ctx context.Context) error {
+	v, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	switch {
+	case v < m.Latest():
+		return fmt.Errorf("%w: schema version %d is behind %d, run `rentals-api migrate up`", ErrUnexpectedVersion, v, m.Latest())
+	case v > m.Latest():
+		return fmt.Errorf("%w: schema version %d is newer than %d, the latest migration of this build", ErrUnexpectedVersion, v, m.Latest())
+	}
+	return nil
+}
+
+// Up applies the pending migrations in order and returns them
+func (m *Migrator) Up(ctx context.Context) (applied []Migration, err error) {
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		current, err := m.version(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if current > m.Latest() {
+			return fmt.Errorf("%w: schema version %d is newer than %d, the latest migration of this build", ErrUnexpectedVersion, current, m.Latest())
+		}
+		for _, mig := range m.migrations[current:] {
+			if err = m.apply(ctx, conn, mig, true); err != nil {
+				return err
+			}
+			applied = append(applied, mig)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the last steps applied migrations and returns them
+func (m *Migrator) Down(ctx context.Context, steps int) (reverted []Migration, err error) {
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		current, err := m.version(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if current > m.Latest() {
+			return fmt.Errorf("%w: schema version %d is newer than %d, revert it with the build which applied it", ErrUnexpectedVersion, current, m.Latest())
+		}
+		for v := current; v > 0 && len(reverted) < steps; v-- {
+			mig := m.migrations[v-1]
+			if err = m.apply(ctx, conn, mig, false); err != nil {
+				return err
+			}
+			reverted = append(reverted, mig)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists the migrations of the build and the ones applied by a newer build
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	statuses := make([]Status, len(m.migrations))
+	for i, mig := range m.migrations {
+		statuses[i] = Status{Migration: mig}
+	}
+
+	exists, err := m.tableExists(ctx, m.db)
+	if err != nil || !exists {
+		return statuses, err
+	}
+	rows, err := m.db.QueryContext(ctx, `SELECT version, name, applied_at FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			version   int
+			name      string
+			appliedAt time.Time
+		)
+		if err = rows.Scan(&version, &name, &appliedAt); err != nil {
+			return nil, err
+		}
+		if version <= len(statuses) {
+			statuses[version-1].AppliedAt = &appliedAt
+		} else {
+			statuses = append(statuses, Status{Migration: Migration{Version: version, Name: name}, AppliedAt: &appliedAt})
+		}
+	}
+	return statuses, rows.Err()
+}
+
+// withLock runs fn on a connection holding the migration advisory lock, the other replicas wait for it
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.dialect.lock != "" {
+		if _, err = conn.ExecContext(ctx, m.dialect.lock, lockID); err != nil {
+			return fmt.Errorf("cannot acquire migration lock: %w", err)
+		}
+		defer func() {
+			if _, err := conn.ExecContext(context.Background(), m.dialect.unlock, lockID); err != nil {
+				m.log.Error("Cannot release migration lock", zap.Error(err))
+			}
+		}()
+	}
+
+	if _, err = conn.ExecContext(ctx, m.dialect.createTable); err != nil {
+		return fmt.Errorf("cannot create schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+// apply runs the up or down script of mig and records it in one transaction
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mig Migration, up bool) error {
+	start := time.Now()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	script, direction := mig.Up, "up"
+	if !up {
+		script, direction = mig.Down, "down"
+	}
+	if _, err = tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("migration %d_%s %s failed: %w", mig.Version, mig.Name, direction, err)
+	}
+	if up {
+		_, err = tx.ExecContext(ctx, m.dialect.insert, mig.Version, mig.Name)
+	} else {
+		_, err = tx.ExecContext(ctx, m.dialect.delete, mig.Version)
+	}
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	m.log.Info("Migration applied",
+		zap.Int("version", mig.Version),
+		zap.String("name", mig.Name),
+		zap.String("direction", direction),
+		zap.Duration("duration", time.Since(start)))
+	return nil
+}
+
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (m *Migrator) tableExists(ctx context.Context, db queryer) (bool, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx, m.dialect.tableExists).Scan(&exists)
+	return exists, err
+}
+
+func (m *Migrator) version(ctx context.Context, db queryer) (int, error) {
+	exists, err := m.tableExists(ctx, db)
+	if err != nil || !exists {
+		return 0, err
+	}
+	var v int
+	err = db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&v)
+	return v, err
+}
@@ -0,0 +1,243 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	_ "github.com/glebarez/go-sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/plar/rentals-api/migrate"
+)
+
+var (
+	lockQuery    = regexp.QuoteMeta(`SELECT pg_advisory_lock($1)`)
+	unlockQuery  = regexp.QuoteMeta(`SELECT pg_advisory_unlock($1)`)
+	createTable  = regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS schema_migrations`)
+	existsQuery  = regexp.QuoteMeta(`SELECT to_regclass('schema_migrations') IS NOT NULL`)
+	versionQuery = regexp.QuoteMeta(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`)
+)
+
+var testMigrations = []migrate.Migration{
+	{Version: 1, Name: "create_users", Up: "CREATE TABLE users (id int)", Down: "DROP TABLE users"},
+	{Version: 2, Name: "create_rentals", Up: "CREATE TABLE rentals (id int)", Down: "DROP TABLE rentals"},
+}
+
+func newMigrator(t *testing.T) (*migrate.Migrator, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		db.Close()
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	return migrate.New(db, migrate.Postgres, testMigrations, nil), mock
+}
+
+func expectVersion(mock sqlmock.Sqlmock, version int) {
+	mock.ExpectQuery(existsQuery).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(version > 0))
+	if version > 0 {
+		mock.ExpectQuery(versionQuery).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(version))
+	}
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := migrate.Load(fstest.MapFS{
+		"0002_create_rentals.up.sql":   {Data: []byte("CREATE TABLE rentals (id int)")},
+		"0002_create_rentals.down.sql": {Data: []byte("DROP TABLE rentals")},
+		"0001_create_users.up.sql":     {Data: []byte("CREATE TABLE users (id int)")},
+		"0001_create_users.down.sql":   {Data: []byte("DROP TABLE users")},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, testMigrations, migrations)
+
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		err   string
+	}{
+		{name: "bad name", files: fstest.MapFS{"create_users.sql": {}}, err: "is not NNNN_name.up.sql"},
+		{name: "missing down", files: fstest.MapFS{"0001_create_users.up.sql": {Data: []byte("CREATE TABLE users (id int)")}}, err: "needs both an up and a down file"},
+		{name: "gap", files: fstest.MapFS{
+			"0002_create_rentals.up.sql":   {Data: []byte("CREATE TABLE rentals (id int)")},
+			"0002_create_rentals.down.sql": {Data: []byte("DROP TABLE rentals")},
+		}, err: "migration 1 is missing"},
+		{name: "name mismatch", files: fstest.MapFS{
+			"0001_create_users.up.sql":    {Data: []byte("CREATE TABLE users (id int)")},
+			"0001_create_people.down.sql": {Data: []byte("DROP TABLE users")},
+		}, err: "is named both"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := migrate.Load(tt.files)
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestEmbedded(t *testing.T) {
+	migrations, err := migrate.Embedded(migrate.Postgres)
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	assert.Equal(t, "create_rentals", migrations[0].Name)
+
+	// the schema versions mean the same on every database
+	sqliteMigrations, err := migrate.Embedded(migrate.SQLite)
+	require.NoError(t, err)
+	require.Len(t, sqliteMigrations, len(migrations))
+	for i, mig := range sqliteMigrations {
+		assert.Equal(t, migrations[i].Name, mig.Name)
+	}
+}
+
+func TestSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "rentals.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	migrations, err := migrate.Embedded(migrate.SQLite)
+	require.NoError(t, err)
+	migrator := migrate.New(db, migrate.SQLite, migrations, nil)
+	ctx := context.Background()
+
+	assert.ErrorIs(t, migrator.Check(ctx), migrate.ErrUnexpectedVersion)
+	applied, err := migrator.Up(ctx)
+	require.NoError(t, err)
+	assert.Len(t, applied, len(migrations))
+	require.NoError(t, migrator.Check(ctx))
+	_, err = db.Exec(`INSERT INTO rentals (id, user_id, name, deleted_at) VALUES (1, 1, 'Van', '2023-05-01 12:00:00+00:00')`)
+	require.NoError(t, err)
+
+	statuses, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, len(migrations))
+	assert.NotNil(t, statuses[len(statuses)-1].AppliedAt)
+
+	// down to the version before the history, the baseline records the existing rentals once up again
+	reverted, err := migrator.Down(ctx, len(migrations)-2)
+	require.NoError(t, err)
+	assert.Len(t, reverted, len(migrations)-2)
+	_, err = migrator.Up(ctx)
+	require.NoError(t, err)
+	var snapshot string
+	require.NoError(t, db.QueryRow(`SELECT snapshot FROM rental_revisions WHERE rental_id = 1 AND action = 'baseline'`).Scan(&snapshot))
+	assert.Contains(t, snapshot, `"deleted_at":"2023-05-01T12:00:00.000Z"`)
+
+	reverted, err = migrator.Down(ctx, len(migrations))
+	require.NoError(t, err)
+	assert.Len(t, reverted, len(migrations))
+	version, err := migrator.Version(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, version)
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		err     string
+	}{
+		{name: "empty database", version: 0, err: "schema version 0 is behind 2"},
+		{name: "behind", version: 1, err: "schema version 1 is behind 2"},
+		{name: "current", version: 2},
+		{name: "newer", version: 3, err: "schema version 3 is newer than 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, mock := newMigrator(t)
+			expectVersion(mock, tt.version)
+
+			err := m.Check(context.Background())
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, migrate.ErrUnexpectedVersion)
+				assert.ErrorContains(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestUp(t *testing.T) {
+	m, mock := newMigrator(t)
+	mock.ExpectExec(lockQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(createTable).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectVersion(mock, 1)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE rentals (id int)`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`)).
+		WithArgs(2, "create_rentals").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(unlockQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	applied, err := m.Up(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, testMigrations[1:], applied)
+}
+
+func TestUpFailure(t *testing.T) {
+	m, mock := newMigrator(t)
+	mock.ExpectExec(lockQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(createTable).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectVersion(mock, 0)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE users (id int)`)).WillReturnError(errors.New(`relation "users" already exists`))
+	mock.ExpectRollback()
+	mock.ExpectExec(unlockQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	applied, err := m.Up(context.Background())
+	assert.EqualError(t, err, `migration 1_create_users up failed: relation "users" already exists`)
+	assert.Empty(t, applied)
+}
+
+func TestUpLockCanceled(t *testing.T) {
+	m, mock := newMigrator(t)
+	// another replica holds the lock until the context is done
+	mock.ExpectExec(lockQuery).WillDelayFor(time.Second).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := m.Up(ctx)
+	assert.ErrorContains(t, err, "cannot acquire migration lock")
+}
+
+func TestDown(t *testing.T) {
+	m, mock := newMigrator(t)
+	mock.ExpectExec(lockQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(createTable).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectVersion(mock, 2)
+	for _, table := range []string{"rentals", "users"} {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`DROP TABLE ` + table)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM schema_migrations WHERE version = $1`)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+	mock.ExpectExec(unlockQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	reverted, err := m.Down(context.Background(), 5)
+	require.NoError(t, err)
+	assert.Equal(t, []migrate.Migration{testMigrations[1], testMigrations[0]}, reverted)
+}
+
+func TestStatus(t *testing.T) {
+	m, mock := newMigrator(t)
+	appliedAt := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(existsQuery).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT version, name, applied_at FROM schema_migrations ORDER BY version`)).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "name", "applied_at"}).
+			AddRow(1, "create_users", appliedAt).
+			AddRow(3, "create_images", appliedAt))
+
+	statuses, err := m.Status(context.Background())
+	require.NoError(t, err)
+	require.Len(t, statuses, 3)
+	assert.Equal(t, &appliedAt, statuses[0].AppliedAt)
+	assert.Nil(t, statuses[1].AppliedAt)
+	assert.Equal(t, "create_images", statuses[2].Name)
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS rentals;
+DROP TABLE IF EXISTS users;
+DROP EXTENSION IF EXISTS earthdistance;
+DROP EXTENSION IF EXISTS cube;
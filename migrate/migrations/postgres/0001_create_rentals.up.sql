@@ -0,0 +1,38 @@
+-- the statements tolerate a database created by the former db/init.sql and AutoMigrate
+CREATE EXTENSION IF NOT EXISTS cube;
+CREATE EXTENSION IF NOT EXISTS earthdistance;
+
+CREATE TABLE IF NOT EXISTS users (
+    id SERIAL PRIMARY KEY,
+    first_name text,
+    last_name text
+);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS created_at timestamp with time zone;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS updated_at timestamp with time zone;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at timestamp with time zone;
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS rentals (
+    id SERIAL PRIMARY KEY,
+    user_id integer,
+    name text,
+    type text,
+    description text,
+    sleeps integer,
+    price_per_day bigint,
+    home_city text,
+    home_state text,
+    home_zip text,
+    home_country text,
+    vehicle_make text,
+    vehicle_model text,
+    vehicle_year integer,
+    vehicle_length numeric(4,2),
+    created timestamp with time zone,
+    updated timestamp with time zone,
+    lat double precision,
+    lng double precision,
+    primary_image_url text
+);
+ALTER TABLE rentals ADD COLUMN IF NOT EXISTS deleted_at timestamp with time zone;
+CREATE INDEX IF NOT EXISTS idx_rentals_deleted_at ON rentals (deleted_at);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    id bigserial PRIMARY KEY,
+    created timestamp with time zone,
+    revoked_at timestamp with time zone,
+    name text NOT NULL,
+    prefix text NOT NULL,
+    hash text NOT NULL,
+    scopes text NOT NULL,
+    rate numeric NOT NULL,
+    burst bigint NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_prefix ON api_keys (prefix);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_hash ON api_keys (hash);
@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS rental_revisions (
+    id bigserial PRIMARY KEY,
+    rental_id integer NOT NULL,
+    action text NOT NULL,
+    actor text NOT NULL,
+    changed_at timestamp with time zone NOT NULL,
+    diff jsonb NOT NULL,
+    snapshot jsonb NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_rental_revisions_rental_id_changed_at ON rental_revisions (rental_id, changed_at, id);
+
+-- the rentals existing before the history are recorded as they are, as of their last update,
+-- the snapshot is the JSON of domain.Rental with the owner kept by ID only
+INSERT INTO rental_revisions (rental_id, action, actor, changed_at, diff, snapshot)
+SELECT id, 'baseline', 'system', COALESCE(updated, created, now()), '{}', jsonb_build_object(
+    'id', id,
+    'name', COALESCE(name, ''),
+    'description', COALESCE(description, ''),
+    'type', COALESCE(type, ''),
+    'make', COALESCE(vehicle_make, ''),
+    'model', COALESCE(vehicle_model, ''),
+    'year', COALESCE(vehicle_year, 0),
+    'length', COALESCE(vehicle_length, 0),
+    'sleeps', COALESCE(sleeps, 0),
+    'primary_image_url', COALESCE(primary_image_url, ''),
+    'price', jsonb_build_object('day', COALESCE(price_per_day, 0)),
+    'location', jsonb_build_object(
+        'city', COALESCE(home_city, ''),
+        'state', COALESCE(home_state, ''),
+        'zip', COALESCE(home_zip, ''),
+        'country', COALESCE(home_country, ''),
+        'lat', COALESCE(lat, 0),
+        'lng', COALESCE(lng, 0)
+    ),
+    'user', jsonb_build_object('id', COALESCE(user_id, 0), 'first_name', '', 'last_name', ''),
+    'deleted_at', deleted_at
+)
+FROM rentals
+WHERE NOT EXISTS (SELECT 1 FROM rental_revisions r WHERE r.rental_id = rentals.id);
@@ -0,0 +1 @@
+ALTER TABLE rentals DROP COLUMN IF EXISTS version;
@@ -0,0 +1,3 @@
+-- the postgis extension is left installed, other database objects may depend on it
+DROP INDEX IF EXISTS idx_rentals_location;
+ALTER TABLE rentals DROP COLUMN IF EXISTS location;
@@ -0,0 +1,12 @@
+-- the location of a rental as a PostGIS point with a GiST index for the near filter, the column is generated
+-- from lat and lng so every write keeps it in sync. Without PostGIS on the server nothing is created and the
+-- near filter keeps using earthdistance, after installing PostGIS migrate down one step and up again.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'postgis') THEN
+        CREATE EXTENSION IF NOT EXISTS postgis;
+        ALTER TABLE rentals ADD COLUMN IF NOT EXISTS location geography(Point, 4326)
+            GENERATED ALWAYS AS (ST_SetSRID(ST_MakePoint(lng, lat), 4326)::geography) STORED;
+        CREATE INDEX IF NOT EXISTS idx_rentals_location ON rentals USING gist (location);
+    END IF;
+END $$;
@@ -0,0 +1,12 @@
+-- the uploaded images of the rentals, variants is the JSON list of the resized files
+CREATE TABLE IF NOT EXISTS rental_images (
+    id bigserial PRIMARY KEY,
+    rental_id integer NOT NULL REFERENCES rentals (id) ON DELETE CASCADE,
+    position integer NOT NULL,
+    key text NOT NULL,
+    width integer NOT NULL,
+    height integer NOT NULL,
+    variants jsonb NOT NULL,
+    created_at timestamp with time zone
+);
+CREATE INDEX IF NOT EXISTS idx_rental_images_rental_id_position ON rental_images (rental_id, position);
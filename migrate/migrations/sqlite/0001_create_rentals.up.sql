@@ -0,0 +1,37 @@
+-- the schema of the PostgreSQL migration with the types of SQLite, the rentals are indexed on their
+-- coordinates for the bounding box of the near filter
+CREATE TABLE users (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    first_name text,
+    last_name text,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime
+);
+CREATE INDEX idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE rentals (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer,
+    name text,
+    type text,
+    description text,
+    sleeps integer,
+    price_per_day integer,
+    home_city text,
+    home_state text,
+    home_zip text,
+    home_country text,
+    vehicle_make text,
+    vehicle_model text,
+    vehicle_year integer,
+    vehicle_length real,
+    created datetime,
+    updated datetime,
+    lat real,
+    lng real,
+    primary_image_url text,
+    deleted_at datetime
+);
+CREATE INDEX idx_rentals_deleted_at ON rentals (deleted_at);
+CREATE INDEX idx_rentals_lat_lng ON rentals (lat, lng);
@@ -0,0 +1,13 @@
+CREATE TABLE api_keys (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created datetime,
+    revoked_at datetime,
+    name text NOT NULL,
+    prefix text NOT NULL,
+    hash text NOT NULL,
+    scopes text NOT NULL,
+    rate real NOT NULL,
+    burst integer NOT NULL
+);
+CREATE UNIQUE INDEX idx_api_keys_prefix ON api_keys (prefix);
+CREATE UNIQUE INDEX idx_api_keys_hash ON api_keys (hash);
@@ -0,0 +1,40 @@
+CREATE TABLE rental_revisions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    rental_id integer NOT NULL,
+    action text NOT NULL,
+    actor text NOT NULL,
+    changed_at datetime NOT NULL,
+    diff text NOT NULL,
+    snapshot text NOT NULL
+);
+CREATE INDEX idx_rental_revisions_rental_id_changed_at ON rental_revisions (rental_id, changed_at, id);
+
+-- the rentals existing before the history are recorded as they are, as of their last update,
+-- the snapshot is the JSON of domain.Rental with the owner kept by ID only
+INSERT INTO rental_revisions (rental_id, action, actor, changed_at, diff, snapshot)
+SELECT id, 'baseline', 'system', COALESCE(updated, created, datetime('now')), '{}', json_object(
+    'id', id,
+    'name', COALESCE(name, ''),
+    'description', COALESCE(description, ''),
+    'type', COALESCE(type, ''),
+    'make', COALESCE(vehicle_make, ''),
+    'model', COALESCE(vehicle_model, ''),
+    'year', COALESCE(vehicle_year, 0),
+    'length', COALESCE(vehicle_length, 0),
+    'sleeps', COALESCE(sleeps, 0),
+    'primary_image_url', COALESCE(primary_image_url, ''),
+    'price', json_object('day', COALESCE(price_per_day, 0)),
+    'location', json_object(
+        'city', COALESCE(home_city, ''),
+        'state', COALESCE(home_state, ''),
+        'zip', COALESCE(home_zip, ''),
+        'country', COALESCE(home_country, ''),
+        'lat', COALESCE(lat, 0),
+        'lng', COALESCE(lng, 0)
+    ),
+    'user', json_object('id', COALESCE(user_id, 0), 'first_name', '', 'last_name', ''),
+    -- RFC 3339 like the JSON of the PostgreSQL timestamps
+    'deleted_at', strftime('%Y-%m-%dT%H:%M:%fZ', deleted_at)
+)
+FROM rentals
+WHERE NOT EXISTS (SELECT 1 FROM rental_revisions r WHERE r.rental_id = rentals.id);
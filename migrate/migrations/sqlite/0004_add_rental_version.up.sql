@@ -0,0 +1,2 @@
+-- the version of a rental is incremented by every write, updates are conditional on it
+ALTER TABLE rentals ADD COLUMN version integer NOT NULL DEFAULT 1;
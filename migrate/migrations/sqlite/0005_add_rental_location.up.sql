@@ -0,0 +1 @@
+-- the location column is PostGIS only, SQLite filters on the lat and lng index
@@ -0,0 +1,11 @@
+CREATE TABLE rental_images (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    rental_id integer NOT NULL REFERENCES rentals (id) ON DELETE CASCADE,
+    position integer NOT NULL,
+    key text NOT NULL,
+    width integer NOT NULL,
+    height integer NOT NULL,
+    variants text NOT NULL,
+    created_at datetime
+);
+CREATE INDEX idx_rental_images_rental_id_position ON rental_images (rental_id, position);
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/plar/rentals-api/config"
+	"github.com/plar/rentals-api/migrate"
+)
+
+const migrateUsage = `Usage:
+  rentals-api migrate up [config flags]
+  rentals-api migrate down [-steps N] [config flags]
+  rentals-api migrate status [config flags]`
+
+// newMigrator returns the migrator of the migrations embedded in the binary for the database of db
+func newMigrator(log *zap.Logger, db *gorm.DB) (*migrate.Migrator, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	dialect, err := migrate.DialectOf(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := migrate.Embedded(dialect)
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(sqlDB, dialect, migrations, log), nil
+}
+
+// runMigrate implements `rentals-api migrate up|down|status`, it returns the process exit code
+func runMigrate(log *zap.Logger, args []string) int {
+	if len(args) == 0 || (args[0] != "up" && args[0] != "down" && args[0] != "status") {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	command, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("migrate "+command, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), migrateUsage)
+		fs.PrintDefaults()
+	}
+	var steps *int
+	if command == "down" {
+		steps = fs.Int("steps", 1, "number of migrations to revert")
+	}
+	cfg, err := config.Load(fs, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	} else if err != nil {
+		log.Error("Invalid configuration", zap.Error(err))
+		return 2
+	}
+	if steps != nil && *steps < 1 {
+		fs.Usage()
+		return 2
+	}
+
+	db, err := openDB(log, cfg)
+	if err != nil {
+		log.Error("Failed to connect to database", zap.Error(err))
+		return 1
+	}
+	defer closeDB(log, db)
+	migrator, err := newMigrator(log, db)
+	if err != nil {
+		log.Error("Cannot load migrations", zap.Error(err))
+		return 1
+	}
+
+	// Ctrl+C stops waiting for the migration lock and rolls back the running migration
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			log.Error("Migration failed", zap.Error(err))
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "%d migration(s) applied, schema version is %d\n", len(applied), migrator.Latest())
+	case "down":
+		reverted, err := migrator.Down(ctx, *steps)
+		if err != nil {
+			log.Error("Migration failed", zap.Error(err))
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "%d migration(s) reverted\n", len(reverted))
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Error("Cannot read migration status", zap.Error(err))
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			if s.Version > migrator.Latest() {
+				applied += " (unknown to this build)"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		w.Flush()
+	}
+	return 0
+}
@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepEvery is how often the memory store drops the buckets which are full again
+const sweepEvery = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+// refill adds the tokens earned since the last update
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.Rate)
+	}
+	b.last = now
+}
+
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore returns a store which keeps the buckets in the process memory, now is the clock
+// (time.Now when nil)
+func NewMemoryStore(now func() time.Time) *MemoryStore {
+	if now == nil {
+		now = time.Now
+	}
+	return &MemoryStore{
+		buckets:   make(map[string]*bucket),
+		now:       now,
+		lastSweep: now(),
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok || b.limit != limit {
+		// a new key or a changed limit starts with a full bucket
+		b = &bucket{tokens: float64(limit.Burst), last: now, limit: limit}
+		s.buckets[key] = b
+	}
+	b.refill(now)
+
+	result := Result{Limit: limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else if limit.Rate > 0 {
+		result.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	} else {
+		result.RetryAfter = time.Duration(math.MaxInt64)
+	}
+	result.Remaining = int(b.tokens)
+	if limit.Rate > 0 {
+		result.Reset = seconds((float64(limit.Burst) - b.tokens) / limit.Rate)
+	}
+	return result, nil
+}
+
+// sweep drops the buckets which refilled completely, they are the same as new ones
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepEvery {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
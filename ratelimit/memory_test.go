@@ -0,0 +1,69 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/plar/rentals-api/ratelimit"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	store := ratelimit.NewMemoryStore(func() time.Time { return now })
+	limit := ratelimit.Limit{Rate: 2, Burst: 3}
+	ctx := context.Background()
+
+	take := func(key string) ratelimit.Result {
+		result, err := store.Take(ctx, key, limit)
+		require.NoError(t, err)
+		return result
+	}
+
+	// the burst goes through
+	for remaining := 2; remaining >= 0; remaining-- {
+		result := take("a")
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 3, result.Limit)
+		assert.Equal(t, remaining, result.Remaining)
+	}
+
+	// then the bucket is empty until it refills at 2 tokens per second
+	result := take("a")
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+	assert.Equal(t, 1500*time.Millisecond, result.Reset)
+
+	// other keys have their own bucket
+	assert.True(t, take("b").Allowed)
+
+	now = now.Add(500 * time.Millisecond)
+	result = take("a")
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	// the bucket never holds more than the burst
+	now = now.Add(time.Hour)
+	assert.Equal(t, 2, take("a").Remaining)
+}
+
+func TestMemoryStoreLimitChange(t *testing.T) {
+	store := ratelimit.NewMemoryStore(nil)
+	ctx := context.Background()
+
+	result, err := store.Take(ctx, "a", ratelimit.Limit{Rate: 1, Burst: 1})
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	result, err = store.Take(ctx, "a", ratelimit.Limit{Rate: 1, Burst: 1})
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+
+	// a new limit of the key starts with a full bucket
+	result, err = store.Take(ctx, "a", ratelimit.Limit{Rate: 10, Burst: 10})
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 9, result.Remaining)
+}
@@ -0,0 +1,30 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Limit is a token bucket: Burst tokens at most, refilled at Rate tokens per second
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result is the outcome of taking a token
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is the time until the next token, zero when the request is allowed
+	RetryAfter time.Duration
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+}
+
+// Store keeps the token buckets. The in-memory store limits a single instance, a shared store
+// (Redis, ...) limits the whole fleet.
+type Store interface {
+	// Take takes a token from the bucket of key, the bucket is created full with limit
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"time"
+)
+
+type APIKey struct {
+	ID        uint      `gorm:"primary_key"`
+	CreatedAt time.Time `gorm:"column:created;autoCreateTime"`
+	RevokedAt *time.Time
+
+	Name   string `gorm:"not null"`
+	Prefix string `gorm:"not null;uniqueIndex"`
+	Hash   string `gorm:"not null;uniqueIndex"`
+	// Scopes is the comma separated list of the scopes
+	Scopes string  `gorm:"not null"`
+	Rate   float64 `gorm:"not null"`
+	Burst  int     `gorm:"not null"`
+}
+
+func (k *APIKey) TableName() string {
+	return "api_keys"
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/plar/rentals-api/domain"
+)
+
+type apiKeyRepository struct {
+	db *gorm.DB
+}
+
+var _ domain.APIKeyRepository = (*apiKeyRepository)(nil)
+
+func NewAPIKeyRepository(db *gorm.DB) domain.APIKeyRepository {
+	return &apiKeyRepository{db: db}
+}
+
+func (r *apiKeyRepository) FindByHash(ctx context.Context, hash string) (domain.APIKey, error) {
+	var key APIKey
+	err := r.db.WithContext(ctx).Where("hash = ?", hash).Take(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.APIKey{}, domain.ErrAPIKeyNotFound
+	}
+	return toDomainAPIKey(key), queryError(ctx, err)
+}
+
+func (r *apiKeyRepository) Create(ctx context.Context, key domain.APIKey) (domain.APIKey, error) {
+	model := APIKey{
+		Name:   key.Name,
+		Prefix: key.Prefix,
+		Hash:   key.Hash,
+		Scopes: strings.Join(key.Scopes, ","),
+		Rate:   key.Rate,
+		Burst:  key.Burst,
+	}
+	if err := r.db.WithContext(ctx).Create(&model).Error; err != nil {
+		return domain.APIKey{}, queryError(ctx, err)
+	}
+	return toDomainAPIKey(model), nil
+}
+
+func (r *apiKeyRepository) List(ctx context.Context) ([]domain.APIKey, error) {
+	var keys []APIKey
+	if err := r.db.WithContext(ctx).Order("id").Find(&keys).Error; err != nil {
+		return nil, queryError(ctx, err)
+	}
+	dkeys := make([]domain.APIKey, 0, len(keys))
+	for _, key := range keys {
+		dkeys = append(dkeys, toDomainAPIKey(key))
+	}
+	return dkeys, nil
+}
+
+func (r *apiKeyRepository) Revoke(ctx context.Context, prefix string) error {
+	result := r.db.WithContext(ctx).Model(&APIKey{}).
+		Where("prefix = ? AND revoked_at IS NULL", prefix).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return queryError(ctx, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func toDomainAPIKey(k APIKey) domain.APIKey {
+	var scopes []string
+	if k.Scopes != "" {
+		scopes = strings.Split(k.Scopes, ",")
+	}
+	return domain.APIKey{
+		ID:        k.ID,
+		Name:      k.Name,
+		Prefix:    k.Prefix,
+		Hash:      k.Hash,
+		Scopes:    scopes,
+		Rate:      k.Rate,
+		Burst:     k.Burst,
+		CreatedAt: k.CreatedAt,
+		RevokedAt: k.RevokedAt,
+	}
+}
@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/plar/rentals-api/auth"
+	"github.com/plar/rentals-api/domain"
+)
+
+// Replica is a read replica of the primary database, Weight is its share of the reads
+type Replica struct {
+	Name   string
+	DB     *gorm.DB
+	Weight int
+}
+
+type replica struct {
+	Replica
+	healthy atomic.Bool
+}
+
+// DBRouter sends the writes to the primary database and spreads the reads over the healthy replicas
+// by weight. Reads go to the primary when no replica is healthy, when the context asks for it
+// (domain.WithPrimaryReads) and for sticky_window after a write of the same caller, so callers read
+// their own writes despite the replication lag.
+type DBRouter struct {
+	primary      *gorm.DB
+	replicas     []*replica
+	stickyWindow time.Duration
+	logger       *zap.Logger
+
+	mu sync.Mutex
+	// lastWrites is the time of the last write per caller subject
+	lastWrites map[string]time.Time
+}
+
+// permanentError wraps the read errors which a retry on the primary cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// NewDBRouter returns a router of primary and replicas, without replicas everything goes to the primary
+func NewDBRouter(primary *gorm.DB, replicas []Replica, stickyWindow time.Duration, logger *zap.Logger) *DBRouter {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	r := &DBRouter{
+		primary:      primary,
+		stickyWindow: stickyWindow,
+		logger:       logger,
+		lastWrites:   make(map[string]time.Time),
+	}
+	for _, rep := range replicas {
+		if rep.Weight < 1 {
+			rep.Weight = 1
+		}
+		rr := &replica{Replica: rep}
+		rr.healthy.Store(true)
+		r.replicas = append(r.replicas, rr)
+	}
+	return r
+}
+
+// Primary is the database of the writes
+func (r *DBRouter) Primary() *gorm.DB {
+	return r.primary
+}
+
+// Reader is the database the reads of ctx go to
+func (r *DBRouter) Reader(ctx context.Context) *gorm.DB {
+	if rep := r.pick(ctx); rep != nil {
+		return rep.DB
+	}
+	return r.primary
+}
+
+// pick returns a healthy replica chosen by weight, nil when the read goes to the primary
+func (r *DBRouter) pick(ctx context.Context) *replica {
+	if len(r.replicas) == 0 || domain.PrimaryReads(ctx) || r.Sticky(ctx) {
+		return nil
+	}
+
+	total := 0
+	for _, rep := range r.replicas {
+		if rep.healthy.Load() {
+			total += rep.Weight
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+	n := rand.Intn(total)
+	for _, rep := range r.replicas {
+		if !rep.healthy.Load() {
+			continue
+		}
+		if n < rep.Weight {
+			return rep
+		}
+		n -= rep.Weight
+	}
+	return nil
+}
+
+// Sticky reports whether the caller of ctx wrote within the sticky window, its reads go to the primary
+func (r *DBRouter) Sticky(ctx context.Context) bool {
+	id, ok := auth.FromContext(ctx)
+	if !ok || id.Subject == "" || r.LagWindow() <= 0 {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	last, ok := r.lastWrites[id.Subject]
+	return ok && time.Since(last) < r.stickyWindow
+}
+
+// LagWindow is the time the replicas may lag behind a write, zero without replicas
+func (r *DBRouter) LagWindow() time.Duration {
+	if len(r.replicas) == 0 {
+		return 0
+	}
+	return r.stickyWindow
+}
+
+// Read runs fn on a replica, it runs fn again on the primary when the replica fails. The replica gets
+// no reads until a health check finds it answering again.
+func (r *DBRouter) Read(ctx context.Context, fn func(db *gorm.DB) error) error {
+	rep := r.pick(ctx)
+	if rep == nil {
+		return unwrapPermanent(fn(r.primary))
+	}
+
+	err := fn(rep.DB)
+	var permanent permanentError
+	if err == nil || errors.Is(err, gorm.ErrRecordNotFound) || errors.As(err, &permanent) || ctx.Err() != nil {
+		return unwrapPermanent(err)
+	}
+	if rep.healthy.CompareAndSwap(true, false) {
+		r.logger.Warn("Replica failed, reading from the primary", zap.String("replica", rep.Name), zap.Error(err))
+	}
+	return unwrapPermanent(fn(r.primary))
+}
+
+func unwrapPermanent(err error) error {
+	var permanent permanentError
+	if errors.As(err, &permanent) {
+		return permanent.err
+	}
+	return err
+}
+
+// Write runs fn on the primary and makes the next reads of the caller stick to the primary
+func (r *DBRouter) Write(ctx context.Context, fn func(db *gorm.DB) error) error {
+	err := fn(r.primary)
+	if id, ok := auth.FromContext(ctx); ok && id.Subject != "" && r.LagWindow() > 0 {
+		now := time.Now()
+		r.mu.Lock()
+		for subject, last := range r.lastWrites {
+			if now.Sub(last) >= r.stickyWindow {
+				delete(r.lastWrites, subject)
+			}
+		}
+		// a failed write may have been committed before the error, stick to the primary anyway
+		r.lastWrites[id.Subject] = now
+		r.mu.Unlock()
+	}
+	return err
+}
+
+// CheckReplicas pings the replicas and updates their health
+func (r *DBRouter) CheckReplicas(ctx context.Context) {
+	for _, rep := range r.replicas {
+		err := ping(ctx, rep.DB)
+		healthy := err == nil
+		if rep.healthy.Swap(healthy) != healthy {
+			if healthy {
+				r.logger.Info("Replica is back", zap.String("replica", rep.Name))
+			} else {
+				r.logger.Warn("Replica is down", zap.String("replica", rep.Name), zap.Error(err))
+			}
+		}
+	}
+}
+
+func ping(ctx context.Context, db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// Watch checks the replicas every interval until ctx is done
+func (r *DBRouter) Watch(ctx context.Context, interval time.Duration) {
+	if len(r.replicas) == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		checkCtx, cancel := context.WithTimeout(ctx, interval)
+		r.CheckReplicas(checkCtx)
+		cancel()
+	}
+}
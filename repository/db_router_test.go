@@ -0,0 +1,147 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/plar/rentals-api/auth"
+	"github.com/plar/rentals-api/config"
+	"github.com/plar/rentals-api/domain"
+	"github.com/plar/rentals-api/repository"
+)
+
+var findAllQuery = regexp.QuoteMeta(`SELECT * FROM "rentals" WHERE "rentals"."deleted_at" IS NULL`)
+
+func mockGorm(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{DriverName: "postgres", Conn: sqlDB}), &gorm.Config{
+		Logger:               logger.Discard,
+		DisableAutomaticPing: true,
+	})
+	require.NoError(t, err)
+	return db, mock
+}
+
+func TestDBRouterReads(t *testing.T) {
+	primary, primaryMock := mockGorm(t)
+	replica, replicaMock := mockGorm(t)
+	router := repository.NewDBRouter(primary, []repository.Replica{{Name: "replica-1", DB: replica, Weight: 1}}, time.Minute, nil)
+	repo := repository.NewRoutedRentalRepository(router, config.Default().Repository, nil)
+
+	t.Run("reads go to the replica", func(t *testing.T) {
+		replicaMock.ExpectQuery(findAllQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		_, err := repo.FindAll(context.Background())
+		assert.NoError(t, err)
+		assert.NoError(t, replicaMock.ExpectationsWereMet())
+		assert.NoError(t, primaryMock.ExpectationsWereMet())
+	})
+
+	t.Run("primary reads", func(t *testing.T) {
+		primaryMock.ExpectQuery(findAllQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		_, err := repo.FindAll(domain.WithPrimaryReads(context.Background()))
+		assert.NoError(t, err)
+		assert.NoError(t, primaryMock.ExpectationsWereMet())
+	})
+
+	t.Run("read your writes", func(t *testing.T) {
+		writer := auth.NewContext(context.Background(), auth.Identity{Subject: "7", Roles: []string{"owner"}})
+		primaryMock.ExpectBegin()
+		primaryMock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "rentals"`)).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(31))
+		primaryMock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "rental_revisions"`)).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		primaryMock.ExpectCommit()
+		assert.NoError(t, repo.Upsert(writer, []domain.Rental{{Name: "Maupin: Vanagon Camper", User: domain.User{ID: 7}}}))
+
+		// the writer reads the primary, the other callers keep reading the replica
+		assert.Same(t, primary, router.Reader(writer))
+		other := auth.NewContext(context.Background(), auth.Identity{Subject: "8"})
+		assert.Same(t, replica, router.Reader(other))
+		assert.Same(t, replica, router.Reader(context.Background()))
+	})
+
+	t.Run("failed replica falls back to the primary", func(t *testing.T) {
+		replicaMock.ExpectQuery(findAllQuery).WillReturnError(errors.New("connection refused"))
+		primaryMock.ExpectQuery(findAllQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		_, err := repo.FindAll(context.Background())
+		assert.NoError(t, err)
+		assert.NoError(t, replicaMock.ExpectationsWereMet())
+		assert.NoError(t, primaryMock.ExpectationsWereMet())
+
+		// no reads go to the replica until it answers a health check
+		assert.Same(t, primary, router.Reader(context.Background()))
+		replicaMock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		router.CheckReplicas(context.Background())
+		assert.Same(t, primary, router.Reader(context.Background()))
+
+		replicaMock.ExpectPing()
+		router.CheckReplicas(context.Background())
+		assert.Same(t, replica, router.Reader(context.Background()))
+		assert.NoError(t, replicaMock.ExpectationsWereMet())
+	})
+
+	t.Run("not found is not a failure", func(t *testing.T) {
+		replicaMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "rentals" WHERE "rentals"."id" = $1`)).
+			WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		_, err := repo.FindByID(context.Background(), 1)
+		assert.ErrorIs(t, err, domain.ErrRentalNotFound)
+		assert.Same(t, replica, router.Reader(context.Background()))
+	})
+
+	t.Run("stream errors of fn are not retried", func(t *testing.T) {
+		replicaMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "rentals"`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(1, 1))
+		replicaMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users"`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+		errStop := errors.New("client went away")
+		err := repo.StreamByFilter(context.Background(), domain.RentalFindFilter{}, func(domain.Rental) error {
+			return errStop
+		})
+		assert.ErrorIs(t, err, errStop)
+		assert.NoError(t, replicaMock.ExpectationsWereMet())
+		assert.NoError(t, primaryMock.ExpectationsWereMet())
+		assert.Same(t, replica, router.Reader(context.Background()))
+	})
+}
+
+func TestDBRouterWeights(t *testing.T) {
+	primary, _ := mockGorm(t)
+	heavy, _ := mockGorm(t)
+	light, _ := mockGorm(t)
+	router := repository.NewDBRouter(primary, []repository.Replica{
+		{Name: "heavy", DB: heavy, Weight: 3},
+		{Name: "light", DB: light, Weight: 1},
+	}, 0, nil)
+
+	picks := map[*gorm.DB]int{}
+	for i := 0; i < 4000; i++ {
+		picks[router.Reader(context.Background())]++
+	}
+	assert.Zero(t, picks[primary])
+	assert.InDelta(t, 3000, picks[heavy], 300)
+	assert.InDelta(t, 1000, picks[light], 300)
+}
+
+func TestDBRouterWithoutReplicas(t *testing.T) {
+	primary, _ := mockGorm(t)
+	router := repository.NewDBRouter(primary, nil, time.Minute, nil)
+	assert.Same(t, primary, router.Reader(context.Background()))
+	assert.Same(t, primary, router.Primary())
+}
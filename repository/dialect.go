@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// dialect is the SQL of the repository which differs between the databases
+type dialect interface {
+	// near keeps the rentals within radius meters of lat, lng
+	near(query *gorm.DB, lat, lng, radius float64) *gorm.DB
+	// syncRentalIDs moves the ID sequence of the rentals past the IDs written explicitly, so the next
+	// inserts won't collide with them
+	syncRentalIDs(tx *gorm.DB) error
+}
+
+// dialectOf returns the dialect of the database of db, PostgreSQL unless it is SQLite. The PostGIS one of
+// repository.spatial needs the location column, which is added by the migrations on the servers with PostGIS.
+func dialectOf(db *gorm.DB, spatial string, logger *zap.Logger) dialect {
+	if db.Dialector.Name() == sqliteDialectorName {
+		return sqliteDialect{}
+	}
+	if spatial == "postgis" {
+		if db.Migrator().HasColumn(&Rental{}, "location") {
+			return postgisDialect{}
+		}
+		logger.Warn("The rentals table has no location column, the near filter falls back to earthdistance")
+	}
+	return postgresDialect{}
+}
+
+// postgresDialect measures the distances with the earthdistance extension
+type postgresDialect struct{}
+
+var _ dialect = postgresDialect{}
+
+func (postgresDialect) near(query *gorm.DB, lat, lng, radius float64) *gorm.DB {
+	return query.Where("earth_distance(ll_to_earth(lat, lng), ll_to_earth(?, ?)) <= ?", lat, lng, radius)
+}
+
+func (postgresDialect) syncRentalIDs(tx *gorm.DB) error {
+	return tx.Exec("SELECT setval(pg_get_serial_sequence('rentals', 'id'), (SELECT MAX(id) FROM rentals))").Error
+}
+
+// postgisDialect filters on the location column, a geography point generated from lat and lng, ST_DWithin
+// is the form of ST_Distance(...) <= radius which uses its GiST index. The distances are measured on a sphere
+// like earthdistance, whose radius is 0.1% larger.
+type postgisDialect struct {
+	postgresDialect
+}
+
+var _ dialect = postgisDialect{}
+
+func (postgisDialect) near(query *gorm.DB, lat, lng, radius float64) *gorm.DB {
+	return query.Where("ST_DWithin(location, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, ?, false)", lng, lat, radius)
+}
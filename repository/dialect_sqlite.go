@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+
+	sqlite "github.com/glebarez/go-sqlite"
+	"gorm.io/gorm"
+
+	"github.com/plar/rentals-api/domain"
+)
+
+const sqliteDialectorName = "sqlite"
+
+// metersPerDegree is the length of a degree of latitude on the sphere of domain.HaversineDistance
+const metersPerDegree = domain.EarthRadiusMeters * math.Pi / 180
+
+func init() {
+	// the functions are added to the connections opened after the registration
+	sqlite.MustRegisterDeterministicScalarFunction("haversine_distance", 4, haversineDistance)
+}
+
+// haversineDistance is the SQL function haversine_distance(lat1, lng1, lat2, lng2), the distance in meters
+// between two points, NULL when a coordinate is NULL
+func haversineDistance(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	coords := make([]float64, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case float64:
+			coords[i] = v
+		case int64:
+			coords[i] = float64(v)
+		case nil:
+			return nil, nil
+		default:
+			return nil, fmt.Errorf("haversine_distance: argument %d is %T, not a number", i+1, arg)
+		}
+	}
+	return domain.HaversineDistance(coords[0], coords[1], coords[2], coords[3]), nil
+}
+
+// sqliteDialect measures the distances with haversine_distance, the rentals outside of the bounding box
+// of the circle are left out first with the coordinates index
+type sqliteDialect struct{}
+
+var _ dialect = sqliteDialect{}
+
+func (sqliteDialect) near(query *gorm.DB, lat, lng, radius float64) *gorm.DB {
+	latDelta := radius / metersPerDegree
+	query = query.Where("lat BETWEEN ? AND ?", lat-latDelta, lat+latDelta)
+	// the degrees of longitude shrink with the cosine of the latitude, near a pole or across the
+	// antimeridian the box would wrap around, the distance alone decides there
+	if maxLat := math.Abs(lat) + latDelta; maxLat < 90 {
+		lngDelta := latDelta / math.Cos(maxLat*math.Pi/180)
+		if lng-lngDelta >= -180 && lng+lngDelta <= 180 {
+			query = query.Where("lng BETWEEN ? AND ?", lng-lngDelta, lng+lngDelta)
+		}
+	}
+	return query.Where("haversine_distance(lat, lng, ?, ?) <= ?", lat, lng, radius)
+}
+
+// syncRentalIDs has nothing to do, the AUTOINCREMENT sequence follows the largest ID ever inserted
+func (sqliteDialect) syncRentalIDs(*gorm.DB) error {
+	return nil
+}
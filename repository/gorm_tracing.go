@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+
+	"github.com/plar/rentals-api/tracing"
+)
+
+const gormSpanKey = "tracing:span"
+
+type gormTracing struct {
+	tracer trace.Tracer
+}
+
+// NewGormTracing returns a GORM plugin which creates a client span for every SQL statement, register
+// it with db.Use. The statement is recorded without its bind variables.
+func NewGormTracing(tp trace.TracerProvider) gorm.Plugin {
+	return &gormTracing{tracer: tp.Tracer(tracerName)}
+}
+
+func (p *gormTracing) Name() string {
+	return "rentals:tracing"
+}
+
+func (p *gormTracing) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("tracing:before_create", p.before("create")),
+		cb.Create().After("gorm:create").Register("tracing:after_create", p.after),
+		cb.Query().Before("gorm:query").Register("tracing:before_query", p.before("query")),
+		cb.Query().After("gorm:query").Register("tracing:after_query", p.after),
+		cb.Update().Before("gorm:update").Register("tracing:before_update", p.before("update")),
+		cb.Update().After("gorm:update").Register("tracing:after_update", p.after),
+		cb.Delete().Before("gorm:delete").Register("tracing:before_delete", p.before("delete")),
+		cb.Delete().After("gorm:delete").Register("tracing:after_delete", p.after),
+		cb.Row().Before("gorm:row").Register("tracing:before_row", p.before("row")),
+		cb.Row().After("gorm:row").Register("tracing:after_row", p.after),
+		cb.Raw().Before("gorm:raw").Register("tracing:before_raw", p.before("raw")),
+		cb.Raw().After("gorm:raw").Register("tracing:after_raw", p.after),
+	)
+}
+
+func (p *gormTracing) before(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		_, span := p.tracer.Start(db.Statement.Context, "gorm."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBSystemKey.String(db.Dialector.Name())),
+		)
+		db.InstanceSet(gormSpanKey, span)
+	}
+}
+
+func (p *gormTracing) after(db *gorm.DB) {
+	v, ok := db.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	span := v.(trace.Span)
+
+	span.SetAttributes(
+		semconv.DBStatement(db.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", db.Statement.RowsAffected),
+	)
+	if db.Statement.Table != "" {
+		span.SetAttributes(semconv.DBSQLTable(db.Statement.Table))
+	}
+
+	err := db.Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// not found is an expected outcome rather than a failure of the query
+		err = nil
+	}
+	tracing.End(span, err)
+}
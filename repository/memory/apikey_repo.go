@@ -0,0 +1,71 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/plar/rentals-api/domain"
+)
+
+// APIKeyRepository keeps the API keys in memory, they are lost when the process exits. It is safe for
+// concurrent use.
+type APIKeyRepository struct {
+	mu     sync.RWMutex
+	keys   map[string]domain.APIKey
+	lastID uint
+}
+
+var _ domain.APIKeyRepository = (*APIKeyRepository)(nil)
+
+func NewAPIKeyRepository() *APIKeyRepository {
+	return &APIKeyRepository{keys: make(map[string]domain.APIKey)}
+}
+
+func (r *APIKeyRepository) FindByHash(ctx context.Context, hash string) (domain.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, key := range r.keys {
+		if key.Hash == hash {
+			return key, nil
+		}
+	}
+	return domain.APIKey{}, domain.ErrAPIKeyNotFound
+}
+
+func (r *APIKeyRepository) Create(ctx context.Context, key domain.APIKey) (domain.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastID++
+	key.ID = r.lastID
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+	r.keys[key.Prefix] = key
+	return key, nil
+}
+
+func (r *APIKeyRepository) List(ctx context.Context) ([]domain.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	keys := make([]domain.APIKey, 0, len(r.keys))
+	for _, key := range r.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+func (r *APIKeyRepository) Revoke(ctx context.Context, prefix string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key, ok := r.keys[prefix]
+	if !ok || key.RevokedAt != nil {
+		return domain.ErrAPIKeyNotFound
+	}
+	now := time.Now()
+	key.RevokedAt = &now
+	r.keys[prefix] = key
+	return nil
+}
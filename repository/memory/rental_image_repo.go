@@ -0,0 +1,117 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/plar/rentals-api/domain"
+)
+
+// RentalImageRepository keeps the images of the rentals in memory, unlike the database it does not check
+// that the rentals exist. It is safe for concurrent use.
+type RentalImageRepository struct {
+	mu sync.RWMutex
+	// images are the images of a rental by rental ID, in position order
+	images map[uint][]domain.RentalImage
+	lastID uint
+}
+
+var _ domain.RentalImageRepository = (*RentalImageRepository)(nil)
+
+func NewRentalImageRepository() *RentalImageRepository {
+	return &RentalImageRepository{images: make(map[uint][]domain.RentalImage)}
+}
+
+func (r *RentalImageRepository) FindByRentalIDs(ctx context.Context, ids []uint) (map[uint][]domain.RentalImage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	images := make(map[uint][]domain.RentalImage)
+	for _, id := range ids {
+		if rentalImages := r.images[id]; len(rentalImages) > 0 {
+			images[id] = append([]domain.RentalImage(nil), rentalImages...)
+		}
+	}
+	return images, nil
+}
+
+func (r *RentalImageRepository) Add(ctx context.Context, image domain.RentalImage) (domain.RentalImage, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.RentalImage{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastID++
+	image.ID = r.lastID
+	image.Position = len(r.images[image.RentalID]) + 1
+	image.URL = ""
+	image.Variants = append([]domain.ImageVariant(nil), image.Variants...)
+	r.images[image.RentalID] = append(r.images[image.RentalID], image)
+	return image, nil
+}
+
+func (r *RentalImageRepository) Delete(ctx context.Context, rentalID, id uint) (domain.RentalImage, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.RentalImage{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	images := r.images[rentalID]
+	for i, image := range images {
+		if image.ID != id {
+			continue
+		}
+		kept := append(append([]domain.RentalImage(nil), images[:i]...), images[i+1:]...)
+		for j := i; j < len(kept); j++ {
+			kept[j].Position = j + 1
+		}
+		r.set(rentalID, kept)
+		return image, nil
+	}
+	return domain.RentalImage{}, domain.ErrImageNotFound
+}
+
+func (r *RentalImageRepository) Reorder(ctx context.Context, rentalID uint, ids []uint) ([]domain.RentalImage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	images := r.images[rentalID]
+	positions, err := domain.ImagePositions(images, ids, func(i domain.RentalImage) uint { return i.ID })
+	if err != nil {
+		return nil, err
+	}
+	reordered := make([]domain.RentalImage, len(images))
+	for _, image := range images {
+		image.Position = positions[image.ID]
+		reordered[image.Position-1] = image
+	}
+	r.set(rentalID, reordered)
+	return append([]domain.RentalImage(nil), reordered...), nil
+}
+
+func (r *RentalImageRepository) DeleteAll(ctx context.Context, rentalID uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.images, rentalID)
+	return nil
+}
+
+// set replaces the images of a rental
+func (r *RentalImageRepository) set(rentalID uint, images []domain.RentalImage) {
+	if len(images) == 0 {
+		delete(r.images, rentalID)
+		return
+	}
+	r.images[rentalID] = images
+}
@@ -0,0 +1,506 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/plar/rentals-api/auth"
+	"github.com/plar/rentals-api/config"
+	"github.com/plar/rentals-api/domain"
+)
+
+// revision is a recorded change along with the state of the rental after it
+type revision struct {
+	domain.RentalRevision
+	snapshot domain.Rental
+}
+
+// RentalRepository keeps the rentals, their owners and revisions in memory. It follows the semantics of
+// the PostgreSQL repository: rentals are soft-deleted, every write records a revision and increments the
+// version, and the owner of a rental must exist. It is safe for concurrent use.
+type RentalRepository struct {
+	cfg config.RepositoryConfig
+
+	mu        sync.RWMutex
+	rentals   map[uint]domain.Rental
+	users     map[int]domain.User
+	revisions []revision
+	// lastID and lastRevisionID are the sequences of the IDs
+	lastID         uint
+	lastRevisionID uint
+}
+
+var _ domain.RentalRepository = (*RentalRepository)(nil)
+
+func NewRentalRepository(cfg config.RepositoryConfig) *RentalRepository {
+	return &RentalRepository{
+		cfg:     cfg,
+		rentals: make(map[uint]domain.Rental),
+		users:   make(map[int]domain.User),
+	}
+}
+
+// AddUsers adds or replaces users, the owners of the rentals
+func (r *RentalRepository) AddUsers(users ...domain.User) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range users {
+		r.users[user.ID] = user
+	}
+}
+
+// Add stores rentals as they are, like the rows of a fixture: no revision is recorded, the rentals without
+// ID get the next one and the ones without version the first one. Their owners must exist.
+func (r *RentalRepository) Add(rentals ...domain.Rental) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.checkOwners(rentals); err != nil {
+		return err
+	}
+	for _, rental := range rentals {
+		if rental.ID == 0 {
+			rental.ID = r.lastID + 1
+		}
+		if rental.Version == 0 {
+			rental.Version = 1
+		}
+		r.store(rental)
+	}
+	return nil
+}
+
+// store saves a copy of the rental with its owner kept by ID
+func (r *RentalRepository) store(rental domain.Rental) {
+	rental.User = domain.User{ID: rental.User.ID}
+	rental.DeletedAt = copyTime(rental.DeletedAt)
+	r.rentals[rental.ID] = rental
+	if rental.ID > r.lastID {
+		r.lastID = rental.ID
+	}
+}
+
+// load returns a copy of a stored rental with the current names of its owner
+func (r *RentalRepository) load(rental domain.Rental) domain.Rental {
+	if user, ok := r.users[rental.User.ID]; ok {
+		rental.User = user
+	}
+	rental.DeletedAt = copyTime(rental.DeletedAt)
+	return rental
+}
+
+func (r *RentalRepository) checkOwners(rentals []domain.Rental) error {
+	for _, rental := range rentals {
+		if _, ok := r.users[rental.User.ID]; !ok {
+			return fmt.Errorf("user %d of rental %d does not exist", rental.User.ID, rental.ID)
+		}
+	}
+	return nil
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
+
+// selectRentals returns the rentals which are not deleted, or the deleted ones, matching the selection
+// part of filter in ID order
+func (r *RentalRepository) selectRentals(filter domain.RentalFindFilter, deleted bool) []domain.Rental {
+	var ids map[uint]bool
+	if filterIDs, ok := filter.RentalIDs(); ok {
+		ids = make(map[uint]bool, len(filterIDs))
+		for _, id := range filterIDs {
+			ids[uint(id)] = true
+		}
+	}
+	priceMin, priceMinOk := filter.PriceMin()
+	priceMax, priceMaxOk := filter.PriceMax()
+	near, nearOk := filter.Coords()
+	radius := r.cfg.NearRadiusMiles * domain.MetersPerMile
+
+	var rentals []domain.Rental
+	for _, rental := range r.rentals {
+		switch {
+		case (rental.DeletedAt != nil) != deleted:
+		case ids != nil && !ids[rental.ID]:
+		case priceMinOk && rental.Price.Day < int(priceMin):
+		case priceMaxOk && rental.Price.Day > int(priceMax):
+		case nearOk && domain.HaversineDistance(rental.Location.Lat, rental.Location.Lng, near[0], near[1]) > radius:
+		default:
+			rentals = append(rentals, r.load(rental))
+		}
+	}
+	sort.Slice(rentals, func(i, j int) bool { return rentals[i].ID < rentals[j].ID })
+	return rentals
+}
+
+// sortFields are the values of the sort fields, they are named after the columns of the PostgreSQL repository
+var sortFields = map[string]func(domain.Rental) int{
+	domain.SortPriceAsc.Field(): func(r domain.Rental) int { return r.Price.Day },
+	domain.SortYearAsc.Field():  func(r domain.Rental) int { return r.Year },
+}
+
+// page sorts the rentals, the ties in ID order, and returns the page of the view filter
+func page[T any](items []T, filter domain.ViewFilter, less func(a, b T) bool) []T {
+	if less != nil {
+		sort.SliceStable(items, func(i, j int) bool { return less(items[i], items[j]) })
+	}
+	if offset, ok := filter.Offset(); ok {
+		if int(offset) >= len(items) {
+			return []T{}
+		}
+		items = items[offset:]
+	}
+	if limit, ok := filter.Limit(); ok && int(limit) < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
+func rentalLess(filter domain.ViewFilter) (func(a, b domain.Rental) bool, error) {
+	s, ok := filter.Sort()
+	if !ok {
+		return nil, nil
+	}
+	field, ok := sortFields[s.Field()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported sort field %q", s.Field())
+	}
+	if s.IsDesc() {
+		return func(a, b domain.Rental) bool { return field(a) > field(b) }, nil
+	}
+	return func(a, b domain.Rental) bool { return field(a) < field(b) }, nil
+}
+
+func (r *RentalRepository) findByFilter(filter domain.RentalFindFilter, deleted bool, less func(a, b domain.Rental) bool) domain.Response[domain.Rental] {
+	r.mu.RLock()
+	rentals := r.selectRentals(filter, deleted)
+	r.mu.RUnlock()
+
+	total := int64(len(rentals))
+	items := page(rentals, &filter, less)
+	return domain.NewResponse(&filter, total, items, func(rs []domain.Rental) []domain.Rental {
+		if rs == nil {
+			return []domain.Rental{}
+		}
+		return rs
+	})
+}
+
+func (r *RentalRepository) FindAll(ctx context.Context) ([]domain.Rental, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rentals := r.selectRentals(domain.RentalFindFilter{}, false)
+	if rentals == nil {
+		rentals = []domain.Rental{}
+	}
+	return rentals, nil
+}
+
+func (r *RentalRepository) FindByID(ctx context.Context, id uint) (domain.Rental, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Rental{}, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rental, ok := r.rentals[id]
+	if !ok || rental.DeletedAt != nil {
+		return domain.Rental{}, domain.ErrRentalNotFound
+	}
+	return r.load(rental), nil
+}
+
+func (r *RentalRepository) FindByIDs(ctx context.Context, ids []uint) ([]domain.Rental, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	filterIDs := make([]int, len(ids))
+	for i, id := range ids {
+		filterIDs[i] = int(id)
+	}
+	filter, _ := domain.NewRentalFilterBuilder().WithRentalIDs(filterIDs).Build()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rentals := []domain.Rental{}
+	if len(ids) > 0 {
+		rentals = append(rentals, r.selectRentals(filter, false)...)
+	}
+	return rentals, nil
+}
+
+func (r *RentalRepository) FindByFilter(ctx context.Context, filter domain.RentalFindFilter) (domain.Response[domain.Rental], error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Response[domain.Rental]{}, err
+	}
+	less, err := rentalLess(&filter)
+	if err != nil {
+		return domain.Response[domain.Rental]{}, err
+	}
+	return r.findByFilter(filter, false, less), nil
+}
+
+// StreamByFilter visits a snapshot of the matching rentals, fn may call the repository
+func (r *RentalRepository) StreamByFilter(ctx context.Context, filter domain.RentalFindFilter, fn func(domain.Rental) error) error {
+	r.mu.RLock()
+	rentals := r.selectRentals(filter, false)
+	r.mu.RUnlock()
+
+	for _, rental := range rentals {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(rental); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// actor is the subject of the caller identity, the writes without one are made by the system
+func actor(ctx context.Context) string {
+	if id, ok := auth.FromContext(ctx); ok && id.Subject != "" {
+		return id.Subject
+	}
+	return "system"
+}
+
+// record appends a revision of the change from old to new, nothing when no field changed. new holds
+// the names of its owner like the loaded rentals.
+func (r *RentalRepository) record(ctx context.Context, action domain.RevisionAction, old *domain.Rental, new domain.Rental, at time.Time) {
+	diff := domain.DiffRentals(old, new)
+	if len(diff) == 0 {
+		return
+	}
+	r.lastRevisionID++
+	r.revisions = append(r.revisions, revision{
+		RentalRevision: domain.RentalRevision{
+			ID:        r.lastRevisionID,
+			RentalID:  new.ID,
+			Action:    action,
+			Actor:     actor(ctx),
+			ChangedAt: at,
+			Diff:      diff,
+		},
+		snapshot: domain.RevisionState(new),
+	})
+}
+
+// Upsert overwrites the existing rentals, the deleted ones included which are restored like by the
+// PostgreSQL upsert, and inserts the other ones. Nothing is written when an owner does not exist.
+func (r *RentalRepository) Upsert(ctx context.Context, rentals []domain.Rental) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.checkOwners(rentals); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var inserts []domain.Rental
+	for _, rental := range rentals {
+		if rental.ID == 0 {
+			// the rentals without ID get theirs once the explicit IDs are taken, like with the sequence
+			inserts = append(inserts, rental)
+			continue
+		}
+		rental.DeletedAt = nil
+		old, ok := r.rentals[rental.ID]
+		if !ok {
+			rental.Version = 1
+			r.store(rental)
+			r.record(ctx, domain.RevisionCreate, nil, r.load(r.rentals[rental.ID]), now)
+			continue
+		}
+		old = r.load(old)
+		rental.Version = old.Version + 1
+		r.store(rental)
+		r.record(ctx, domain.RevisionUpdate, &old, r.load(r.rentals[rental.ID]), now)
+	}
+	for _, rental := range inserts {
+		rental.ID, rental.Version, rental.DeletedAt = r.lastID+1, 1, nil
+		r.store(rental)
+		r.record(ctx, domain.RevisionCreate, nil, r.load(r.rentals[rental.ID]), now)
+	}
+	return nil
+}
+
+func (r *RentalRepository) Update(ctx context.Context, rental domain.Rental) (domain.Rental, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Rental{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old, ok := r.rentals[rental.ID]
+	if !ok || old.DeletedAt != nil {
+		return domain.Rental{}, domain.ErrRentalNotFound
+	}
+	if old.Version != rental.Version {
+		return domain.Rental{}, &domain.ConflictError{ID: rental.ID, Version: rental.Version}
+	}
+	if err := r.checkOwners([]domain.Rental{rental}); err != nil {
+		return domain.Rental{}, err
+	}
+
+	old = r.load(old)
+	rental.Version, rental.DeletedAt = old.Version+1, nil
+	r.store(rental)
+	updated := r.load(r.rentals[rental.ID])
+	r.record(ctx, domain.RevisionUpdate, &old, updated, time.Now())
+	return updated, nil
+}
+
+func (r *RentalRepository) FindDeleted(ctx context.Context, filter domain.RentalFindFilter) (domain.Response[domain.Rental], error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Response[domain.Rental]{}, err
+	}
+	less, err := rentalLess(&filter)
+	if err != nil {
+		return domain.Response[domain.Rental]{}, err
+	}
+	if less == nil {
+		less = func(a, b domain.Rental) bool { return a.DeletedAt.After(*b.DeletedAt) }
+	}
+	return r.findByFilter(filter, true, less), nil
+}
+
+func (r *RentalRepository) Restore(ctx context.Context, id uint) (domain.Rental, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Rental{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old, ok := r.rentals[id]
+	if !ok || old.DeletedAt == nil {
+		return domain.Rental{}, domain.ErrRentalNotFound
+	}
+	old = r.load(old)
+	rental := old
+	rental.Version, rental.DeletedAt = old.Version+1, nil
+	r.store(rental)
+	restored := r.load(r.rentals[id])
+	r.record(ctx, domain.RevisionRestore, &old, restored, time.Now())
+	return restored, nil
+}
+
+// Delete soft-deletes a rental, the API does not delete rentals, it is there for the fixtures and tests
+func (r *RentalRepository) Delete(id uint, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rental, ok := r.rentals[id]
+	if !ok || rental.DeletedAt != nil {
+		return domain.ErrRentalNotFound
+	}
+	rental.DeletedAt = &at
+	r.store(rental)
+	return nil
+}
+
+func (r *RentalRepository) Purge(ctx context.Context, id uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rental, ok := r.rentals[id]
+	if !ok || rental.DeletedAt == nil {
+		return domain.ErrRentalNotFound
+	}
+	r.remove(map[uint]bool{id: true})
+	return nil
+}
+
+func (r *RentalRepository) PurgeDeleted(ctx context.Context, before time.Time) ([]uint, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make(map[uint]bool)
+	var purged []uint
+	for id, rental := range r.rentals {
+		if rental.DeletedAt != nil && rental.DeletedAt.Before(before) {
+			ids[id] = true
+			purged = append(purged, id)
+		}
+	}
+	r.remove(ids)
+	sort.Slice(purged, func(i, j int) bool { return purged[i] < purged[j] })
+	return purged, nil
+}
+
+// remove deletes the rentals of ids and their revisions for good
+func (r *RentalRepository) remove(ids map[uint]bool) {
+	for id := range ids {
+		delete(r.rentals, id)
+	}
+	kept := r.revisions[:0]
+	for _, rev := range r.revisions {
+		if !ids[rev.RentalID] {
+			kept = append(kept, rev)
+		}
+	}
+	r.revisions = kept
+}
+
+func (r *RentalRepository) FindRevisions(ctx context.Context, id uint, filter domain.ViewFilter) (domain.Response[domain.RentalRevision], error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Response[domain.RentalRevision]{}, err
+	}
+	r.mu.RLock()
+	revisions := []domain.RentalRevision{}
+	for _, rev := range r.revisions {
+		if rev.RentalID == id {
+			revisions = append(revisions, rev.RentalRevision)
+		}
+	}
+	r.mu.RUnlock()
+
+	total := int64(len(revisions))
+	items := page(revisions, filter, func(a, b domain.RentalRevision) bool {
+		if !a.ChangedAt.Equal(b.ChangedAt) {
+			return a.ChangedAt.After(b.ChangedAt)
+		}
+		return a.ID > b.ID
+	})
+	return domain.NewResponse(filter, total, items, func(rs []domain.RentalRevision) []domain.RentalRevision { return rs }), nil
+}
+
+func (r *RentalRepository) FindAsOf(ctx context.Context, id uint, at time.Time) (domain.Rental, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Rental{}, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var last *revision
+	for i := range r.revisions {
+		rev := &r.revisions[i]
+		if rev.RentalID != id || rev.ChangedAt.After(at) {
+			continue
+		}
+		if last == nil || !rev.ChangedAt.Before(last.ChangedAt) {
+			last = rev
+		}
+	}
+	if last == nil || last.snapshot.DeletedAt != nil {
+		return domain.Rental{}, domain.ErrRentalNotFound
+	}
+	// the revisions keep the owner by ID, the names are the current ones
+	return r.load(last.snapshot), nil
+}
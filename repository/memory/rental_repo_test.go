@@ -0,0 +1,219 @@
+package memory_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/plar/rentals-api/auth"
+	"github.com/plar/rentals-api/config"
+	"github.com/plar/rentals-api/domain"
+	"github.com/plar/rentals-api/repository/memory"
+	"github.com/plar/rentals-api/repository/repositorytest"
+)
+
+func TestContract(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T, cfg config.RepositoryConfig, fixture repositorytest.Fixture) domain.RentalRepository {
+		repo := memory.NewRentalRepository(cfg)
+		repo.AddUsers(fixture.Users...)
+		require.NoError(t, repo.Add(fixture.Rentals...))
+		return repo
+	})
+}
+
+func newRepo(t *testing.T) *memory.RentalRepository {
+	repo := memory.NewRentalRepository(config.Default().Repository)
+	repo.AddUsers(domain.User{ID: 1, FirstName: "John"}, domain.User{ID: 2, FirstName: "Jane"})
+	require.NoError(t, repo.Add(
+		domain.Rental{ID: 1, Name: "Costa Mesa", Price: domain.Price{Day: 16900}, Year: 1978, Location: domain.Location{Lat: 33.64, Lng: -117.93}, User: domain.User{ID: 1}},
+		domain.Rental{ID: 2, Name: "Portland", Price: domain.Price{Day: 15000}, Year: 1989, Location: domain.Location{Lat: 45.51, Lng: -122.68}, User: domain.User{ID: 2}},
+		domain.Rental{ID: 3, Name: "San Diego", Price: domain.Price{Day: 18000}, Year: 1984, Location: domain.Location{Lat: 32.83, Lng: -117.28}, User: domain.User{ID: 1}},
+		domain.Rental{ID: 4, Name: "Salt Lake City", Price: domain.Price{Day: 8900}, Year: 2016, Location: domain.Location{Lat: 40.73, Lng: -111.92}, User: domain.User{ID: 2}},
+	))
+	return repo
+}
+
+func names(rentals []domain.Rental) []string {
+	names := make([]string, len(rentals))
+	for i, rental := range rentals {
+		names[i] = rental.Name
+	}
+	return names
+}
+
+func TestFindByFilter(t *testing.T) {
+	repo := newRepo(t)
+	build := func(b *domain.RentalFindFilterBuilder) domain.RentalFindFilter {
+		filter, err := b.Build()
+		require.NoError(t, err)
+		return filter
+	}
+
+	tests := []struct {
+		name   string
+		filter domain.RentalFindFilter
+		want   []string
+		total  uint
+	}{
+		{"no filter", build(domain.NewRentalFilterBuilder()), []string{"Costa Mesa", "Portland", "San Diego", "Salt Lake City"}, 4},
+		{"price range is inclusive", build(domain.NewRentalFilterBuilder().WithPriceMin(15000).WithPriceMax(16900)), []string{"Costa Mesa", "Portland"}, 2},
+		{"ids", build(domain.NewRentalFilterBuilder().WithRentalIDs([]int{4, 2, 99})), []string{"Portland", "Salt Lake City"}, 2},
+		// San Diego is 67 miles away from Costa Mesa, the other ones farther than 100 miles
+		{"near", build(domain.NewRentalFilterBuilder().WithCoords([2]float64{33.64, -117.93})), []string{"Costa Mesa", "San Diego"}, 2},
+		{"sort price desc", build(domain.NewRentalFilterBuilder().WithSort(domain.SortPriceDesc)), []string{"San Diego", "Costa Mesa", "Portland", "Salt Lake City"}, 4},
+		{"sort year", build(domain.NewRentalFilterBuilder().WithSort(domain.SortYearAsc)), []string{"Costa Mesa", "San Diego", "Portland", "Salt Lake City"}, 4},
+		{"page", build(domain.NewRentalFilterBuilder().WithSort(domain.SortPriceAsc).WithLimit(2).WithOffset(1)), []string{"Portland", "Costa Mesa"}, 4},
+		{"offset past the end", build(domain.NewRentalFilterBuilder().WithOffset(10)), []string{}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := repo.FindByFilter(context.Background(), tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, names(response.Items))
+			assert.Equal(t, tt.total, response.Paginator.TotalItems)
+		})
+	}
+}
+
+func TestFindByID(t *testing.T) {
+	repo := newRepo(t)
+
+	rental, err := repo.FindByID(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, "Jane", rental.User.FirstName)
+	assert.Equal(t, uint(1), rental.Version)
+
+	_, err = repo.FindByID(context.Background(), 99)
+	assert.ErrorIs(t, err, domain.ErrRentalNotFound)
+
+	// a deleted rental is not found but listed as deleted
+	require.NoError(t, repo.Delete(2, time.Now()))
+	_, err = repo.FindByID(context.Background(), 2)
+	assert.ErrorIs(t, err, domain.ErrRentalNotFound)
+	deleted, err := repo.FindDeleted(context.Background(), domain.RentalFindFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Portland"}, names(deleted.Items))
+
+	rentals, err := repo.FindByIDs(context.Background(), []uint{1, 2, 3})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Costa Mesa", "San Diego"}, names(rentals))
+}
+
+func TestStreamByFilter(t *testing.T) {
+	repo := newRepo(t)
+	filter, err := domain.NewRentalFilterBuilder().WithPriceMin(10000).WithLimit(1).Build()
+	require.NoError(t, err)
+
+	// the view part of the filter is ignored and fn may call the repository
+	var visited []string
+	err = repo.StreamByFilter(context.Background(), filter, func(r domain.Rental) error {
+		_, err := repo.FindByID(context.Background(), r.ID)
+		visited = append(visited, r.Name)
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Costa Mesa", "Portland", "San Diego"}, visited)
+}
+
+func TestWrites(t *testing.T) {
+	repo := newRepo(t)
+	ctx := auth.NewContext(context.Background(), auth.Identity{Subject: "1"})
+
+	// the upsert updates rental 1 and inserts a rental after the last ID
+	err := repo.Upsert(ctx, []domain.Rental{
+		{ID: 1, Name: "Costa Mesa", Price: domain.Price{Day: 15900}, Year: 1978, Location: domain.Location{Lat: 33.64, Lng: -117.93}, User: domain.User{ID: 1}},
+		{Name: "New", User: domain.User{ID: 2}},
+	})
+	require.NoError(t, err)
+	rental, err := repo.FindByID(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 15900, rental.Price.Day)
+	assert.Equal(t, uint(2), rental.Version)
+	inserted, err := repo.FindByID(ctx, 5)
+	require.NoError(t, err)
+	assert.Equal(t, "New", inserted.Name)
+
+	// nothing is written when an owner does not exist
+	err = repo.Upsert(ctx, []domain.Rental{{ID: 1, Name: "Changed", User: domain.User{ID: 1}}, {Name: "Orphan", User: domain.User{ID: 42}}})
+	assert.Error(t, err)
+	rental, err = repo.FindByID(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "Costa Mesa", rental.Name)
+
+	// the update is conditional on the version
+	rental.Name = "Renamed"
+	updated, err := repo.Update(ctx, rental)
+	require.NoError(t, err)
+	assert.Equal(t, uint(3), updated.Version)
+	assert.Equal(t, "John", updated.User.FirstName)
+	_, err = repo.Update(ctx, rental)
+	assert.ErrorIs(t, err, domain.ErrConflict)
+	_, err = repo.Update(ctx, domain.Rental{ID: 99, Version: 1})
+	assert.ErrorIs(t, err, domain.ErrRentalNotFound)
+
+	history, err := repo.FindRevisions(ctx, 1, &domain.RentalFindFilter{})
+	require.NoError(t, err)
+	require.Len(t, history.Items, 2)
+	assert.Equal(t, domain.RevisionUpdate, history.Items[0].Action)
+	assert.Equal(t, "1", history.Items[0].Actor)
+	assert.Equal(t, map[string]domain.FieldChange{"name": {Old: "Costa Mesa", New: "Renamed"}}, history.Items[0].Diff)
+	assert.Equal(t, map[string]domain.FieldChange{"price.day": {Old: float64(16900), New: float64(15900)}}, history.Items[1].Diff)
+
+	past, err := repo.FindAsOf(ctx, 1, history.Items[1].ChangedAt)
+	require.NoError(t, err)
+	assert.Equal(t, "Costa Mesa", past.Name)
+	assert.Equal(t, 15900, past.Price.Day)
+	// the fixture rows have no history
+	_, err = repo.FindAsOf(ctx, 1, history.Items[1].ChangedAt.Add(-time.Second))
+	assert.ErrorIs(t, err, domain.ErrRentalNotFound)
+}
+
+func TestRestoreAndPurge(t *testing.T) {
+	repo := newRepo(t)
+	deletedAt := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, repo.Delete(2, deletedAt))
+	require.NoError(t, repo.Delete(4, deletedAt.Add(time.Hour)))
+
+	_, err := repo.Restore(context.Background(), 1)
+	assert.ErrorIs(t, err, domain.ErrRentalNotFound)
+	restored, err := repo.Restore(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Nil(t, restored.DeletedAt)
+	assert.Equal(t, uint(2), restored.Version)
+
+	// a live rental is not purged
+	assert.ErrorIs(t, repo.Purge(context.Background(), 2), domain.ErrRentalNotFound)
+	purged, err := repo.PurgeDeleted(context.Background(), deletedAt.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []uint{4}, purged)
+	deleted, err := repo.FindDeleted(context.Background(), domain.RentalFindFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, deleted.Items)
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	repo := newRepo(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, repo.Upsert(context.Background(), []domain.Rental{{Name: "New", User: domain.User{ID: 1}}}))
+			_, err := repo.FindByFilter(context.Background(), domain.RentalFindFilter{})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	all, err := repo.FindAll(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, all, 54)
+}
+
+func TestImagesContract(t *testing.T) {
+	repositorytest.RunImages(t, memory.NewRentalImageRepository())
+}
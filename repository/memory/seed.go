@@ -0,0 +1,507 @@
+package memory
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/plar/rentals-api/domain"
+)
+
+// LoadFile seeds the repository from a fixture, by its extension: .sql for the INSERT statements of
+// db/seed.sql, .json or .ndjson for rentals in the format of the API, e.g. an NDJSON export
+func (r *RentalRepository) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".sql":
+		err = r.LoadSQL(f)
+	case ".json", ".ndjson":
+		err = r.LoadJSON(f)
+	default:
+		err = fmt.Errorf("unsupported fixture extension %q, use .sql, .json or .ndjson", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// LoadJSON seeds the repository with a JSON array of rentals or a stream of them, their owners are
+// added with the names of the rentals
+func (r *RentalRepository) LoadJSON(rd io.Reader) error {
+	br := bufio.NewReader(rd)
+	dec := json.NewDecoder(br)
+
+	var rentals []domain.Rental
+	if first, err := firstNonSpace(br); err != nil {
+		return err
+	} else if first == '[' {
+		if err = dec.Decode(&rentals); err != nil {
+			return err
+		}
+	} else {
+		for {
+			var rental domain.Rental
+			if err = dec.Decode(&rental); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return err
+			}
+			rentals = append(rentals, rental)
+		}
+	}
+
+	for _, rental := range rentals {
+		r.AddUsers(rental.User)
+	}
+	return r.Add(rentals...)
+}
+
+func firstNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if errors.Is(err, io.EOF) {
+			return 0, nil
+		} else if err != nil {
+			return 0, err
+		}
+		if !unicode.IsSpace(rune(b)) {
+			return b, br.UnreadByte()
+		}
+	}
+}
+
+// LoadSQL seeds the repository with the INSERT statements into the users and rentals tables, like the
+// ones of db/seed.sql, the other statements are skipped
+func (r *RentalRepository) LoadSQL(rd io.Reader) error {
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return err
+	}
+	statements, err := parseInserts(string(data))
+	if err != nil {
+		return err
+	}
+
+	for _, stmt := range statements {
+		switch stmt.table {
+		case "users":
+			for _, row := range stmt.rows {
+				user, err := userRow(stmt.columns, row)
+				if err != nil {
+					return err
+				}
+				r.AddUsers(user)
+			}
+		case "rentals":
+			rentals := make([]domain.Rental, 0, len(stmt.rows))
+			for _, row := range stmt.rows {
+				rental, err := rentalRow(stmt.columns, row)
+				if err != nil {
+					return err
+				}
+				rentals = append(rentals, rental)
+			}
+			if err := r.Add(rentals...); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported table %q", stmt.table)
+		}
+	}
+	return nil
+}
+
+func userRow(columns []string, row []sqlValue) (user domain.User, err error) {
+	for i, column := range columns {
+		v := row[i]
+		switch column {
+		case "id":
+			user.ID, err = v.int()
+		case "first_name":
+			user.FirstName = v.string()
+		case "last_name":
+			user.LastName = v.string()
+		case "created_at", "updated_at", "deleted_at":
+		default:
+			err = fmt.Errorf("unsupported users column %q", column)
+		}
+		if err != nil {
+			return user, err
+		}
+	}
+	return user, nil
+}
+
+func rentalRow(columns []string, row []sqlValue) (rental domain.Rental, err error) {
+	for i, column := range columns {
+		v := row[i]
+		switch column {
+		case "id":
+			var id int
+			id, err = v.int()
+			rental.ID = uint(id)
+		case "user_id":
+			rental.User.ID, err = v.int()
+		case "name":
+			rental.Name = v.string()
+		case "description":
+			rental.Description = v.string()
+		case "type":
+			rental.Type = v.string()
+		case "vehicle_make":
+			rental.Make = v.string()
+		case "vehicle_model":
+			rental.Model = v.string()
+		case "vehicle_year":
+			rental.Year, err = v.int()
+		case "vehicle_length":
+			rental.Length, err = v.float()
+		case "sleeps":
+			rental.Sleeps, err = v.int()
+		case "price_per_day":
+			rental.Price.Day, err = v.int()
+		case "home_city":
+			rental.Location.City = v.string()
+		case "home_state":
+			rental.Location.State = v.string()
+		case "home_zip":
+			rental.Location.Zip = v.string()
+		case "home_country":
+			rental.Location.Country = v.string()
+		case "lat":
+			rental.Location.Lat, err = v.float()
+		case "lng":
+			rental.Location.Lng, err = v.float()
+		case "primary_image_url":
+			rental.PrimaryImageURL = v.string()
+		case "version":
+			var version int
+			version, err = v.int()
+			rental.Version = uint(version)
+		case "deleted_at":
+			rental.DeletedAt, err = v.time()
+		case "created", "updated":
+		default:
+			err = fmt.Errorf("unsupported rentals column %q", column)
+		}
+		if err != nil {
+			return rental, fmt.Errorf("rentals column %q: %w", column, err)
+		}
+	}
+	return rental, nil
+}
+
+// sqlValue is a literal of an INSERT statement, null is nil
+type sqlValue struct {
+	text *string
+}
+
+func (v sqlValue) string() string {
+	if v.text == nil {
+		return ""
+	}
+	return *v.text
+}
+
+func (v sqlValue) int() (int, error) {
+	if v.text == nil {
+		return 0, nil
+	}
+	return strconv.Atoi(*v.text)
+}
+
+func (v sqlValue) float() (float64, error) {
+	if v.text == nil {
+		return 0, nil
+	}
+	return strconv.ParseFloat(*v.text, 64)
+}
+
+// time parses the timestamps in the text format of PostgreSQL
+func (v sqlValue) time() (*time.Time, error) {
+	if v.text == nil {
+		return nil, nil
+	}
+	t, err := time.Parse("2006-01-02 15:04:05.999999999-07", *v.text)
+	if err != nil {
+		t, err = time.Parse(time.RFC3339Nano, *v.text)
+	}
+	return &t, err
+}
+
+type insertStatement struct {
+	table   string
+	columns []string
+	rows    [][]sqlValue
+}
+
+// parseInserts returns the INSERT INTO table(columns) VALUES (...), ... statements of a SQL script
+func parseInserts(script string) ([]insertStatement, error) {
+	tokens, err := tokenize(script)
+	if err != nil {
+		return nil, err
+	}
+
+	var statements []insertStatement
+	p := &sqlParser{tokens: tokens}
+	for !p.done() {
+		if !p.keyword("INSERT") {
+			p.skipStatement()
+			continue
+		}
+		stmt, err := p.insert()
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, stmt)
+	}
+	return statements, nil
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenSymbol
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	line int
+}
+
+// tokenize splits a SQL script into words, quoted identifiers, strings (standard and escape strings),
+// numbers and symbols, the comments are dropped
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	line := 1
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case unicode.IsSpace(rune(c)):
+			i++
+		case strings.HasPrefix(s[i:], "--"):
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case c == '"':
+			end := strings.IndexByte(s[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated identifier", line)
+			}
+			tokens = append(tokens, token{tokenIdent, s[i+1 : i+1+end], line})
+			i += end + 2
+		case c == '\'' || (c == 'E' || c == 'e') && i+1 < len(s) && s[i+1] == '\'':
+			escaped := c != '\''
+			if escaped {
+				i++
+			}
+			text, n, err := readString(s[i:], escaped)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			line += strings.Count(s[i:i+n], "\n")
+			tokens = append(tokens, token{tokenString, text, line})
+			i += n
+		case c == '-' || c == '.' || c >= '0' && c <= '9':
+			j := i + 1
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.' || s[j] == 'e' || s[j] == 'E') {
+				j++
+			}
+			tokens = append(tokens, token{tokenNumber, s[i:j], line})
+			i = j
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i + 1
+			for j < len(s) && (s[j] == '_' || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			tokens = append(tokens, token{tokenWord, s[i:j], line})
+			i = j
+		default:
+			tokens = append(tokens, token{tokenSymbol, string(c), line})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+// readString reads the string literal s starts with, a doubled quote is a quote and, in escape strings, so is \'
+// along with the other backslash escapes. It returns the text and the length of the literal.
+func readString(s string, escaped bool) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			b.WriteByte('\'')
+			i++
+		case c == '\'':
+			return b.String(), i + 1, nil
+		case c == '\\' && escaped && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			default:
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, errors.New("unterminated string")
+}
+
+type sqlParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *sqlParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *sqlParser) peek() token {
+	if p.done() {
+		return token{kind: tokenSymbol}
+	}
+	return p.tokens[p.pos]
+}
+
+// keyword consumes the next token when it is the word kw, in any case
+func (p *sqlParser) keyword(kw string) bool {
+	if t := p.peek(); t.kind == tokenWord && strings.EqualFold(t.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// symbol consumes the next token when it is the symbol sym
+func (p *sqlParser) symbol(sym string) bool {
+	if t := p.peek(); t.kind == tokenSymbol && t.text == sym {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", p.peek().line, fmt.Sprintf(format, args...))
+}
+
+func (p *sqlParser) skipStatement() {
+	for !p.done() && !p.symbol(";") {
+		p.pos++
+	}
+}
+
+func (p *sqlParser) name() (string, bool) {
+	if t := p.peek(); t.kind == tokenWord || t.kind == tokenIdent {
+		p.pos++
+		return t.text, true
+	}
+	return "", false
+}
+
+// insert parses an INSERT statement after its INSERT keyword
+func (p *sqlParser) insert() (insertStatement, error) {
+	var stmt insertStatement
+	if !p.keyword("INTO") {
+		return stmt, p.errorf("expected INTO")
+	}
+	table, ok := p.name()
+	if !ok {
+		return stmt, p.errorf("expected a table name")
+	}
+	stmt.table = table
+
+	if !p.symbol("(") {
+		return stmt, p.errorf("expected the column list of %s", table)
+	}
+	for {
+		column, ok := p.name()
+		if !ok {
+			return stmt, p.errorf("expected a column name")
+		}
+		stmt.columns = append(stmt.columns, column)
+		if p.symbol(")") {
+			break
+		}
+		if !p.symbol(",") {
+			return stmt, p.errorf("expected , or )")
+		}
+	}
+
+	if !p.keyword("VALUES") {
+		return stmt, p.errorf("expected VALUES")
+	}
+	for {
+		row, err := p.row()
+		if err != nil {
+			return stmt, err
+		}
+		if len(row) != len(stmt.columns) {
+			return stmt, p.errorf("%d values for %d columns", len(row), len(stmt.columns))
+		}
+		stmt.rows = append(stmt.rows, row)
+		if !p.symbol(",") {
+			break
+		}
+	}
+	if !p.symbol(";") && !p.done() {
+		return stmt, p.errorf("expected ; after the values of %s", table)
+	}
+	return stmt, nil
+}
+
+func (p *sqlParser) row() ([]sqlValue, error) {
+	if !p.symbol("(") {
+		return nil, p.errorf("expected (")
+	}
+	var row []sqlValue
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == tokenString || t.kind == tokenNumber:
+			text := t.text
+			row = append(row, sqlValue{&text})
+			p.pos++
+		case p.keyword("NULL"):
+			row = append(row, sqlValue{})
+		default:
+			return nil, p.errorf("unsupported value %q", t.text)
+		}
+		if p.symbol(")") {
+			return row, nil
+		}
+		if !p.symbol(",") {
+			return nil, p.errorf("expected , or )")
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package memory_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/plar/rentals-api/config"
+	"github.com/plar/rentals-api/repository/memory"
+)
+
+func TestLoadFile(t *testing.T) {
+	repo := memory.NewRentalRepository(config.Default().Repository)
+	require.NoError(t, repo.LoadFile("../../db/seed.sql"))
+
+	all, err := repo.FindAll(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, all, 30)
+
+	rental, err := repo.FindByID(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, "'Abaco' VW Bay Window: Westfalia Pop-top", rental.Name)
+	assert.Equal(t, "John", rental.User.FirstName)
+	assert.Equal(t, 16900, rental.Price.Day)
+	assert.Equal(t, -117.93, rental.Location.Lng)
+
+	assert.Error(t, repo.LoadFile("../../db/seed.csv"))
+}
+
+func TestLoadSQL(t *testing.T) {
+	script := `
+-- fixture
+INSERT INTO users (id, first_name, last_name) VALUES (7, 'O''Brien', NULL);
+INSERT INTO "rentals"("id", "user_id", "name", "deleted_at") VALUES
+  (3, 7, E'Line\nbreak', NULL),
+  (5, 7, 'Gone', '2023-05-01 12:00:00+00');
+SELECT setval('users_id_seq', 7);
+`
+	repo := memory.NewRentalRepository(config.Default().Repository)
+	require.NoError(t, repo.LoadSQL(strings.NewReader(script)))
+
+	rental, err := repo.FindByID(context.Background(), 3)
+	require.NoError(t, err)
+	assert.Equal(t, "Line\nbreak", rental.Name)
+	assert.Equal(t, "O'Brien", rental.User.FirstName)
+	_, err = repo.FindByID(context.Background(), 5)
+	assert.Error(t, err)
+
+	for _, bad := range []string{
+		`INSERT INTO rentals (id, color) VALUES (1, 'red');`,
+		`INSERT INTO rentals (id, user_id) VALUES (1);`,
+		`INSERT INTO rentals (id, user_id) VALUES (1, 99);`,
+		`INSERT INTO bookings (id) VALUES (1);`,
+		`INSERT INTO rentals (id, name) VALUES (1, 'unterminated);`,
+	} {
+		repo := memory.NewRentalRepository(config.Default().Repository)
+		assert.Error(t, repo.LoadSQL(strings.NewReader(bad)), bad)
+	}
+}
+
+func TestLoadJSON(t *testing.T) {
+	for name, data := range map[string]string{
+		"array":  `[{"id": 2, "name": "Van", "user": {"id": 1, "first_name": "John"}}, {"name": "Bus", "user": {"id": 1, "first_name": "John"}}]`,
+		"ndjson": "{\"id\": 2, \"name\": \"Van\", \"user\": {\"id\": 1, \"first_name\": \"John\"}}\n{\"name\": \"Bus\", \"user\": {\"id\": 1, \"first_name\": \"John\"}}\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			repo := memory.NewRentalRepository(config.Default().Repository)
+			require.NoError(t, repo.LoadJSON(strings.NewReader(data)))
+
+			// the rentals without ID get the next one
+			rental, err := repo.FindByID(context.Background(), 3)
+			require.NoError(t, err)
+			assert.Equal(t, "Bus", rental.Name)
+			assert.Equal(t, "John", rental.User.FirstName)
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/plar/rentals-api/domain"
+
+	"github.com/stretchr/testify/mock"
+)
+
+type APIKeyRepository struct {
+	mock.Mock
+}
+
+var _ domain.APIKeyRepository = (*APIKeyRepository)(nil)
+
+func (r *APIKeyRepository) FindByHash(ctx context.Context, hash string) (domain.APIKey, error) {
+	args := r.Called(ctx, hash)
+	return args.Get(0).(domain.APIKey), args.Error(1)
+}
+
+func (r *APIKeyRepository) Create(ctx context.Context, key domain.APIKey) (domain.APIKey, error) {
+	args := r.Called(ctx, key)
+	return args.Get(0).(domain.APIKey), args.Error(1)
+}
+
+func (r *APIKeyRepository) List(ctx context.Context) ([]domain.APIKey, error) {
+	args := r.Called(ctx)
+	return args.Get(0).([]domain.APIKey), args.Error(1)
+}
+
+func (r *APIKeyRepository) Revoke(ctx context.Context, prefix string) error {
+	args := r.Called(ctx, prefix)
+	return args.Error(0)
+}
+
+// Add more methods as needed
@@ -0,0 +1,42 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/plar/rentals-api/domain"
+
+	"github.com/stretchr/testify/mock"
+)
+
+type RentalImageRepository struct {
+	mock.Mock
+}
+
+var _ domain.RentalImageRepository = (*RentalImageRepository)(nil)
+
+func (r *RentalImageRepository) FindByRentalIDs(ctx context.Context, ids []uint) (map[uint][]domain.RentalImage, error) {
+	args := r.Called(ctx, ids)
+	return args.Get(0).(map[uint][]domain.RentalImage), args.Error(1)
+}
+
+func (r *RentalImageRepository) Add(ctx context.Context, image domain.RentalImage) (domain.RentalImage, error) {
+	args := r.Called(ctx, image)
+	return args.Get(0).(domain.RentalImage), args.Error(1)
+}
+
+func (r *RentalImageRepository) Delete(ctx context.Context, rentalID, id uint) (domain.RentalImage, error) {
+	args := r.Called(ctx, rentalID, id)
+	return args.Get(0).(domain.RentalImage), args.Error(1)
+}
+
+func (r *RentalImageRepository) Reorder(ctx context.Context, rentalID uint, ids []uint) ([]domain.RentalImage, error) {
+	args := r.Called(ctx, rentalID, ids)
+	return args.Get(0).([]domain.RentalImage), args.Error(1)
+}
+
+func (r *RentalImageRepository) DeleteAll(ctx context.Context, rentalID uint) error {
+	args := r.Called(ctx, rentalID)
+	return args.Error(0)
+}
+
+// Add more methods as needed
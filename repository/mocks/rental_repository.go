@@ -1,6 +1,9 @@
 package mocks
 
 import (
+	"context"
+	"time"
+
 	"github.com/plar/rentals-api/domain"
 
 	"github.com/stretchr/testify/mock"
@@ -12,19 +15,69 @@ type RentalRepository struct {
 
 var _ domain.RentalRepository = (*RentalRepository)(nil)
 
-func (r *RentalRepository) FindAll() ([]domain.Rental, error) {
-	args := r.Called()
+func (r *RentalRepository) FindAll(ctx context.Context) ([]domain.Rental, error) {
+	args := r.Called(ctx)
+	return args.Get(0).([]domain.Rental), args.Error(1)
+}
+
+func (r *RentalRepository) FindByID(ctx context.Context, id uint) (domain.Rental, error) {
+	args := r.Called(ctx, id)
+	return args.Get(0).(domain.Rental), args.Error(1)
+}
+
+func (r *RentalRepository) FindByIDs(ctx context.Context, ids []uint) ([]domain.Rental, error) {
+	args := r.Called(ctx, ids)
 	return args.Get(0).([]domain.Rental), args.Error(1)
 }
 
-func (r *RentalRepository) FindByID(id uint) (domain.Rental, error) {
-	args := r.Called(id)
+func (r *RentalRepository) FindByFilter(ctx context.Context, filter domain.RentalFindFilter) (domain.Response[domain.Rental], error) {
+	args := r.Called(ctx, filter)
+	return args.Get(0).(domain.Response[domain.Rental]), args.Error(1)
+}
+
+func (r *RentalRepository) StreamByFilter(ctx context.Context, filter domain.RentalFindFilter, fn func(domain.Rental) error) error {
+	args := r.Called(ctx, filter, fn)
+	return args.Error(0)
+}
+
+func (r *RentalRepository) Upsert(ctx context.Context, rentals []domain.Rental) error {
+	args := r.Called(ctx, rentals)
+	return args.Error(0)
+}
+
+func (r *RentalRepository) Update(ctx context.Context, rental domain.Rental) (domain.Rental, error) {
+	args := r.Called(ctx, rental)
 	return args.Get(0).(domain.Rental), args.Error(1)
 }
 
-func (r *RentalRepository) FindByFilter(filter domain.RentalFindFilter) (domain.Response[domain.Rental], error) {
-	args := r.Called(filter)
+func (r *RentalRepository) FindDeleted(ctx context.Context, filter domain.RentalFindFilter) (domain.Response[domain.Rental], error) {
+	args := r.Called(ctx, filter)
 	return args.Get(0).(domain.Response[domain.Rental]), args.Error(1)
 }
 
+func (r *RentalRepository) Restore(ctx context.Context, id uint) (domain.Rental, error) {
+	args := r.Called(ctx, id)
+	return args.Get(0).(domain.Rental), args.Error(1)
+}
+
+func (r *RentalRepository) Purge(ctx context.Context, id uint) error {
+	args := r.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (r *RentalRepository) PurgeDeleted(ctx context.Context, before time.Time) ([]uint, error) {
+	args := r.Called(ctx, before)
+	return args.Get(0).([]uint), args.Error(1)
+}
+
+func (r *RentalRepository) FindRevisions(ctx context.Context, id uint, page domain.ViewFilter) (domain.Response[domain.RentalRevision], error) {
+	args := r.Called(ctx, id, page)
+	return args.Get(0).(domain.Response[domain.RentalRevision]), args.Error(1)
+}
+
+func (r *RentalRepository) FindAsOf(ctx context.Context, id uint, at time.Time) (domain.Rental, error) {
+	args := r.Called(ctx, id, at)
+	return args.Get(0).(domain.Rental), args.Error(1)
+}
+
 // Add more methods as needed
@@ -0,0 +1,262 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/plar/rentals-api/cache"
+	"github.com/plar/rentals-api/domain"
+	"github.com/plar/rentals-api/logs"
+)
+
+const (
+	cacheKeyPrefix       = "rentals:"
+	cacheRentalKeyPrefix = cacheKeyPrefix + "id:"
+	cacheFilterKeyPrefix = cacheKeyPrefix + "filter:"
+)
+
+// RentalRepositoryCache caches the results of FindByID and FindByFilter for ttl. Concurrent misses
+// of a key share a single call of the next repository. The writes invalidate the written rentals and every
+// cached listing, Invalidate and InvalidateAll do it for the writes which bypass the repository.
+// With read replicas the callers sticking to the primary bypass the cache, and the loads started within
+// the replica lag window of an invalidation are not stored, they may miss the write.
+type RentalRepositoryCache struct {
+	next     domain.RentalRepository
+	cache    cache.Cache
+	ttl      time.Duration
+	group    singleflight.Group
+	router   *DBRouter
+	requests *prometheus.CounterVec
+	logger   *zap.Logger
+
+	// generation changes with every invalidation, loads started before it neither store their result
+	// nor are shared with the callers arriving after it
+	generation atomic.Uint64
+	// invalidated is the time of the last invalidation in unix nanoseconds
+	invalidated atomic.Int64
+}
+
+var _ domain.RentalRepository = (*RentalRepositoryCache)(nil)
+
+// NewRentalRepositoryCache returns the caching decorator of next and registers its hit and miss
+// counter on reg, router is the database router of next, nil when it reads no replica
+func NewRentalRepositoryCache(next domain.RentalRepository, c cache.Cache, ttl time.Duration, router *DBRouter, reg prometheus.Registerer, logger *zap.Logger) *RentalRepositoryCache {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	r := &RentalRepositoryCache{
+		next:   next,
+		cache:  c,
+		ttl:    ttl,
+		router: router,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "rentals",
+			Subsystem: "cache",
+			Name:      "requests_total",
+			Help:      "Number of cached rental repository calls by result: hit, miss or bypass.",
+		}, []string{"method", "result"}),
+		logger: logger,
+	}
+	reg.MustRegister(r.requests)
+	return r
+}
+
+// detachedContext keeps the values of its parent, the trace span among them, but not its cancellation,
+// a shared load goes on when the caller which started it goes away
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// detach returns a context which is not canceled with ctx but keeps its deadline
+func detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(detachedContext{ctx}, deadline)
+	}
+	return context.WithCancel(detachedContext{ctx})
+}
+
+// sticky reports whether the reads of ctx go to the primary to see the last write of the caller
+func (r *RentalRepositoryCache) sticky(ctx context.Context) bool {
+	return r.router != nil && r.router.Sticky(ctx)
+}
+
+// storable reports whether a load started at started may store its result: no invalidation happened
+// since and the replicas had the time to catch up with the last one
+func (r *RentalRepositoryCache) storable(generation uint64, started time.Time) bool {
+	if r.generation.Load() != generation {
+		return false
+	}
+	if r.router == nil {
+		return true
+	}
+	return started.Sub(time.Unix(0, r.invalidated.Load())) >= r.router.LagWindow()
+}
+
+// invalidate starts a new generation, the running loads do not store their result
+func (r *RentalRepositoryCache) invalidate() {
+	r.generation.Add(1)
+	r.invalidated.Store(time.Now().UnixNano())
+}
+
+// cached returns the cached value of key or loads it with fn, the reads which must see the primary
+// bypass the cache
+func cached[T any](r *RentalRepositoryCache, ctx context.Context, method string, key string, fn func(ctx context.Context) (T, error)) (T, error) {
+	if domain.PrimaryReads(ctx) || r.sticky(ctx) {
+		r.requests.WithLabelValues(method, "bypass").Inc()
+		return fn(ctx)
+	}
+
+	if data, ok, err := r.cache.Get(ctx, key); err != nil {
+		logs.WithContext(ctx, r.logger).Warn("Cannot read cache", zap.String("key", key), zap.Error(err))
+	} else if ok {
+		var v T
+		if err = json.Unmarshal(data, &v); err == nil {
+			r.requests.WithLabelValues(method, "hit").Inc()
+			return v, nil
+		}
+		logs.WithContext(ctx, r.logger).Warn("Cannot decode cached value", zap.String("key", key), zap.Error(err))
+	}
+	r.requests.WithLabelValues(method, "miss").Inc()
+
+	generation := r.generation.Load()
+	ch := r.group.DoChan(key+"@"+strconv.FormatUint(generation, 10), func() (any, error) {
+		loadCtx, cancel := detach(ctx)
+		defer cancel()
+
+		started := time.Now()
+		v, err := fn(loadCtx)
+		if err != nil || !r.storable(generation, started) {
+			return v, err
+		}
+		if data, err := json.Marshal(v); err != nil {
+			logs.WithContext(ctx, r.logger).Warn("Cannot encode cached value", zap.String("key", key), zap.Error(err))
+		} else if err = r.cache.Set(loadCtx, key, data, r.ttl); err != nil {
+			logs.WithContext(ctx, r.logger).Warn("Cannot write cache", zap.String("key", key), zap.Error(err))
+		} else if r.generation.Load() != generation {
+			// an invalidation ran between the check and the write
+			if err = r.cache.Delete(loadCtx, key); err != nil {
+				logs.WithContext(ctx, r.logger).Warn("Cannot delete cached value", zap.String("key", key), zap.Error(err))
+			}
+		}
+		return v, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	case res := <-ch:
+		v, _ := res.Val.(T)
+		return v, res.Err
+	}
+}
+
+func (r *RentalRepositoryCache) FindAll(ctx context.Context) ([]domain.Rental, error) {
+	return r.next.FindAll(ctx)
+}
+
+func (r *RentalRepositoryCache) FindByID(ctx context.Context, id uint) (domain.Rental, error) {
+	key := cacheRentalKeyPrefix + strconv.FormatUint(uint64(id), 10)
+	return cached(r, ctx, "FindByID", key, func(ctx context.Context) (domain.Rental, error) {
+		return r.next.FindByID(ctx, id)
+	})
+}
+
+func (r *RentalRepositoryCache) FindByIDs(ctx context.Context, ids []uint) ([]domain.Rental, error) {
+	return r.next.FindByIDs(ctx, ids)
+}
+
+func (r *RentalRepositoryCache) FindByFilter(ctx context.Context, filter domain.RentalFindFilter) (domain.Response[domain.Rental], error) {
+	return cached(r, ctx, "FindByFilter", cacheFilterKeyPrefix+filter.Key(), func(ctx context.Context) (domain.Response[domain.Rental], error) {
+		return r.next.FindByFilter(ctx, filter)
+	})
+}
+
+func (r *RentalRepositoryCache) StreamByFilter(ctx context.Context, filter domain.RentalFindFilter, fn func(domain.Rental) error) error {
+	return r.next.StreamByFilter(ctx, filter, fn)
+}
+
+func (r *RentalRepositoryCache) Upsert(ctx context.Context, rentals []domain.Rental) error {
+	err := r.next.Upsert(ctx, rentals)
+
+	// new rentals are not cached by ID yet, but they may enter any listing
+	ids := make([]uint, 0, len(rentals))
+	for _, rental := range rentals {
+		if rental.ID != 0 {
+			ids = append(ids, rental.ID)
+		}
+	}
+	if invErr := r.Invalidate(ctx, ids...); invErr != nil {
+		logs.WithContext(ctx, r.logger).Error("Cannot invalidate cache", zap.Error(invErr))
+	}
+	return err
+}
+
+func (r *RentalRepositoryCache) Update(ctx context.Context, rental domain.Rental) (domain.Rental, error) {
+	updated, err := r.next.Update(ctx, rental)
+	if invErr := r.Invalidate(ctx, rental.ID); invErr != nil {
+		logs.WithContext(ctx, r.logger).Error("Cannot invalidate cache", zap.Error(invErr))
+	}
+	return updated, err
+}
+
+// Invalidate drops the cached rentals of ids and every cached listing, which may include them
+func (r *RentalRepositoryCache) Invalidate(ctx context.Context, ids ...uint) error {
+	r.invalidate()
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = cacheRentalKeyPrefix + strconv.FormatUint(uint64(id), 10)
+	}
+	if err := r.cache.Delete(ctx, keys...); err != nil {
+		return err
+	}
+	return r.cache.DeletePrefix(ctx, cacheFilterKeyPrefix)
+}
+
+// InvalidateAll drops every cached rental and listing
+func (r *RentalRepositoryCache) InvalidateAll(ctx context.Context) error {
+	r.invalidate()
+	return r.cache.DeletePrefix(ctx, cacheKeyPrefix)
+}
+
+func (r *RentalRepositoryCache) FindDeleted(ctx context.Context, filter domain.RentalFindFilter) (domain.Response[domain.Rental], error) {
+	return r.next.FindDeleted(ctx, filter)
+}
+
+func (r *RentalRepositoryCache) Restore(ctx context.Context, id uint) (domain.Rental, error) {
+	rental, err := r.next.Restore(ctx, id)
+	// the restored rental may enter any listing again
+	if invErr := r.Invalidate(ctx, id); invErr != nil {
+		logs.WithContext(ctx, r.logger).Error("Cannot invalidate cache", zap.Error(invErr))
+	}
+	return rental, err
+}
+
+func (r *RentalRepositoryCache) Purge(ctx context.Context, id uint) error {
+	return r.next.Purge(ctx, id)
+}
+
+func (r *RentalRepositoryCache) PurgeDeleted(ctx context.Context, before time.Time) ([]uint, error) {
+	return r.next.PurgeDeleted(ctx, before)
+}
+
+func (r *RentalRepositoryCache) FindRevisions(ctx context.Context, id uint, page domain.ViewFilter) (domain.Response[domain.RentalRevision], error) {
+	return r.next.FindRevisions(ctx, id, page)
+}
+
+func (r *RentalRepositoryCache) FindAsOf(ctx context.Context, id uint, at time.Time) (domain.Rental, error) {
+	return r.next.FindAsOf(ctx, id, at)
+}
+
+// Add more methods as needed
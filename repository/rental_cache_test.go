@@ -0,0 +1,203 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+
+	"github.com/plar/rentals-api/auth"
+	"github.com/plar/rentals-api/cache"
+	"github.com/plar/rentals-api/domain"
+	"github.com/plar/rentals-api/repository"
+	"github.com/plar/rentals-api/repository/mocks"
+)
+
+func newCachedRepo(t *testing.T) (*repository.RentalRepositoryCache, *mocks.RentalRepository, *prometheus.Registry) {
+	mockRepo := new(mocks.RentalRepository)
+	reg := prometheus.NewRegistry()
+	repo := repository.NewRentalRepositoryCache(mockRepo, cache.NewMemory(100, nil), time.Minute, nil, reg, nil)
+	return repo, mockRepo, reg
+}
+
+func TestRentalRepositoryCacheFindByID(t *testing.T) {
+	repo, mockRepo, reg := newCachedRepo(t)
+	mockRepo.On("FindByID", mock.Anything, uint(1)).Return(domain.Rental{ID: 1, Name: "Maupin: Vanagon Camper"}, nil).Once()
+	mockRepo.On("FindByID", mock.Anything, uint(2)).Return(domain.Rental{}, errors.New("record not found")).Twice()
+
+	for i := 0; i < 3; i++ {
+		rental, err := repo.FindByID(context.Background(), 1)
+		assert.NoError(t, err)
+		assert.Equal(t, "Maupin: Vanagon Camper", rental.Name)
+	}
+
+	// errors are not cached
+	for i := 0; i < 2; i++ {
+		_, err := repo.FindByID(context.Background(), 2)
+		assert.EqualError(t, err, "record not found")
+	}
+
+	// the reads which must see the primary bypass the cache
+	mockRepo.On("FindByID", mock.Anything, uint(1)).Return(domain.Rental{ID: 1, Name: "Renamed"}, nil).Once()
+	rental, err := repo.FindByID(domain.WithPrimaryReads(context.Background()), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "Renamed", rental.Name)
+
+	expected := `
+# HELP rentals_cache_requests_total Number of cached rental repository calls by result: hit, miss or bypass.
+# TYPE rentals_cache_requests_total counter
+rentals_cache_requests_total{method="FindByID",result="bypass"} 1
+rentals_cache_requests_total{method="FindByID",result="hit"} 2
+rentals_cache_requests_total{method="FindByID",result="miss"} 3
+`
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected), "rentals_cache_requests_total"))
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRentalRepositoryCacheFindByFilter(t *testing.T) {
+	repo, mockRepo, _ := newCachedRepo(t)
+	page := domain.Response[domain.Rental]{
+		Paginator: domain.Paginator{Limit: 10, TotalItems: 1},
+		Items:     []domain.Rental{{ID: 1, Price: domain.Price{Day: 16900}}},
+	}
+	empty := domain.Response[domain.Rental]{Items: []domain.Rental{}}
+	mockRepo.On("FindByFilter", mock.Anything, mock.MatchedBy(func(f domain.RentalFindFilter) bool {
+		_, ok := f.PriceMax()
+		return !ok
+	})).Return(page, nil).Once()
+	mockRepo.On("FindByFilter", mock.Anything, mock.Anything).Return(empty, nil).Once()
+
+	// the same query built in another order is a hit
+	a, _ := domain.NewRentalFilterBuilder().WithRentalIDs([]int{2, 1}).WithLimit(10).Build()
+	b, _ := domain.NewRentalFilterBuilder().WithLimit(10).WithRentalIDs([]int{1, 2}).Build()
+	res, err := repo.FindByFilter(context.Background(), a)
+	assert.NoError(t, err)
+	assert.Equal(t, page, res)
+	res, err = repo.FindByFilter(context.Background(), b)
+	assert.NoError(t, err)
+	assert.Equal(t, page, res)
+
+	// another query is a miss, an empty page stays an empty list
+	c, _ := domain.NewRentalFilterBuilder().WithPriceMax(100).Build()
+	for i := 0; i < 2; i++ {
+		res, err = repo.FindByFilter(context.Background(), c)
+		assert.NoError(t, err)
+		assert.NotNil(t, res.Items)
+	}
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRentalRepositoryCacheInvalidation(t *testing.T) {
+	repo, mockRepo, _ := newCachedRepo(t)
+	filter, _ := domain.NewRentalFilterBuilder().WithLimit(10).Build()
+	mockRepo.On("FindByID", mock.Anything, uint(1)).Return(domain.Rental{ID: 1}, nil).Times(4)
+	mockRepo.On("FindByID", mock.Anything, uint(2)).Return(domain.Rental{ID: 2}, nil).Once()
+	mockRepo.On("FindByFilter", mock.Anything, mock.Anything).Return(domain.Response[domain.Rental]{}, nil).Times(4)
+	mockRepo.On("Upsert", mock.Anything, mock.Anything).Return(nil).Once()
+	mockRepo.On("Update", mock.Anything, mock.Anything).Return(domain.Rental{ID: 1}, nil).Once()
+
+	load := func() {
+		_, err := repo.FindByID(context.Background(), 1)
+		assert.NoError(t, err)
+		_, err = repo.FindByID(context.Background(), 2)
+		assert.NoError(t, err)
+		_, err = repo.FindByFilter(context.Background(), filter)
+		assert.NoError(t, err)
+	}
+	load()
+
+	// the import updates rental 1 and adds a rental, rental 2 stays cached
+	assert.NoError(t, repo.Upsert(context.Background(), []domain.Rental{{ID: 1}, {Name: "New"}}))
+	load()
+
+	// so does an update of rental 1
+	_, err := repo.Update(context.Background(), domain.Rental{ID: 1, Version: 2})
+	assert.NoError(t, err)
+	load()
+
+	// explicit hooks for the writes which bypass the repository
+	assert.NoError(t, repo.InvalidateAll(context.Background()))
+	mockRepo.On("FindByID", mock.Anything, uint(2)).Return(domain.Rental{ID: 2}, nil).Once()
+	load()
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRentalRepositoryCacheSingleflight(t *testing.T) {
+	repo, mockRepo, _ := newCachedRepo(t)
+	release := make(chan time.Time)
+	mockRepo.On("FindByID", mock.Anything, uint(1)).
+		WaitUntil(release).
+		Return(domain.Rental{ID: 1}, nil).Once()
+
+	// the first caller gives up, the others still get the result of the load it started
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := repo.FindByID(ctx, 1)
+		first <- err
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rental, err := repo.FindByID(context.Background(), 1)
+			assert.NoError(t, err)
+			assert.Equal(t, uint(1), rental.ID)
+		}()
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-first, context.Canceled)
+	close(release)
+	wg.Wait()
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRentalRepositoryCacheReplicaLag(t *testing.T) {
+	primary, _ := mockGorm(t)
+	replica, _ := mockGorm(t)
+	router := repository.NewDBRouter(primary, []repository.Replica{{Name: "replica-1", DB: replica, Weight: 1}}, time.Minute, nil)
+	mockRepo := new(mocks.RentalRepository)
+	repo := repository.NewRentalRepositoryCache(mockRepo, cache.NewMemory(100, nil), time.Minute, router, prometheus.NewRegistry(), nil)
+
+	// the replica lags behind the update, only the sticky reads see it
+	mockRepo.On("FindByID", mock.MatchedBy(func(ctx context.Context) bool { return router.Sticky(ctx) }), uint(1)).
+		Return(domain.Rental{ID: 1, Version: 2}, nil).Once()
+	mockRepo.On("FindByID", mock.Anything, uint(1)).Return(domain.Rental{ID: 1, Version: 1}, nil).Times(3)
+	mockRepo.On("Update", mock.Anything, mock.Anything).Return(domain.Rental{ID: 1, Version: 2}, nil).Once()
+
+	a := auth.NewContext(context.Background(), auth.Identity{Subject: "owner-a"})
+	b := auth.NewContext(context.Background(), auth.Identity{Subject: "owner-b"})
+	rental, err := repo.FindByID(b, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), rental.Version)
+
+	assert.NoError(t, router.Write(a, func(*gorm.DB) error { return nil }))
+	_, err = repo.Update(a, domain.Rental{ID: 1, Version: 1})
+	assert.NoError(t, err)
+
+	// the load of another caller right after the update is not stored
+	rental, err = repo.FindByID(b, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), rental.Version)
+
+	// the writer reads its own write
+	rental, err = repo.FindByID(a, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(2), rental.Version)
+
+	_, err = repo.FindByID(b, 1)
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"time"
+)
+
+type RentalImage struct {
+	ID        uint `gorm:"primary_key"`
+	RentalID  uint `gorm:"not null"`
+	Position  int  `gorm:"not null"`
+	Key       string
+	Width     int
+	Height    int
+	Variants  []byte `gorm:"type:jsonb"`
+	CreatedAt time.Time
+}
+
+func (i *RentalImage) TableName() string {
+	return "rental_images"
+}
+
+// imageVariant is the JSON of a variant in the variants column
+type imageVariant struct {
+	Size   string `json:"size"`
+	Format string `json:"format"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Key    string `json:"key"`
+}
@@ -0,0 +1,199 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/plar/rentals-api/domain"
+)
+
+type rentalImageRepository struct {
+	db *DBRouter
+}
+
+var _ domain.RentalImageRepository = (*rentalImageRepository)(nil)
+
+func NewRentalImageRepository(db *gorm.DB) domain.RentalImageRepository {
+	return NewRoutedRentalImageRepository(NewDBRouter(db, nil, 0, nil))
+}
+
+// NewRoutedRentalImageRepository returns a repository which reads from the replicas of router
+func NewRoutedRentalImageRepository(router *DBRouter) domain.RentalImageRepository {
+	return &rentalImageRepository{db: router}
+}
+
+func (r *rentalImageRepository) FindByRentalIDs(ctx context.Context, ids []uint) (map[uint][]domain.RentalImage, error) {
+	images := make(map[uint][]domain.RentalImage)
+	if len(ids) == 0 {
+		return images, nil
+	}
+
+	var items []RentalImage
+	err := r.db.Read(ctx, func(db *gorm.DB) error {
+		return db.WithContext(ctx).Where("rental_id IN ?", ids).Order("rental_id, position").Find(&items).Error
+	})
+	if err != nil {
+		return nil, queryError(ctx, err)
+	}
+	for _, item := range items {
+		image, err := toDomainRentalImage(item)
+		if err != nil {
+			return nil, err
+		}
+		images[item.RentalID] = append(images[item.RentalID], image)
+	}
+	return images, nil
+}
+
+// lockRental locks the rental until the end of the transaction so the changes of its images are serialized
+func lockRental(tx *gorm.DB, id uint) error {
+	var rental Rental
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&rental, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.ErrRentalNotFound
+	}
+	return err
+}
+
+func (r *rentalImageRepository) Add(ctx context.Context, image domain.RentalImage) (domain.RentalImage, error) {
+	model, err := fromDomainRentalImage(image)
+	if err != nil {
+		return domain.RentalImage{}, err
+	}
+	err = r.db.Write(ctx, func(db *gorm.DB) error {
+		return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := lockRental(tx, image.RentalID); err != nil {
+				return err
+			}
+			var last int
+			err := tx.Model(&RentalImage{}).Where("rental_id = ?", image.RentalID).
+				Select("COALESCE(MAX(position), 0)").Scan(&last).Error
+			if err != nil {
+				return err
+			}
+			model.Position = last + 1
+			return tx.Create(&model).Error
+		})
+	})
+	if err != nil {
+		return domain.RentalImage{}, queryError(ctx, err)
+	}
+	return toDomainRentalImage(model)
+}
+
+func (r *rentalImageRepository) Delete(ctx context.Context, rentalID, id uint) (domain.RentalImage, error) {
+	var model RentalImage
+	err := r.db.Write(ctx, func(db *gorm.DB) error {
+		return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := lockRental(tx, rentalID); err != nil {
+				return err
+			}
+			err := tx.Where("rental_id = ?", rentalID).First(&model, id).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return domain.ErrImageNotFound
+			} else if err != nil {
+				return err
+			}
+			if err = tx.Delete(&model).Error; err != nil {
+				return err
+			}
+			return tx.Model(&RentalImage{}).Where("rental_id = ? AND position > ?", rentalID, model.Position).
+				Update("position", gorm.Expr("position - 1")).Error
+		})
+	})
+	if err != nil {
+		return domain.RentalImage{}, queryError(ctx, err)
+	}
+	return toDomainRentalImage(model)
+}
+
+func (r *rentalImageRepository) Reorder(ctx context.Context, rentalID uint, ids []uint) ([]domain.RentalImage, error) {
+	var items []RentalImage
+	err := r.db.Write(ctx, func(db *gorm.DB) error {
+		return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := lockRental(tx, rentalID); err != nil {
+				return err
+			}
+			if err := tx.Where("rental_id = ?", rentalID).Find(&items).Error; err != nil {
+				return err
+			}
+			positions, err := domain.ImagePositions(items, ids, func(i RentalImage) uint { return i.ID })
+			if err != nil {
+				return err
+			}
+			for i := range items {
+				if items[i].Position == positions[items[i].ID] {
+					continue
+				}
+				items[i].Position = positions[items[i].ID]
+				if err = tx.Model(&items[i]).Update("position", items[i].Position).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, queryError(ctx, err)
+	}
+
+	images := make([]domain.RentalImage, len(items))
+	for _, item := range items {
+		image, err := toDomainRentalImage(item)
+		if err != nil {
+			return nil, err
+		}
+		images[item.Position-1] = image
+	}
+	return images, nil
+}
+
+func (r *rentalImageRepository) DeleteAll(ctx context.Context, rentalID uint) error {
+	err := r.db.Write(ctx, func(db *gorm.DB) error {
+		return db.WithContext(ctx).Where("rental_id = ?", rentalID).Delete(&RentalImage{}).Error
+	})
+	return queryError(ctx, err)
+}
+
+func toDomainRentalImage(i RentalImage) (domain.RentalImage, error) {
+	var variants []imageVariant
+	if err := json.Unmarshal(i.Variants, &variants); err != nil {
+		return domain.RentalImage{}, err
+	}
+	image := domain.RentalImage{
+		ID:       i.ID,
+		RentalID: i.RentalID,
+		Position: i.Position,
+		Width:    i.Width,
+		Height:   i.Height,
+		Key:      i.Key,
+		Variants: make([]domain.ImageVariant, 0, len(variants)),
+	}
+	for _, v := range variants {
+		image.Variants = append(image.Variants, domain.ImageVariant{Size: v.Size, Format: v.Format, Width: v.Width, Height: v.Height, Key: v.Key})
+	}
+	return image, nil
+}
+
+func fromDomainRentalImage(i domain.RentalImage) (RentalImage, error) {
+	variants := make([]imageVariant, 0, len(i.Variants))
+	for _, v := range i.Variants {
+		variants = append(variants, imageVariant{Size: v.Size, Format: v.Format, Width: v.Width, Height: v.Height, Key: v.Key})
+	}
+	data, err := json.Marshal(variants)
+	if err != nil {
+		return RentalImage{}, err
+	}
+	return RentalImage{
+		ID:       i.ID,
+		RentalID: i.RentalID,
+		Key:      i.Key,
+		Width:    i.Width,
+		Height:   i.Height,
+		Variants: data,
+	}, nil
+}
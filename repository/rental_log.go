@@ -1,9 +1,13 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/plar/rentals-api/domain"
+	"github.com/plar/rentals-api/logs"
 	"go.uber.org/zap"
 )
 
@@ -21,40 +25,175 @@ func NewRentalRepositoryLogger(next domain.RentalRepository, logger *zap.Logger)
 	}
 }
 
-func (l *rentalRepositoryLogger) FindAll() (rentals []domain.Rental, err error) {
-	l.logger.Debug("FindAll called")
+func (l *rentalRepositoryLogger) FindAll(ctx context.Context) (rentals []domain.Rental, err error) {
+	log := logs.WithContext(ctx, l.logger)
+	log.Debug("FindAll called")
 	defer func() {
 		if err == nil {
-			l.logger.Debug("FindAll completed")
+			log.Debug("FindAll completed")
 		} else {
-			l.logger.Error("FindAll error", zap.Error(err))
+			log.Error("FindAll error", zap.Error(err))
 		}
 	}()
-	return l.next.FindAll()
+	return l.next.FindAll(ctx)
 }
 
-func (l *rentalRepositoryLogger) FindByID(id uint) (rental domain.Rental, err error) {
-	l.logger.Debug("FindByID called", zap.Uint("id", id))
+func (l *rentalRepositoryLogger) FindByID(ctx context.Context, id uint) (rental domain.Rental, err error) {
+	log := logs.WithContext(ctx, l.logger)
+	log.Debug("FindByID called", zap.Uint("id", id))
 	defer func() {
 		if err == nil {
-			l.logger.Debug("FindByID completed", zap.String("rental", fmt.Sprintf("%v", rental)))
+			log.Debug("FindByID completed", zap.String("rental", fmt.Sprintf("%v", rental)))
 		} else {
-			l.logger.Error("FindByID error", zap.Error(err))
+			log.Error("FindByID error", zap.Error(err))
 		}
 	}()
-	return l.next.FindByID(id)
+	return l.next.FindByID(ctx, id)
 }
 
-func (l *rentalRepositoryLogger) FindByFilter(filter domain.RentalFindFilter) (rentals domain.Response[domain.Rental], err error) {
-	l.logger.Debug("FindByFilter called", zap.String("filter", filter.String()))
+func (l *rentalRepositoryLogger) FindByIDs(ctx context.Context, ids []uint) (rentals []domain.Rental, err error) {
+	log := logs.WithContext(ctx, l.logger)
+	log.Debug("FindByIDs called", zap.Uints("ids", ids))
 	defer func() {
 		if err == nil {
-			l.logger.Debug("FindByFilter completed")
+			log.Debug("FindByIDs completed", zap.Int("found", len(rentals)))
 		} else {
-			l.logger.Error("FindByFilter error", zap.Error(err))
+			log.Error("FindByIDs error", zap.Error(err))
 		}
 	}()
-	return l.next.FindByFilter(filter)
+	return l.next.FindByIDs(ctx, ids)
+}
+
+func (l *rentalRepositoryLogger) FindByFilter(ctx context.Context, filter domain.RentalFindFilter) (rentals domain.Response[domain.Rental], err error) {
+	log := logs.WithContext(ctx, l.logger)
+	log.Debug("FindByFilter called", zap.String("filter", filter.String()))
+	defer func() {
+		if err == nil {
+			log.Debug("FindByFilter completed")
+		} else {
+			log.Error("FindByFilter error", zap.Error(err))
+		}
+	}()
+	return l.next.FindByFilter(ctx, filter)
+}
+
+func (l *rentalRepositoryLogger) StreamByFilter(ctx context.Context, filter domain.RentalFindFilter, fn func(domain.Rental) error) (err error) {
+	log := logs.WithContext(ctx, l.logger)
+	log.Debug("StreamByFilter called", zap.String("filter", filter.String()))
+	defer func() {
+		if err == nil {
+			log.Debug("StreamByFilter completed")
+		} else {
+			log.Error("StreamByFilter error", zap.Error(err))
+		}
+	}()
+	return l.next.StreamByFilter(ctx, filter, fn)
+}
+
+func (l *rentalRepositoryLogger) Upsert(ctx context.Context, rentals []domain.Rental) (err error) {
+	log := logs.WithContext(ctx, l.logger)
+	log.Debug("Upsert called", zap.Int("count", len(rentals)))
+	defer func() {
+		if err == nil {
+			log.Debug("Upsert completed")
+		} else {
+			log.Error("Upsert error", zap.Error(err))
+		}
+	}()
+	return l.next.Upsert(ctx, rentals)
+}
+
+func (l *rentalRepositoryLogger) Update(ctx context.Context, rental domain.Rental) (updated domain.Rental, err error) {
+	log := logs.WithContext(ctx, l.logger)
+	log.Debug("Update called", zap.Uint("id", rental.ID), zap.Uint("version", rental.Version))
+	defer func() {
+		if err == nil {
+			log.Info("Rental updated", zap.Uint("id", rental.ID), zap.Uint("version", updated.Version))
+		} else if errors.Is(err, domain.ErrConflict) {
+			log.Debug("Update conflict", zap.Error(err))
+		} else {
+			log.Error("Update error", zap.Error(err))
+		}
+	}()
+	return l.next.Update(ctx, rental)
+}
+
+func (l *rentalRepositoryLogger) FindDeleted(ctx context.Context, filter domain.RentalFindFilter) (rentals domain.Response[domain.Rental], err error) {
+	log := logs.WithContext(ctx, l.logger)
+	log.Debug("FindDeleted called", zap.String("filter", filter.String()))
+	defer func() {
+		if err == nil {
+			log.Debug("FindDeleted completed")
+		} else {
+			log.Error("FindDeleted error", zap.Error(err))
+		}
+	}()
+	return l.next.FindDeleted(ctx, filter)
+}
+
+func (l *rentalRepositoryLogger) Restore(ctx context.Context, id uint) (rental domain.Rental, err error) {
+	log := logs.WithContext(ctx, l.logger)
+	log.Debug("Restore called", zap.Uint("id", id))
+	defer func() {
+		if err == nil {
+			log.Info("Rental restored", zap.Uint("id", id))
+		} else {
+			log.Error("Restore error", zap.Error(err))
+		}
+	}()
+	return l.next.Restore(ctx, id)
+}
+
+func (l *rentalRepositoryLogger) Purge(ctx context.Context, id uint) (err error) {
+	log := logs.WithContext(ctx, l.logger)
+	log.Debug("Purge called", zap.Uint("id", id))
+	defer func() {
+		if err == nil {
+			log.Info("Rental purged", zap.Uint("id", id))
+		} else {
+			log.Error("Purge error", zap.Error(err))
+		}
+	}()
+	return l.next.Purge(ctx, id)
+}
+
+func (l *rentalRepositoryLogger) PurgeDeleted(ctx context.Context, before time.Time) (purged []uint, err error) {
+	log := logs.WithContext(ctx, l.logger)
+	log.Debug("PurgeDeleted called", zap.Time("before", before))
+	defer func() {
+		if err == nil {
+			log.Info("Deleted rentals purged", zap.Time("before", before), zap.Int("purged", len(purged)))
+		} else {
+			log.Error("PurgeDeleted error", zap.Error(err))
+		}
+	}()
+	return l.next.PurgeDeleted(ctx, before)
+}
+
+func (l *rentalRepositoryLogger) FindRevisions(ctx context.Context, id uint, page domain.ViewFilter) (revisions domain.Response[domain.RentalRevision], err error) {
+	log := logs.WithContext(ctx, l.logger)
+	log.Debug("FindRevisions called", zap.Uint("id", id))
+	defer func() {
+		if err == nil {
+			log.Debug("FindRevisions completed", zap.Int("found", len(revisions.Items)))
+		} else {
+			log.Error("FindRevisions error", zap.Error(err))
+		}
+	}()
+	return l.next.FindRevisions(ctx, id, page)
+}
+
+func (l *rentalRepositoryLogger) FindAsOf(ctx context.Context, id uint, at time.Time) (rental domain.Rental, err error) {
+	log := logs.WithContext(ctx, l.logger)
+	log.Debug("FindAsOf called", zap.Uint("id", id), zap.Time("at", at))
+	defer func() {
+		if err == nil {
+			log.Debug("FindAsOf completed", zap.String("rental", fmt.Sprintf("%v", rental)))
+		} else {
+			log.Error("FindAsOf error", zap.Error(err))
+		}
+	}()
+	return l.next.FindAsOf(ctx, id, at)
 }
 
 // Add more methods as needed
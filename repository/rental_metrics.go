@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/plar/rentals-api/domain"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type rentalRepositoryMetrics struct {
+	next     domain.RentalRepository
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+}
+
+var _ domain.RentalRepository = (*rentalRepositoryMetrics)(nil)
+
+// NewRentalRepositoryMetrics records the latency and the errors of every repository call,
+// labelled by method, and registers the collectors on reg
+func NewRentalRepositoryMetrics(next domain.RentalRepository, reg prometheus.Registerer) domain.RentalRepository {
+	m := &rentalRepositoryMetrics{
+		next: next,
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "rentals",
+			Subsystem: "repository",
+			Name:      "call_duration_seconds",
+			Help:      "Latency of the rental repository calls.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "rentals",
+			Subsystem: "repository",
+			Name:      "call_errors_total",
+			Help:      "Number of rental repository calls which returned an error.",
+		}, []string{"method"}),
+	}
+	reg.MustRegister(m.duration, m.errors)
+	return m
+}
+
+func (m *rentalRepositoryMetrics) observe(method string, start time.Time, err error) {
+	m.duration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.errors.WithLabelValues(method).Inc()
+	}
+}
+
+func (m *rentalRepositoryMetrics) FindAll(ctx context.Context) (rentals []domain.Rental, err error) {
+	defer func(start time.Time) { m.observe("FindAll", start, err) }(time.Now())
+	return m.next.FindAll(ctx)
+}
+
+func (m *rentalRepositoryMetrics) FindByID(ctx context.Context, id uint) (rental domain.Rental, err error) {
+	defer func(start time.Time) { m.observe("FindByID", start, err) }(time.Now())
+	return m.next.FindByID(ctx, id)
+}
+
+func (m *rentalRepositoryMetrics) FindByIDs(ctx context.Context, ids []uint) (rentals []domain.Rental, err error) {
+	defer func(start time.Time) { m.observe("FindByIDs", start, err) }(time.Now())
+	return m.next.FindByIDs(ctx, ids)
+}
+
+func (m *rentalRepositoryMetrics) FindByFilter(ctx context.Context, filter domain.RentalFindFilter) (rentals domain.Response[domain.Rental], err error) {
+	defer func(start time.Time) { m.observe("FindByFilter", start, err) }(time.Now())
+	return m.next.FindByFilter(ctx, filter)
+}
+
+func (m *rentalRepositoryMetrics) StreamByFilter(ctx context.Context, filter domain.RentalFindFilter, fn func(domain.Rental) error) (err error) {
+	defer func(start time.Time) { m.observe("StreamByFilter", start, err) }(time.Now())
+	return m.next.StreamByFilter(ctx, filter, fn)
+}
+
+func (m *rentalRepositoryMetrics) Upsert(ctx context.Context, rentals []domain.Rental) (err error) {
+	defer func(start time.Time) { m.observe("Upsert", start, err) }(time.Now())
+	return m.next.Upsert(ctx, rentals)
+}
+
+func (m *rentalRepositoryMetrics) Update(ctx context.Context, rental domain.Rental) (updated domain.Rental, err error) {
+	defer func(start time.Time) { m.observe("Update", start, err) }(time.Now())
+	return m.next.Update(ctx, rental)
+}
+
+func (m *rentalRepositoryMetrics) FindDeleted(ctx context.Context, filter domain.RentalFindFilter) (rentals domain.Response[domain.Rental], err error) {
+	defer func(start time.Time) { m.observe("FindDeleted", start, err) }(time.Now())
+	return m.next.FindDeleted(ctx, filter)
+}
+
+func (m *rentalRepositoryMetrics) Restore(ctx context.Context, id uint) (rental domain.Rental, err error) {
+	defer func(start time.Time) { m.observe("Restore", start, err) }(time.Now())
+	return m.next.Restore(ctx, id)
+}
+
+func (m *rentalRepositoryMetrics) Purge(ctx context.Context, id uint) (err error) {
+	defer func(start time.Time) { m.observe("Purge", start, err) }(time.Now())
+	return m.next.Purge(ctx, id)
+}
+
+func (m *rentalRepositoryMetrics) PurgeDeleted(ctx context.Context, before time.Time) (purged []uint, err error) {
+	defer func(start time.Time) { m.observe("PurgeDeleted", start, err) }(time.Now())
+	return m.next.PurgeDeleted(ctx, before)
+}
+
+func (m *rentalRepositoryMetrics) FindRevisions(ctx context.Context, id uint, page domain.ViewFilter) (revisions domain.Response[domain.RentalRevision], err error) {
+	defer func(start time.Time) { m.observe("FindRevisions", start, err) }(time.Now())
+	return m.next.FindRevisions(ctx, id, page)
+}
+
+func (m *rentalRepositoryMetrics) FindAsOf(ctx context.Context, id uint, at time.Time) (rental domain.Rental, err error) {
+	defer func(start time.Time) { m.observe("FindAsOf", start, err) }(time.Now())
+	return m.next.FindAsOf(ctx, id, at)
+}
+
+// Add more methods as needed
@@ -0,0 +1,41 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/plar/rentals-api/domain"
+	"github.com/plar/rentals-api/repository"
+	"github.com/plar/rentals-api/repository/mocks"
+)
+
+func TestRentalRepositoryMetrics(t *testing.T) {
+	mockRepo := new(mocks.RentalRepository)
+	mockRepo.On("FindByID", mock.Anything, uint(1)).Return(domain.Rental{ID: 1}, nil)
+	mockRepo.On("FindByID", mock.Anything, uint(2)).Return(domain.Rental{}, errors.New("record not found"))
+
+	reg := prometheus.NewRegistry()
+	repo := repository.NewRentalRepositoryMetrics(mockRepo, reg)
+
+	rental, err := repo.FindByID(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), rental.ID)
+	_, err = repo.FindByID(context.Background(), 2)
+	assert.EqualError(t, err, "record not found")
+
+	expected := `
+# HELP rentals_repository_call_errors_total Number of rental repository calls which returned an error.
+# TYPE rentals_repository_call_errors_total counter
+rentals_repository_call_errors_total{method="FindByID"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected), "rentals_repository_call_errors_total"))
+	assert.Equal(t, 1, testutil.CollectAndCount(reg, "rentals_repository_call_duration_seconds"))
+	mockRepo.AssertExpectations(t)
+}
@@ -11,6 +11,8 @@ type Rental struct {
 	CreatedAt time.Time      `gorm:"column:created;autoCreateTime"`
 	UpdatedAt time.Time      `gorm:"column:updated;autoUpdateTime"`
 	DeletedAt gorm.DeletedAt `gorm:"index"`
+	// Version is incremented by every write, see nextVersion
+	Version uint `gorm:"default:1"`
 
 	UserID uint `gorm:"column:user_id"`
 	User   User
@@ -1,6 +1,13 @@
 package repository
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/plar/rentals-api/config"
 	"github.com/plar/rentals-api/domain"
 	"go.uber.org/zap"
 
@@ -8,40 +15,75 @@ import (
 	"gorm.io/gorm/clause"
 )
 
+const (
+	// streamBatchSize is the number of rows StreamByFilter keeps in memory at once
+	streamBatchSize = 500
+	// upsertBatchSize is the number of rows sent in a single INSERT statement
+	upsertBatchSize = 100
+)
+
 type rentalRepository struct {
-	db     *gorm.DB
-	logger *zap.Logger
+	db      *DBRouter
+	dialect dialect
+	cfg     config.RepositoryConfig
+	logger  *zap.Logger
 }
 
 var _ domain.RentalRepository = (*rentalRepository)(nil)
 
-func NewRentalRepository(db *gorm.DB, logger *zap.Logger) domain.RentalRepository {
+func NewRentalRepository(db *gorm.DB, cfg config.RepositoryConfig, logger *zap.Logger) domain.RentalRepository {
+	return NewRoutedRentalRepository(NewDBRouter(db, nil, 0, logger), cfg, logger)
+}
+
+// NewRoutedRentalRepository returns a repository which reads from the replicas of router
+func NewRoutedRentalRepository(router *DBRouter, cfg config.RepositoryConfig, logger *zap.Logger) domain.RentalRepository {
 	if logger == nil {
 		logger = zap.NewNop()
 	}
 
 	return &rentalRepository{
-		db:     db,
-		logger: logger,
+		db:      router,
+		dialect: dialectOf(router.Primary(), cfg.Spatial, logger),
+		cfg:     cfg,
+		logger:  logger,
 	}
 }
 
-func RentalRepositoryMigrate(db *gorm.DB) {
-	// Migrate the schema
-	db.AutoMigrate(&User{})
-	db.AutoMigrate(&Rental{})
+// queryError makes a canceled or timed out context visible to the callers, the drivers report it
+// in their own way (pgconn timeout error, "canceling statement due to user request", ...)
+func queryError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil && !errors.Is(err, ctxErr) {
+		return fmt.Errorf("%w: %v", ctxErr, err)
+	}
+	return err
 }
 
-func (r *rentalRepository) FindAll() ([]domain.Rental, error) {
+func (r *rentalRepository) FindAll(ctx context.Context) ([]domain.Rental, error) {
 	var rentals []Rental
-	err := r.db.Preload("User").Find(&rentals).Error
-	return toDomainRentals(rentals), err
+	err := r.db.Read(ctx, func(db *gorm.DB) error {
+		return db.WithContext(ctx).Preload("User").Find(&rentals).Error
+	})
+	return toDomainRentals(rentals), queryError(ctx, err)
 }
 
-func (r *rentalRepository) FindByID(id uint) (domain.Rental, error) {
+func (r *rentalRepository) FindByID(ctx context.Context, id uint) (domain.Rental, error) {
 	var rental Rental
-	err := r.db.Preload("User").First(&rental, id).Error
-	return toDomainRental(rental), err
+	err := r.db.Read(ctx, func(db *gorm.DB) error {
+		return db.WithContext(ctx).Preload("User").First(&rental, id).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.Rental{}, domain.ErrRentalNotFound
+	}
+	return toDomainRental(rental), queryError(ctx, err)
+}
+
+func (r *rentalRepository) FindByIDs(ctx context.Context, ids []uint) ([]domain.Rental, error) {
+	var rentals []Rental
+	// join users instead of preloading them to keep it a single query
+	err := r.db.Read(ctx, func(db *gorm.DB) error {
+		return db.WithContext(ctx).Joins("User").Where("rentals.id IN ?", ids).Find(&rentals).Error
+	})
+	return toDomainRentals(rentals), queryError(ctx, err)
 }
 
 func (r *rentalRepository) applyViewFilter(filter domain.ViewFilter) func(db *gorm.DB) *gorm.DB {
@@ -55,7 +97,8 @@ func (r *rentalRepository) applyViewFilter(filter domain.ViewFilter) func(db *go
 		if sort, sortOk := filter.Sort(); sortOk {
 			query = query.Order(clause.OrderByColumn{Column: clause.Column{Name: sort.Field()}, Desc: sort.IsDesc()})
 		}
-		return query
+		// the ties are in ID order, so the pages of a listing neither overlap nor skip rentals
+		return query.Order(clause.OrderByColumn{Column: clause.Column{Table: clause.CurrentTable, Name: "id"}})
 	}
 }
 
@@ -79,30 +122,247 @@ func (r *rentalRepository) applySelectionFilter(filter domain.RentalFindFilter)
 
 		// near
 		if near, nearOk := filter.Coords(); nearOk {
-			// Calculate the distance between two points using the Haversine formula
-			// You can adjust the distance value (100 miles) according to your needs
-			query = query.Where("earth_distance(ll_to_earth(lat, lng), ll_to_earth(?, ?)) <= ?", near[0], near[1], 100*1609.34)
+			// the great-circle distance, the radius is configured by repository.near_radius_miles
+			query = r.dialect.near(query, near[0], near[1], r.cfg.NearRadiusMiles*domain.MetersPerMile)
 		}
 		return query
 	}
 }
 
-func (r *rentalRepository) FindByFilter(filter domain.RentalFindFilter) (domain.Response[domain.Rental], error) {
-	// preload Users
-	query := r.db.Preload("User")
-	query = query.Scopes(r.applySelectionFilter(filter))
+func (r *rentalRepository) FindByFilter(ctx context.Context, filter domain.RentalFindFilter) (domain.Response[domain.Rental], error) {
+	var (
+		items []Rental
+		total int64
+	)
+	err := r.db.Read(ctx, func(db *gorm.DB) error {
+		// preload Users
+		query := db.WithContext(ctx).Preload("User")
+		query = query.Scopes(r.applySelectionFilter(filter))
+
+		// count total filtered items
+		query.Model(items).Count(&total)
+		query = query.Scopes(r.applyViewFilter(&filter))
+		// query filtered items
+		return query.Find(&items).Error
+	})
+
+	return domain.NewResponse(&filter, total, items, toDomainRentals), queryError(ctx, err)
+}
+
+func (r *rentalRepository) StreamByFilter(ctx context.Context, filter domain.RentalFindFilter, fn func(domain.Rental) error) error {
+	// FindInBatches pages by primary key (WHERE id > last ORDER BY id), so memory usage
+	// does not depend on the table size and no OFFSET scans are involved.
+	var batch []Rental
+	err := r.db.Read(ctx, func(db *gorm.DB) error {
+		visited := false
+		query := db.WithContext(ctx).Preload("User").Scopes(r.applySelectionFilter(filter))
+		err := query.FindInBatches(&batch, streamBatchSize, func(_ *gorm.DB, _ int) error {
+			for _, rental := range batch {
+				visited = true
+				if err := fn(toDomainRental(rental)); err != nil {
+					return permanentError{err}
+				}
+			}
+			return nil
+		}).Error
+		if err != nil && visited {
+			// fn saw rentals already, starting over on the primary would repeat them
+			return permanentError{err}
+		}
+		return err
+	})
+	return queryError(ctx, err)
+}
+
+func (r *rentalRepository) Upsert(ctx context.Context, rentals []domain.Rental) error {
+	var inserts, updates []Rental
+	for _, rental := range rentals {
+		if rental.ID == 0 {
+			inserts = append(inserts, fromDomainRental(rental))
+		} else {
+			updates = append(updates, fromDomainRental(rental))
+		}
+	}
+
+	err := r.db.Write(ctx, func(db *gorm.DB) error {
+		return r.upsert(ctx, db, inserts, updates)
+	})
+	return queryError(ctx, err)
+}
+
+func (r *rentalRepository) upsert(ctx context.Context, db *gorm.DB, inserts, updates []Rental) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		ids := make([]uint, len(updates))
+		for i, rental := range updates {
+			ids[i] = rental.ID
+		}
+		before, err := currentStates(tx, ids)
+		if err != nil {
+			return err
+		}
+
+		// users are not managed by the rentals import, only user_id is stored
+		tx = tx.Omit(clause.Associations)
+		if len(updates) > 0 {
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "id"}},
+				DoUpdates: append(clause.AssignmentColumns(append(rentalColumns(), "updated", "deleted_at")), nextVersion),
+			}).CreateInBatches(&updates, upsertBatchSize).Error
+			if err != nil {
+				return err
+			}
+			if err = r.dialect.syncRentalIDs(tx); err != nil {
+				return err
+			}
+		}
+		if len(inserts) > 0 {
+			if err := tx.CreateInBatches(&inserts, upsertBatchSize).Error; err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		revisions := make([]RentalRevision, 0, len(inserts)+len(updates))
+		for _, rental := range append(updates, inserts...) {
+			action, old := domain.RevisionCreate, (*domain.Rental)(nil)
+			if state, ok := before[rental.ID]; ok {
+				action, old = domain.RevisionUpdate, &state
+			}
+			revision, changed, err := newRevision(ctx, action, old, toDomainRental(rental), now)
+			if err != nil {
+				return err
+			}
+			if changed {
+				revisions = append(revisions, revision)
+			}
+		}
+		if len(revisions) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&revisions, upsertBatchSize).Error
+	})
+}
+
+func (r *rentalRepository) Update(ctx context.Context, rental domain.Rental) (domain.Rental, error) {
+	var updated Rental
+	err := r.db.Write(ctx, func(db *gorm.DB) error {
+		return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			before, err := currentStates(tx, []uint{rental.ID})
+			if err != nil {
+				return err
+			}
+			old, ok := before[rental.ID]
+			if !ok || old.DeletedAt != nil {
+				return domain.ErrRentalNotFound
+			}
+
+			values := rentalValues(fromDomainRental(rental))
+			values[nextVersion.Column.Name] = nextVersion.Value
+			res := tx.Model(&Rental{}).Where("id = ? AND version = ?", rental.ID, rental.Version).Updates(values)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return &domain.ConflictError{ID: rental.ID, Version: rental.Version}
+			}
+			if err = tx.Preload("User").First(&updated, rental.ID).Error; err != nil {
+				return err
+			}
+
+			revision, changed, err := newRevision(ctx, domain.RevisionUpdate, &old, toDomainRental(updated), time.Now())
+			if err != nil || !changed {
+				return err
+			}
+			return tx.Create(&revision).Error
+		})
+	})
+	return toDomainRental(updated), queryError(ctx, err)
+}
 
-	// count total filtered items
+func (r *rentalRepository) FindDeleted(ctx context.Context, filter domain.RentalFindFilter) (domain.Response[domain.Rental], error) {
 	var (
 		items []Rental
 		total int64
 	)
-	query.Model(items).Count(&total)
-	query = query.Scopes(r.applyViewFilter(&filter))
-	// query filtered items
-	err := query.Find(&items).Error
+	err := r.db.Read(ctx, func(db *gorm.DB) error {
+		query := db.WithContext(ctx).Unscoped().Preload("User").Where("deleted_at IS NOT NULL")
+		query = query.Scopes(r.applySelectionFilter(filter))
+
+		query.Model(items).Count(&total)
+		if _, ok := filter.Sort(); !ok {
+			query = query.Order("deleted_at DESC")
+		}
+		query = query.Scopes(r.applyViewFilter(&filter))
+		return query.Find(&items).Error
+	})
+
+	return domain.NewResponse(&filter, total, items, toDomainRentals), queryError(ctx, err)
+}
+
+func (r *rentalRepository) Restore(ctx context.Context, id uint) (domain.Rental, error) {
+	var rental Rental
+	err := r.db.Write(ctx, func(db *gorm.DB) error {
+		return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			before, err := currentStates(tx, []uint{id})
+			if err != nil {
+				return err
+			}
+			old, ok := before[id]
+			if !ok || old.DeletedAt == nil {
+				return domain.ErrRentalNotFound
+			}
+
+			if err = tx.Unscoped().Model(&Rental{}).Where("id = ?", id).
+				Updates(map[string]any{"deleted_at": nil, nextVersion.Column.Name: nextVersion.Value}).Error; err != nil {
+				return err
+			}
+			if err = tx.Preload("User").First(&rental, id).Error; err != nil {
+				return err
+			}
 
-	return domain.NewResponse(&filter, total, items, toDomainRentals), err
+			revision, _, err := newRevision(ctx, domain.RevisionRestore, &old, toDomainRental(rental), time.Now())
+			if err != nil {
+				return err
+			}
+			return tx.Create(&revision).Error
+		})
+	})
+	return toDomainRental(rental), queryError(ctx, err)
+}
+
+func (r *rentalRepository) Purge(ctx context.Context, id uint) error {
+	err := r.db.Write(ctx, func(db *gorm.DB) error {
+		return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			// only soft-deleted rentals are purged, a live rental has to be deleted first
+			res := tx.Unscoped().Where("deleted_at IS NOT NULL").Delete(&Rental{}, id)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return domain.ErrRentalNotFound
+			}
+			return tx.Where("rental_id = ?", id).Delete(&RentalRevision{}).Error
+		})
+	})
+	return queryError(ctx, err)
+}
+
+func (r *rentalRepository) PurgeDeleted(ctx context.Context, before time.Time) ([]uint, error) {
+	var purged []uint
+	err := r.db.Write(ctx, func(db *gorm.DB) error {
+		return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			purged = nil
+			err := tx.Unscoped().Model(&Rental{}).Where("deleted_at < ?", before).Order("id").Pluck("id", &purged).Error
+			if err != nil || len(purged) == 0 {
+				return err
+			}
+			if err = tx.Where("rental_id IN ?", purged).Delete(&RentalRevision{}).Error; err != nil {
+				return err
+			}
+			return tx.Unscoped().Delete(&Rental{}, purged).Error
+		})
+	})
+	return purged, queryError(ctx, err)
 }
 
 func toDomainRental(r Rental) domain.Rental {
@@ -133,6 +393,11 @@ func toDomainRental(r Rental) domain.Rental {
 			FirstName: r.User.FirstName,
 			LastName:  r.User.LastName,
 		},
+		Version: r.Version,
+	}
+	if r.DeletedAt.Valid {
+		deletedAt := r.DeletedAt.Time
+		dr.DeletedAt = &deletedAt
 	}
 	return dr
 }
@@ -146,3 +411,66 @@ func toDomainRentals(rs []Rental) (drs []domain.Rental) {
 	}
 	return
 }
+
+// fromDomainRental leaves the version out, it is not written from the rental but incremented by the
+// writes, see nextVersion
+func fromDomainRental(dr domain.Rental) Rental {
+	return Rental{
+		ID:              dr.ID,
+		UserID:          uint(dr.User.ID),
+		Name:            dr.Name,
+		Description:     dr.Description,
+		Type:            dr.Type,
+		Make:            dr.Make,
+		Model:           dr.Model,
+		Year:            dr.Year,
+		Length:          dr.Length,
+		Sleeps:          dr.Sleeps,
+		Price:           dr.Price.Day,
+		City:            dr.Location.City,
+		State:           dr.Location.State,
+		Zip:             dr.Location.Zip,
+		Country:         dr.Location.Country,
+		PrimaryImageURL: dr.PrimaryImageURL,
+		Lat:             dr.Location.Lat,
+		Lng:             dr.Location.Lng,
+	}
+}
+
+// nextVersion increments the version of a written rental
+var nextVersion = clause.Assignment{Column: clause.Column{Name: "version"}, Value: gorm.Expr(`"rentals"."version" + 1`)}
+
+// rentalValues are the columns of r overwritten by an update, the ID, the timestamps and the version
+// are managed apart
+func rentalValues(r Rental) map[string]any {
+	return map[string]any{
+		"user_id":           r.UserID,
+		"name":              r.Name,
+		"description":       r.Description,
+		"type":              r.Type,
+		"vehicle_make":      r.Make,
+		"vehicle_model":     r.Model,
+		"vehicle_year":      r.Year,
+		"vehicle_length":    r.Length,
+		"sleeps":            r.Sleeps,
+		"price_per_day":     r.Price,
+		"home_city":         r.City,
+		"home_state":        r.State,
+		"home_zip":          r.Zip,
+		"home_country":      r.Country,
+		"primary_image_url": r.PrimaryImageURL,
+		"lat":               r.Lat,
+		"lng":               r.Lng,
+	}
+}
+
+// rentalColumns are the names of rentalValues in a stable order
+func rentalColumns() []string {
+	values := rentalValues(Rental{})
+	columns := make([]string, 0, len(values))
+	for column := range values {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	return columns
+}
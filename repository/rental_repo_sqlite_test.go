@@ -0,0 +1,180 @@
+package repository_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/plar/rentals-api/config"
+	"github.com/plar/rentals-api/domain"
+	"github.com/plar/rentals-api/migrate"
+	"github.com/plar/rentals-api/repository"
+	"github.com/plar/rentals-api/repository/repositorytest"
+)
+
+// openSQLite returns a migrated database in a temporary file with the users of the fixture
+func openSQLite(t *testing.T, fixture repositorytest.Fixture) *gorm.DB {
+	path := filepath.Join(t.TempDir(), "rentals.db")
+	db, err := gorm.Open(sqlite.Open(config.DBConfig{SQLitePath: path}.SQLiteDSN()), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	migrations, err := migrate.Embedded(migrate.SQLite)
+	require.NoError(t, err)
+	_, err = migrate.New(sqlDB, migrate.SQLite, migrations, nil).Up(context.Background())
+	require.NoError(t, err)
+
+	for _, user := range fixture.Users {
+		require.NoError(t, db.Create(&repository.User{Model: gorm.Model{ID: uint(user.ID)}, FirstName: user.FirstName, LastName: user.LastName}).Error)
+	}
+	return db
+}
+
+func TestContractSQLite(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T, cfg config.RepositoryConfig, fixture repositorytest.Fixture) domain.RentalRepository {
+		db := openSQLite(t, fixture)
+		repo := repository.NewRentalRepository(db, cfg, nil)
+		require.NoError(t, repo.Upsert(context.Background(), fixture.Rentals))
+		for _, rental := range fixture.Rentals {
+			if rental.DeletedAt != nil {
+				require.NoError(t, db.Exec(`UPDATE rentals SET deleted_at = ? WHERE id = ?`, *rental.DeletedAt, rental.ID).Error)
+			}
+		}
+		return repo
+	})
+}
+
+func TestSQLiteWrites(t *testing.T) {
+	ctx := context.Background()
+	fixture := repositorytest.NewFixture()
+	db := openSQLite(t, fixture)
+	repo := repository.NewRentalRepository(db, config.Default().Repository, nil)
+	softDelete := func(id uint) {
+		require.NoError(t, db.Exec(`UPDATE rentals SET deleted_at = ? WHERE id = ?`, time.Now().UTC(), id).Error)
+	}
+
+	// inserted with the IDs of the fixture, a rental without ID follows the largest one
+	require.NoError(t, repo.Upsert(ctx, fixture.Rentals[:3]))
+	added := fixture.Rentals[3]
+	added.ID = 0
+	require.NoError(t, repo.Upsert(ctx, []domain.Rental{added}))
+	rentals, err := repo.FindAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, rentals, 4)
+	assert.Equal(t, uint(4), rentals[3].ID)
+
+	rental, err := repo.FindByID(ctx, 1)
+	require.NoError(t, err)
+	rental.Price.Day = 20000
+	updated, err := repo.Update(ctx, rental)
+	require.NoError(t, err)
+	assert.Equal(t, 20000, updated.Price.Day)
+	assert.Equal(t, rental.Version+1, updated.Version)
+
+	_, err = repo.Update(ctx, rental)
+	var conflict *domain.ConflictError
+	assert.ErrorAs(t, err, &conflict)
+	rental.ID = 99
+	_, err = repo.Update(ctx, rental)
+	assert.ErrorIs(t, err, domain.ErrRentalNotFound)
+
+	page, _ := domain.NewRentalFilterBuilder().Build()
+	revisions, err := repo.FindRevisions(ctx, 1, &page)
+	require.NoError(t, err)
+	require.Len(t, revisions.Items, 2)
+	assert.Equal(t, domain.RevisionUpdate, revisions.Items[0].Action)
+	assert.Equal(t, domain.RevisionCreate, revisions.Items[1].Action)
+	before, err := repo.FindAsOf(ctx, 1, revisions.Items[1].ChangedAt)
+	require.NoError(t, err)
+	assert.Equal(t, 16900, before.Price.Day)
+
+	softDelete(1)
+	_, err = repo.FindByID(ctx, 1)
+	assert.ErrorIs(t, err, domain.ErrRentalNotFound)
+
+	restored, err := repo.Restore(ctx, 1)
+	require.NoError(t, err)
+	assert.Nil(t, restored.DeletedAt)
+	_, err = repo.Restore(ctx, 1)
+	assert.ErrorIs(t, err, domain.ErrRentalNotFound)
+
+	assert.ErrorIs(t, repo.Purge(ctx, 2), domain.ErrRentalNotFound)
+	softDelete(2)
+	require.NoError(t, repo.Purge(ctx, 2))
+	revisions, err = repo.FindRevisions(ctx, 2, &page)
+	require.NoError(t, err)
+	assert.Empty(t, revisions.Items)
+}
+
+// TestSQLiteNear checks the bounding box on the edges, across the antimeridian and around a pole
+func TestSQLiteNear(t *testing.T) {
+	ctx := context.Background()
+	fixture := repositorytest.NewFixture()
+	rental := func(id uint, lat, lng float64) domain.Rental {
+		r := fixture.Rentals[0]
+		r.ID, r.Location.Lat, r.Location.Lng = id, lat, lng
+		return r
+	}
+	repo := repository.NewRentalRepository(openSQLite(t, fixture), config.Default().Repository, nil)
+	require.NoError(t, repo.Upsert(ctx, []domain.Rental{
+		rental(1, -17.8, 179.9),
+		rental(2, -17.8, -179.9),
+		rental(3, 89.9, 0),
+		rental(4, 89.9, 180),
+		rental(5, 60, 0),
+	}))
+
+	tests := []struct {
+		name   string
+		coords [2]float64
+		want   []uint
+	}{
+		{"antimeridian west", [2]float64{-17.8, 179.95}, []uint{1, 2}},
+		{"antimeridian east", [2]float64{-17.8, -179.95}, []uint{1, 2}},
+		{"pole", [2]float64{89.95, 90}, []uint{3, 4}},
+		{"high latitude", [2]float64{60, 1.5}, []uint{5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := domain.NewRentalFilterBuilder().WithCoords(tt.coords).Build()
+			require.NoError(t, err)
+			response, err := repo.FindByFilter(ctx, filter)
+			require.NoError(t, err)
+			ids := make([]uint, len(response.Items))
+			for i, item := range response.Items {
+				ids[i] = item.ID
+			}
+			assert.Equal(t, tt.want, ids)
+		})
+	}
+}
+
+func TestSQLiteImages(t *testing.T) {
+	ctx := context.Background()
+	fixture := repositorytest.NewFixture()
+	db := openSQLite(t, fixture)
+	rentals := repository.NewRentalRepository(db, config.Default().Repository, nil)
+	require.NoError(t, rentals.Upsert(ctx, fixture.Rentals[:2]))
+	repo := repository.NewRentalImageRepository(db)
+
+	repositorytest.RunImages(t, repo)
+
+	_, err := repo.Add(ctx, domain.RentalImage{RentalID: 99, Key: "missing/original.jpg"})
+	assert.ErrorIs(t, err, domain.ErrRentalNotFound)
+
+	// the images go with the purged rental
+	require.NoError(t, db.Exec(`UPDATE rentals SET deleted_at = ? WHERE id = 2`, time.Now().UTC()).Error)
+	require.NoError(t, rentals.Purge(ctx, 2))
+	images, err := repo.FindByRentalIDs(ctx, []uint{2})
+	require.NoError(t, err)
+	assert.Empty(t, images)
+}
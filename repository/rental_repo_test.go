@@ -1,13 +1,20 @@
 package repository_test
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"log"
 	"os"
+	"reflect"
 	"regexp"
 	"testing"
 	"time"
 
+	"github.com/plar/rentals-api/auth"
+	"github.com/plar/rentals-api/config"
 	"github.com/plar/rentals-api/domain"
 	"github.com/plar/rentals-api/repository"
 
@@ -17,6 +24,10 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 type RentalRepoTestSuite struct {
@@ -41,6 +52,18 @@ func GormLogger() logger.Interface {
 	return logger.New(logWriter, logCfg)
 }
 
+// jsonArg matches a JSON argument regardless of the key order
+type jsonArg string
+
+func (a jsonArg) Match(v driver.Value) bool {
+	data, ok := v.([]byte)
+	if !ok {
+		return false
+	}
+	var got, want any
+	return json.Unmarshal(data, &got) == nil && json.Unmarshal([]byte(a), &want) == nil && reflect.DeepEqual(got, want)
+}
+
 func (s *RentalRepoTestSuite) BeforeTest(suiteName, testName string) {
 	var (
 		err error
@@ -98,8 +121,8 @@ func (s *RentalRepoTestSuite) TestFindAll() {
 	`)).WithArgs(1).WillReturnRows(userRows)
 
 	// run repo test
-	rentalRepo := repository.NewRentalRepository(s.gormdb, nil)
-	actualRentals, err := rentalRepo.FindAll()
+	rentalRepo := repository.NewRentalRepository(s.gormdb, config.Default().Repository, nil)
+	actualRentals, err := rentalRepo.FindAll(context.Background())
 
 	// check asserts
 	s.Assertions.NoError(err)
@@ -141,6 +164,453 @@ func (s *RentalRepoTestSuite) TestFindAll() {
 	s.Assertions.NoError(s.mock.ExpectationsWereMet(), "Failed to meet expectations")
 }
 
+func (s *RentalRepoTestSuite) TestStreamByFilter() {
+	// setup mock
+	rentalRows := sqlmock.NewRows([]string{"id", "user_id", "name", "price_per_day"}).
+		AddRow(1, 1, "Rental 1", 16900).
+		AddRow(2, 1, "Rental 2", 15000)
+	s.mock.ExpectQuery(regexp.QuoteMeta(`
+	SELECT *
+	  FROM "rentals"
+	 WHERE price_per_day >= $1 AND "rentals"."deleted_at" IS NULL
+	 ORDER BY "rentals"."id" LIMIT 500
+	`)).WithArgs(10000).WillReturnRows(rentalRows)
+
+	userRows := sqlmock.NewRows([]string{"id", "first_name", "last_name"}).AddRow(1, "John", "Smith")
+	s.mock.ExpectQuery(regexp.QuoteMeta(`
+	SELECT *
+	  FROM "users"
+	 WHERE "users"."id" = $1 AND "users"."deleted_at" IS NULL
+	`)).WithArgs(1).WillReturnRows(userRows)
+
+	filter, err := domain.NewRentalFilterBuilder().WithPriceMin(10000).Build()
+	s.Assertions.NoError(err)
+
+	// run repo test
+	var names []string
+	rentalRepo := repository.NewRentalRepository(s.gormdb, config.Default().Repository, nil)
+	err = rentalRepo.StreamByFilter(context.Background(), filter, func(r domain.Rental) error {
+		names = append(names, r.Name+" by "+r.User.FirstName)
+		return nil
+	})
+
+	// check asserts
+	s.Assertions.NoError(err)
+	s.Assertions.Equal([]string{"Rental 1 by John", "Rental 2 by John"}, names)
+	s.Assertions.NoError(s.mock.ExpectationsWereMet(), "Failed to meet expectations")
+}
+
+func (s *RentalRepoTestSuite) TestUpsert() {
+	rentals := []domain.Rental{
+		{ID: 7, Name: "Existing", Type: "camper-van", Price: domain.Price{Day: 100}, User: domain.User{ID: 1}},
+		{Name: "New", Type: "camper-van", Price: domain.Price{Day: 200}, User: domain.User{ID: 2}},
+	}
+	writer := auth.NewContext(context.Background(), auth.Identity{Subject: "admin-1", Roles: []string{"admin"}})
+
+	// setup mock
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "rentals" WHERE id IN ($1) FOR UPDATE`)).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "type", "price_per_day"}).AddRow(7, 1, "Existing", "camper-van", 90))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "rentals"`) + `.*` + regexp.QuoteMeta(`ON CONFLICT ("id") DO UPDATE SET`) + `.*"name"="excluded"."name".*` +
+		regexp.QuoteMeta(`"version"="rentals"."version" + 1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	s.mock.ExpectExec(regexp.QuoteMeta(`SELECT setval(pg_get_serial_sequence('rentals', 'id'), (SELECT MAX(id) FROM rentals))`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "rentals"`) + `.*` + regexp.QuoteMeta(`RETURNING "id"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(31))
+	// the update records the changed price only, the insert every field
+	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "rental_revisions" ("rental_id","action","actor","changed_at","diff","snapshot") VALUES ($1,$2,$3,$4,$5,$6),($7,$8,$9,$10,$11,$12)`)).
+		WithArgs(7, "update", "admin-1", sqlmock.AnyArg(), jsonArg(`{"price.day":{"old":90,"new":100}}`), sqlmock.AnyArg(),
+			31, "create", "admin-1", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	s.mock.ExpectCommit()
+
+	// run repo test
+	rentalRepo := repository.NewRentalRepository(s.gormdb, config.Default().Repository, nil)
+	err := rentalRepo.Upsert(writer, rentals)
+
+	// check asserts
+	s.Assertions.NoError(err)
+	s.Assertions.NoError(s.mock.ExpectationsWereMet(), "Failed to meet expectations")
+}
+
+func (s *RentalRepoTestSuite) TestUpsertRollback() {
+	rentals := []domain.Rental{{Name: "New", Type: "camper-van", Price: domain.Price{Day: 200}, User: domain.User{ID: 99}}}
+
+	// setup mock
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "rentals"`)).WillReturnError(errors.New("violates foreign key constraint"))
+	s.mock.ExpectRollback()
+
+	// run repo test
+	rentalRepo := repository.NewRentalRepository(s.gormdb, config.Default().Repository, nil)
+	err := rentalRepo.Upsert(context.Background(), rentals)
+
+	// check asserts
+	s.Assertions.EqualError(err, "violates foreign key constraint")
+	s.Assertions.NoError(s.mock.ExpectationsWereMet(), "Failed to meet expectations")
+}
+
+func (s *RentalRepoTestSuite) TestNearPostGIS() {
+	// setup mock
+	s.mock.ExpectQuery(`SELECT count\(\*\) FROM INFORMATION_SCHEMA.columns WHERE .*`).
+		WithArgs("rentals", "location").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`
+	SELECT *
+	  FROM "rentals"
+	 WHERE ST_DWithin(location, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography, $3, false) AND "rentals"."deleted_at" IS NULL
+	 ORDER BY "rentals"."id" LIMIT 500
+	`)).WithArgs(-117.93, 33.64, 160934.0).WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+
+	cfg := config.Default().Repository
+	cfg.Spatial = "postgis"
+	filter, err := domain.NewRentalFilterBuilder().WithCoords([2]float64{33.64, -117.93}).Build()
+	s.Assertions.NoError(err)
+
+	// run repo test
+	rentalRepo := repository.NewRentalRepository(s.gormdb, cfg, nil)
+	err = rentalRepo.StreamByFilter(context.Background(), filter, func(domain.Rental) error { return nil })
+
+	// check asserts
+	s.Assertions.NoError(err)
+	s.Assertions.NoError(s.mock.ExpectationsWereMet(), "Failed to meet expectations")
+}
+
+func (s *RentalRepoTestSuite) TestNearPostGISFallback() {
+	// setup mock, the database has no location column
+	s.mock.ExpectQuery(`SELECT count\(\*\) FROM INFORMATION_SCHEMA.columns WHERE .*`).
+		WithArgs("rentals", "location").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`
+	SELECT *
+	  FROM "rentals"
+	 WHERE earth_distance(ll_to_earth(lat, lng), ll_to_earth($1, $2)) <= $3 AND "rentals"."deleted_at" IS NULL
+	 ORDER BY "rentals"."id" LIMIT 500
+	`)).WithArgs(33.64, -117.93, 160934.0).WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+
+	cfg := config.Default().Repository
+	cfg.Spatial = "postgis"
+	filter, err := domain.NewRentalFilterBuilder().WithCoords([2]float64{33.64, -117.93}).Build()
+	s.Assertions.NoError(err)
+
+	// run repo test
+	rentalRepo := repository.NewRentalRepository(s.gormdb, cfg, nil)
+	err = rentalRepo.StreamByFilter(context.Background(), filter, func(domain.Rental) error { return nil })
+
+	// check asserts
+	s.Assertions.NoError(err)
+	s.Assertions.NoError(s.mock.ExpectationsWereMet(), "Failed to meet expectations")
+}
+
+func (s *RentalRepoTestSuite) TestFindDeleted() {
+	deletedAt := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// setup mock
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "rentals" WHERE deleted_at IS NOT NULL AND price_per_day <= $1`)).
+		WithArgs(20000).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "rentals" WHERE deleted_at IS NOT NULL AND price_per_day <= $1 ORDER BY deleted_at DESC,"rentals"."id" LIMIT 10`)).
+		WithArgs(20000).WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "deleted_at"}).AddRow(5, 1, "Deleted", deletedAt))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE "users"."id" = $1`)).
+		WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id", "first_name"}).AddRow(1, "John"))
+
+	// run repo test
+	filter, _ := domain.NewRentalFilterBuilder().WithPriceMax(20000).WithLimit(10).Build()
+	rentalRepo := repository.NewRentalRepository(s.gormdb, config.Default().Repository, nil)
+	response, err := rentalRepo.FindDeleted(context.Background(), filter)
+
+	// check asserts
+	s.Assertions.NoError(err)
+	s.Assertions.Equal(uint(1), response.Paginator.TotalItems)
+	s.Assertions.Len(response.Items, 1)
+	s.Assertions.Equal(uint(5), response.Items[0].ID)
+	s.Assertions.Equal("John", response.Items[0].User.FirstName)
+	s.Assertions.Equal(&deletedAt, response.Items[0].DeletedAt)
+	s.Assertions.NoError(s.mock.ExpectationsWereMet(), "Failed to meet expectations")
+}
+
+func (s *RentalRepoTestSuite) TestRestore() {
+	deletedAt := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// setup mock
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "rentals" WHERE id IN ($1) FOR UPDATE`)).WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "deleted_at"}).AddRow(5, 1, "Restored", deletedAt))
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE "rentals" SET "deleted_at"=$1,"version"="rentals"."version" + 1,"updated"=$2 WHERE id = $3`)).
+		WithArgs(nil, sqlmock.AnyArg(), 5).WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "rentals" WHERE "rentals"."id" = $1 AND "rentals"."deleted_at" IS NULL`)).
+		WithArgs(5).WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name"}).AddRow(5, 1, "Restored"))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE "users"."id" = $1`)).
+		WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id", "first_name"}).AddRow(1, "John"))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "rental_revisions"`)).
+		WithArgs(5, "restore", "system", sqlmock.AnyArg(), jsonArg(`{"deleted_at":{"old":"2023-05-01T12:00:00Z","new":null}}`), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	s.mock.ExpectCommit()
+	// a rental which is not deleted
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "rentals" WHERE id IN ($1) FOR UPDATE`)).WithArgs(6).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "deleted_at"}).AddRow(6, nil))
+	s.mock.ExpectRollback()
+
+	// run repo test
+	rentalRepo := repository.NewRentalRepository(s.gormdb, config.Default().Repository, nil)
+	rental, err := rentalRepo.Restore(context.Background(), 5)
+	s.Assertions.NoError(err)
+	s.Assertions.Equal("Restored", rental.Name)
+	s.Assertions.Equal("John", rental.User.FirstName)
+	s.Assertions.Nil(rental.DeletedAt)
+
+	_, err = rentalRepo.Restore(context.Background(), 6)
+	s.Assertions.ErrorIs(err, domain.ErrRentalNotFound)
+	s.Assertions.NoError(s.mock.ExpectationsWereMet(), "Failed to meet expectations")
+}
+
+func (s *RentalRepoTestSuite) TestUpdate() {
+	rental := domain.Rental{ID: 5, Name: "Renamed", Type: "camper-van", Price: domain.Price{Day: 100}, User: domain.User{ID: 1}, Version: 3}
+	writer := auth.NewContext(context.Background(), auth.Identity{Subject: "1", Roles: []string{"owner"}})
+
+	// setup mock
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "rentals" WHERE id IN ($1) FOR UPDATE`)).WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "type", "price_per_day", "version"}).AddRow(5, 1, "Original", "camper-van", 100, 3))
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE "rentals" SET`) + `.*` + regexp.QuoteMeta(`"version"="rentals"."version" + 1,"updated"=$18 WHERE (id = $19 AND version = $20) AND "rentals"."deleted_at" IS NULL`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "rentals" WHERE "rentals"."id" = $1 AND "rentals"."deleted_at" IS NULL`)).
+		WithArgs(5).WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "type", "price_per_day", "version"}).AddRow(5, 1, "Renamed", "camper-van", 100, 4))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE "users"."id" = $1`)).
+		WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id", "first_name"}).AddRow(1, "John"))
+	// the version is not part of the diff
+	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "rental_revisions"`)).
+		WithArgs(5, "update", "1", sqlmock.AnyArg(), jsonArg(`{"name":{"old":"Original","new":"Renamed"}}`), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	s.mock.ExpectCommit()
+	// a rental changed since version 3
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "rentals" WHERE id IN ($1) FOR UPDATE`)).WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow(5, 4))
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE "rentals" SET`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectRollback()
+	// a deleted rental
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "rentals" WHERE id IN ($1) FOR UPDATE`)).WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "deleted_at"}).AddRow(5, time.Now()))
+	s.mock.ExpectRollback()
+
+	// run repo test
+	rentalRepo := repository.NewRentalRepository(s.gormdb, config.Default().Repository, nil)
+	updated, err := rentalRepo.Update(writer, rental)
+	s.Assertions.NoError(err)
+	s.Assertions.Equal("Renamed", updated.Name)
+	s.Assertions.Equal(uint(4), updated.Version)
+
+	_, err = rentalRepo.Update(writer, rental)
+	s.Assertions.ErrorIs(err, domain.ErrConflict)
+	var conflict *domain.ConflictError
+	s.Assertions.ErrorAs(err, &conflict)
+	s.Assertions.Equal(uint(3), conflict.Version)
+
+	_, err = rentalRepo.Update(writer, rental)
+	s.Assertions.ErrorIs(err, domain.ErrRentalNotFound)
+	s.Assertions.NoError(s.mock.ExpectationsWereMet(), "Failed to meet expectations")
+}
+
+func (s *RentalRepoTestSuite) TestPurge() {
+	before := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// setup mock
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "rentals" WHERE deleted_at IS NOT NULL AND "rentals"."id" = $1`)).
+		WithArgs(5).WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "rental_revisions" WHERE rental_id = $1`)).
+		WithArgs(5).WillReturnResult(sqlmock.NewResult(0, 4))
+	s.mock.ExpectCommit()
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "rentals" WHERE deleted_at IS NOT NULL AND "rentals"."id" = $1`)).
+		WithArgs(6).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectRollback()
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id" FROM "rentals" WHERE deleted_at < $1 ORDER BY id`)).
+		WithArgs(before).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2).AddRow(3).AddRow(4))
+	s.mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "rental_revisions" WHERE rental_id IN ($1,$2,$3)`)).
+		WithArgs(2, 3, 4).WillReturnResult(sqlmock.NewResult(0, 9))
+	s.mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "rentals" WHERE "rentals"."id" IN ($1,$2,$3)`)).
+		WithArgs(2, 3, 4).WillReturnResult(sqlmock.NewResult(0, 3))
+	s.mock.ExpectCommit()
+
+	// run repo test
+	rentalRepo := repository.NewRentalRepository(s.gormdb, config.Default().Repository, nil)
+	s.Assertions.NoError(rentalRepo.Purge(context.Background(), 5))
+	s.Assertions.ErrorIs(rentalRepo.Purge(context.Background(), 6), domain.ErrRentalNotFound)
+	purged, err := rentalRepo.PurgeDeleted(context.Background(), before)
+	s.Assertions.NoError(err)
+	s.Assertions.Equal([]uint{2, 3, 4}, purged)
+	s.Assertions.NoError(s.mock.ExpectationsWereMet(), "Failed to meet expectations")
+}
+
+func (s *RentalRepoTestSuite) TestFindRevisions() {
+	changedAt := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// setup mock
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "rental_revisions" WHERE rental_id = $1`)).
+		WithArgs(5).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "rental_revisions" WHERE rental_id = $1 ORDER BY changed_at DESC, id DESC LIMIT 2 OFFSET 1`)).
+		WithArgs(5).WillReturnRows(sqlmock.NewRows([]string{"id", "rental_id", "action", "actor", "changed_at", "diff"}).
+		AddRow(2, 5, "update", "7", changedAt, []byte(`{"price.day":{"old":90,"new":100}}`)).
+		AddRow(1, 5, "baseline", "system", changedAt.Add(-time.Hour), []byte(`{}`)))
+
+	// run repo test
+	page, _ := domain.NewRentalFilterBuilder().WithLimit(2).WithOffset(1).Build()
+	rentalRepo := repository.NewRentalRepository(s.gormdb, config.Default().Repository, nil)
+	response, err := rentalRepo.FindRevisions(context.Background(), 5, &page)
+
+	// check asserts
+	s.Assertions.NoError(err)
+	s.Assertions.Equal(domain.Paginator{Limit: 2, Offset: 1, TotalItems: 3}, response.Paginator)
+	s.Assertions.Len(response.Items, 2)
+	s.Assertions.Equal(domain.RentalRevision{
+		ID: 2, RentalID: 5, Action: domain.RevisionUpdate, Actor: "7", ChangedAt: changedAt,
+		Diff: map[string]domain.FieldChange{"price.day": {Old: float64(90), New: float64(100)}},
+	}, response.Items[0])
+	s.Assertions.NoError(s.mock.ExpectationsWereMet(), "Failed to meet expectations")
+}
+
+func (s *RentalRepoTestSuite) TestFindAsOf() {
+	at := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// setup mock
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "rental_revisions" WHERE rental_id = $1 AND changed_at <= $2 ORDER BY changed_at DESC, id DESC,"rental_revisions"."id" LIMIT 1`)).
+		WithArgs(5, at).WillReturnRows(sqlmock.NewRows([]string{"id", "snapshot"}).
+		AddRow(2, []byte(`{"id":5,"name":"Maupin","price":{"day":90},"user":{"id":1}}`)))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE "users"."id" = $1`)).
+		WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id", "first_name"}).AddRow(1, "John"))
+	// the rental was deleted at the time
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "rental_revisions"`)).
+		WithArgs(6, at).WillReturnRows(sqlmock.NewRows([]string{"id", "snapshot"}).
+		AddRow(3, []byte(`{"id":6,"deleted_at":"2023-04-01T00:00:00Z"}`)))
+	// the rental did not exist yet
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "rental_revisions"`)).
+		WithArgs(7, at).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	// run repo test
+	rentalRepo := repository.NewRentalRepository(s.gormdb, config.Default().Repository, nil)
+	rental, err := rentalRepo.FindAsOf(context.Background(), 5, at)
+	s.Assertions.NoError(err)
+	s.Assertions.Equal(90, rental.Price.Day)
+	s.Assertions.Equal("John", rental.User.FirstName)
+
+	_, err = rentalRepo.FindAsOf(context.Background(), 6, at)
+	s.Assertions.ErrorIs(err, domain.ErrRentalNotFound)
+	_, err = rentalRepo.FindAsOf(context.Background(), 7, at)
+	s.Assertions.ErrorIs(err, domain.ErrRentalNotFound)
+	s.Assertions.NoError(s.mock.ExpectationsWereMet(), "Failed to meet expectations")
+}
+
+func (s *RentalRepoTestSuite) TestFindByIDs() {
+	// setup mock
+	rows := sqlmock.NewRows([]string{"id", "user_id", "name", "User__id", "User__first_name", "User__last_name"}).
+		AddRow(3, 1, "Rental 3", 1, "John", "Smith").
+		AddRow(1, 2, "Rental 1", 2, "Jane", "Doe")
+	s.mock.ExpectQuery(regexp.QuoteMeta(`FROM "rentals" LEFT JOIN "users" "User" ON "rentals"."user_id" = "User"."id" AND "User"."deleted_at" IS NULL WHERE rentals.id IN ($1,$2,$3) AND "rentals"."deleted_at" IS NULL`)).
+		WithArgs(3, 1, 42).WillReturnRows(rows)
+
+	// run repo test
+	rentalRepo := repository.NewRentalRepository(s.gormdb, config.Default().Repository, nil)
+	rentals, err := rentalRepo.FindByIDs(context.Background(), []uint{3, 1, 42})
+
+	// check asserts
+	s.Assertions.NoError(err)
+	s.Assertions.Len(rentals, 2)
+	s.Assertions.Equal(uint(3), rentals[0].ID)
+	s.Assertions.Equal("John", rentals[0].User.FirstName)
+	s.Assertions.Equal("Doe", rentals[1].User.LastName)
+	s.Assertions.NoError(s.mock.ExpectationsWereMet(), "Failed to meet expectations")
+}
+
+func (s *RentalRepoTestSuite) TestFindByIDCanceled() {
+	// setup mock
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "rentals"`)).
+		WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// run repo test
+	rentalRepo := repository.NewRentalRepository(s.gormdb, config.Default().Repository, nil)
+	_, err := rentalRepo.FindByID(ctx, 1)
+
+	// check asserts
+	s.Assertions.ErrorIs(err, context.DeadlineExceeded)
+}
+
+func (s *RentalRepoTestSuite) TestGormTracing() {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	s.Assertions.NoError(s.gormdb.Use(repository.NewGormTracing(tp)))
+
+	// setup mock
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "rentals" WHERE "rentals"."id" = $1`)).
+		WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	// run repo test, the parent span comes from the request
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "GET /rentals/:id")
+	rentalRepo := repository.NewRentalRepository(s.gormdb, config.Default().Repository, nil)
+	_, err := rentalRepo.FindByID(ctx, 1)
+	parent.End()
+
+	// check asserts
+	s.Assertions.Error(err)
+	spans := exporter.GetSpans()
+	s.Assertions.Len(spans, 2)
+	s.Assertions.Equal("gorm.query", spans[0].Name)
+	s.Assertions.Equal(parent.SpanContext().SpanID(), spans[0].Parent.SpanID())
+	s.Assertions.Contains(spans[0].Attributes, attribute.String("db.system", "postgres"))
+	s.Assertions.Contains(spans[0].Attributes, attribute.String("db.sql.table", "rentals"))
+	s.Assertions.Contains(spans[0].Attributes, attribute.String("db.statement",
+		`SELECT * FROM "rentals" WHERE "rentals"."id" = $1 AND "rentals"."deleted_at" IS NULL ORDER BY "rentals"."id" LIMIT 1`))
+	// record not found is not an error of the query
+	s.Assertions.Equal(codes.Unset, spans[0].Status.Code)
+	s.Assertions.NoError(s.mock.ExpectationsWereMet(), "Failed to meet expectations")
+}
+
+func (s *RentalRepoTestSuite) TestAPIKeyFindByHash() {
+	// setup mock
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "api_keys" WHERE hash = $1 LIMIT 1`)).
+		WithArgs("abc").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "prefix", "hash", "scopes", "rate", "burst"}).
+			AddRow(1, "scraper", "rk_0011aabb", "abc", "rentals:read,rentals:export", 5, 10))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "api_keys" WHERE hash = $1 LIMIT 1`)).
+		WithArgs("unknown").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	// run repo test
+	repo := repository.NewAPIKeyRepository(s.gormdb)
+	key, err := repo.FindByHash(context.Background(), "abc")
+	s.Assertions.NoError(err)
+	s.Assertions.Equal("scraper", key.Name)
+	s.Assertions.Equal([]string{"rentals:read", "rentals:export"}, key.Scopes)
+	s.Assertions.Equal(float64(5), key.Rate)
+	s.Assertions.Nil(key.RevokedAt)
+
+	_, err = repo.FindByHash(context.Background(), "unknown")
+	s.Assertions.ErrorIs(err, domain.ErrAPIKeyNotFound)
+	s.Assertions.NoError(s.mock.ExpectationsWereMet(), "Failed to meet expectations")
+}
+
+func (s *RentalRepoTestSuite) TestAPIKeyRevoke() {
+	// setup mock
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE "api_keys" SET "revoked_at"=$1 WHERE prefix = $2 AND revoked_at IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), "rk_0011aabb").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectCommit()
+
+	// run repo test
+	err := repository.NewAPIKeyRepository(s.gormdb).Revoke(context.Background(), "rk_0011aabb")
+
+	// check asserts
+	s.Assertions.ErrorIs(err, domain.ErrAPIKeyNotFound)
+	s.Assertions.NoError(s.mock.ExpectationsWereMet(), "Failed to meet expectations")
+}
+
 func TestRentalRepoSuite(t *testing.T) {
 	suite.Run(t, &RentalRepoTestSuite{})
 }
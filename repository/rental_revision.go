@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/plar/rentals-api/auth"
+	"github.com/plar/rentals-api/domain"
+)
+
+// systemActor is the actor of the writes made without a caller identity, e.g. by the background jobs
+const systemActor = "system"
+
+type RentalRevision struct {
+	ID        uint `gorm:"primary_key"`
+	RentalID  uint
+	Action    string
+	Actor     string
+	ChangedAt time.Time
+	Diff      []byte `gorm:"type:jsonb"`
+	Snapshot  []byte `gorm:"type:jsonb"`
+}
+
+func (r *RentalRevision) TableName() string {
+	return "rental_revisions"
+}
+
+// actor is the subject of the caller identity
+func actor(ctx context.Context) string {
+	if id, ok := auth.FromContext(ctx); ok && id.Subject != "" {
+		return id.Subject
+	}
+	return systemActor
+}
+
+// newRevision records the change of a rental from old to new, nil old is a created rental. ok is false
+// when nothing changed.
+func newRevision(ctx context.Context, action domain.RevisionAction, old *domain.Rental, new domain.Rental, at time.Time) (RentalRevision, bool, error) {
+	diff := domain.DiffRentals(old, new)
+	if len(diff) == 0 {
+		return RentalRevision{}, false, nil
+	}
+
+	diffJSON, err := json.Marshal(diff)
+	if err != nil {
+		return RentalRevision{}, false, err
+	}
+	snapshot, err := json.Marshal(domain.RevisionState(new))
+	if err != nil {
+		return RentalRevision{}, false, err
+	}
+	return RentalRevision{
+		RentalID:  new.ID,
+		Action:    string(action),
+		Actor:     actor(ctx),
+		ChangedAt: at,
+		Diff:      diffJSON,
+		Snapshot:  snapshot,
+	}, true, nil
+}
+
+// currentStates returns the rentals of ids as stored, the deleted ones included, locked until the end
+// of the transaction so their revisions are based on the state they overwrite
+func currentStates(tx *gorm.DB, ids []uint) (map[uint]domain.Rental, error) {
+	states := make(map[uint]domain.Rental, len(ids))
+	if len(ids) == 0 {
+		return states, nil
+	}
+
+	var rentals []Rental
+	if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Where("id IN ?", ids).Find(&rentals).Error; err != nil {
+		return nil, err
+	}
+	for _, rental := range rentals {
+		states[rental.ID] = toDomainRental(rental)
+	}
+	return states, nil
+}
+
+func toDomainRevision(r RentalRevision) (domain.RentalRevision, error) {
+	revision := domain.RentalRevision{
+		ID:        r.ID,
+		RentalID:  r.RentalID,
+		Action:    domain.RevisionAction(r.Action),
+		Actor:     r.Actor,
+		ChangedAt: r.ChangedAt,
+	}
+	err := json.Unmarshal(r.Diff, &revision.Diff)
+	return revision, err
+}
+
+func (r *rentalRepository) FindRevisions(ctx context.Context, id uint, page domain.ViewFilter) (domain.Response[domain.RentalRevision], error) {
+	var (
+		items []RentalRevision
+		total int64
+	)
+	err := r.db.Read(ctx, func(db *gorm.DB) error {
+		query := db.WithContext(ctx).Where("rental_id = ?", id)
+		if err := query.Model(&RentalRevision{}).Count(&total).Error; err != nil {
+			return err
+		}
+
+		query = query.Order("changed_at DESC, id DESC")
+		if limit, ok := page.Limit(); ok {
+			query = query.Limit(int(limit))
+		}
+		if offset, ok := page.Offset(); ok {
+			query = query.Offset(int(offset))
+		}
+		return query.Find(&items).Error
+	})
+	if err != nil {
+		return domain.Response[domain.RentalRevision]{}, queryError(ctx, err)
+	}
+
+	revisions := make([]domain.RentalRevision, 0, len(items))
+	for _, item := range items {
+		revision, err := toDomainRevision(item)
+		if err != nil {
+			return domain.Response[domain.RentalRevision]{}, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return domain.NewResponse(page, total, revisions, func(rs []domain.RentalRevision) []domain.RentalRevision { return rs }), nil
+}
+
+func (r *rentalRepository) FindAsOf(ctx context.Context, id uint, at time.Time) (domain.Rental, error) {
+	var rental domain.Rental
+	err := r.db.Read(ctx, func(db *gorm.DB) error {
+		// a read retried on the primary starts over
+		rental = domain.Rental{}
+		var revision RentalRevision
+		err := db.WithContext(ctx).Where("rental_id = ? AND changed_at <= ?", id, at).
+			Order("changed_at DESC, id DESC").First(&revision).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return permanentError{domain.ErrRentalNotFound}
+		} else if err != nil {
+			return err
+		}
+
+		if err = json.Unmarshal(revision.Snapshot, &rental); err != nil {
+			return permanentError{err}
+		}
+		if rental.DeletedAt != nil {
+			return permanentError{domain.ErrRentalNotFound}
+		}
+
+		// the revisions keep the owner by ID, the names are the current ones
+		var user User
+		err = db.WithContext(ctx).First(&user, rental.User.ID).Error
+		if err == nil {
+			rental.User.FirstName, rental.User.LastName = user.FirstName, user.LastName
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return nil
+	})
+	return rental, queryError(ctx, err)
+}
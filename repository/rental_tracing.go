@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/plar/rentals-api/domain"
+	"github.com/plar/rentals-api/tracing"
+)
+
+const tracerName = "github.com/plar/rentals-api/repository"
+
+type rentalRepositoryTracer struct {
+	next   domain.RentalRepository
+	tracer trace.Tracer
+}
+
+var _ domain.RentalRepository = (*rentalRepositoryTracer)(nil)
+
+// NewRentalRepositoryTracer wraps every repository call in a span named RentalRepository.<Method>
+func NewRentalRepositoryTracer(next domain.RentalRepository, tp trace.TracerProvider) domain.RentalRepository {
+	return &rentalRepositoryTracer{
+		next:   next,
+		tracer: tp.Tracer(tracerName),
+	}
+}
+
+func (t *rentalRepositoryTracer) start(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return t.tracer.Start(ctx, "RentalRepository."+method, trace.WithAttributes(attrs...))
+}
+
+func (t *rentalRepositoryTracer) FindAll(ctx context.Context) (rentals []domain.Rental, err error) {
+	ctx, span := t.start(ctx, "FindAll")
+	defer func() {
+		span.SetAttributes(attribute.Int("rentals.count", len(rentals)))
+		tracing.End(span, err)
+	}()
+	return t.next.FindAll(ctx)
+}
+
+func (t *rentalRepositoryTracer) FindByID(ctx context.Context, id uint) (rental domain.Rental, err error) {
+	ctx, span := t.start(ctx, "FindByID", attribute.Int64("rental.id", int64(id)))
+	defer func() { tracing.End(span, err) }()
+	return t.next.FindByID(ctx, id)
+}
+
+func (t *rentalRepositoryTracer) FindByIDs(ctx context.Context, ids []uint) (rentals []domain.Rental, err error) {
+	ctx, span := t.start(ctx, "FindByIDs", attribute.Int("rental.ids.count", len(ids)))
+	defer func() {
+		span.SetAttributes(attribute.Int("rentals.count", len(rentals)))
+		tracing.End(span, err)
+	}()
+	return t.next.FindByIDs(ctx, ids)
+}
+
+func (t *rentalRepositoryTracer) FindByFilter(ctx context.Context, filter domain.RentalFindFilter) (rentals domain.Response[domain.Rental], err error) {
+	ctx, span := t.start(ctx, "FindByFilter", attribute.String("rental.filter", filter.String()))
+	defer func() {
+		span.SetAttributes(attribute.Int("rentals.count", len(rentals.Items)))
+		tracing.End(span, err)
+	}()
+	return t.next.FindByFilter(ctx, filter)
+}
+
+func (t *rentalRepositoryTracer) StreamByFilter(ctx context.Context, filter domain.RentalFindFilter, fn func(domain.Rental) error) (err error) {
+	ctx, span := t.start(ctx, "StreamByFilter", attribute.String("rental.filter", filter.String()))
+	count := 0
+	defer func() {
+		span.SetAttributes(attribute.Int("rentals.count", count))
+		tracing.End(span, err)
+	}()
+	return t.next.StreamByFilter(ctx, filter, func(rental domain.Rental) error {
+		count++
+		return fn(rental)
+	})
+}
+
+func (t *rentalRepositoryTracer) Upsert(ctx context.Context, rentals []domain.Rental) (err error) {
+	ctx, span := t.start(ctx, "Upsert", attribute.Int("rentals.count", len(rentals)))
+	defer func() { tracing.End(span, err) }()
+	return t.next.Upsert(ctx, rentals)
+}
+
+func (t *rentalRepositoryTracer) Update(ctx context.Context, rental domain.Rental) (updated domain.Rental, err error) {
+	ctx, span := t.start(ctx, "Update", attribute.Int64("rental.id", int64(rental.ID)), attribute.Int64("rental.version", int64(rental.Version)))
+	defer func() { tracing.End(span, err) }()
+	return t.next.Update(ctx, rental)
+}
+
+func (t *rentalRepositoryTracer) FindDeleted(ctx context.Context, filter domain.RentalFindFilter) (rentals domain.Response[domain.Rental], err error) {
+	ctx, span := t.start(ctx, "FindDeleted", attribute.String("rental.filter", filter.String()))
+	defer func() {
+		span.SetAttributes(attribute.Int("rentals.count", len(rentals.Items)))
+		tracing.End(span, err)
+	}()
+	return t.next.FindDeleted(ctx, filter)
+}
+
+func (t *rentalRepositoryTracer) Restore(ctx context.Context, id uint) (rental domain.Rental, err error) {
+	ctx, span := t.start(ctx, "Restore", attribute.Int64("rental.id", int64(id)))
+	defer func() { tracing.End(span, err) }()
+	return t.next.Restore(ctx, id)
+}
+
+func (t *rentalRepositoryTracer) Purge(ctx context.Context, id uint) (err error) {
+	ctx, span := t.start(ctx, "Purge", attribute.Int64("rental.id", int64(id)))
+	defer func() { tracing.End(span, err) }()
+	return t.next.Purge(ctx, id)
+}
+
+func (t *rentalRepositoryTracer) PurgeDeleted(ctx context.Context, before time.Time) (purged []uint, err error) {
+	ctx, span := t.start(ctx, "PurgeDeleted", attribute.String("rental.deleted_before", before.Format(time.RFC3339)))
+	defer func() {
+		span.SetAttributes(attribute.Int("rentals.count", len(purged)))
+		tracing.End(span, err)
+	}()
+	return t.next.PurgeDeleted(ctx, before)
+}
+
+func (t *rentalRepositoryTracer) FindRevisions(ctx context.Context, id uint, page domain.ViewFilter) (revisions domain.Response[domain.RentalRevision], err error) {
+	ctx, span := t.start(ctx, "FindRevisions", attribute.Int64("rental.id", int64(id)))
+	defer func() {
+		span.SetAttributes(attribute.Int("revisions.count", len(revisions.Items)))
+		tracing.End(span, err)
+	}()
+	return t.next.FindRevisions(ctx, id, page)
+}
+
+func (t *rentalRepositoryTracer) FindAsOf(ctx context.Context, id uint, at time.Time) (rental domain.Rental, err error) {
+	ctx, span := t.start(ctx, "FindAsOf", attribute.Int64("rental.id", int64(id)), attribute.String("rental.as_of", at.Format(time.RFC3339)))
+	defer func() { tracing.End(span, err) }()
+	return t.next.FindAsOf(ctx, id, at)
+}
+
+// Add more methods as needed
@@ -0,0 +1,52 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/plar/rentals-api/domain"
+	"github.com/plar/rentals-api/repository"
+	"github.com/plar/rentals-api/repository/mocks"
+)
+
+func TestRentalRepositoryTracer(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	filter, err := domain.NewRentalFilterBuilder().WithPriceMin(10000).Build()
+	require.NoError(t, err)
+
+	mockRepo := new(mocks.RentalRepository)
+	mockRepo.On("FindByFilter", mock.Anything, filter).Return(domain.Response[domain.Rental]{Items: []domain.Rental{{ID: 1}, {ID: 2}}}, nil)
+	mockRepo.On("FindByID", mock.Anything, uint(2)).Return(domain.Rental{}, errors.New("record not found"))
+
+	repo := repository.NewRentalRepositoryTracer(mockRepo, tp)
+	_, err = repo.FindByFilter(context.Background(), filter)
+	assert.NoError(t, err)
+	_, err = repo.FindByID(context.Background(), 2)
+	assert.Error(t, err)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+
+	assert.Equal(t, "RentalRepository.FindByFilter", spans[0].Name)
+	assert.Contains(t, spans[0].Attributes, attribute.String("rental.filter", filter.String()))
+	assert.Contains(t, spans[0].Attributes, attribute.Int("rentals.count", 2))
+	assert.Equal(t, codes.Unset, spans[0].Status.Code)
+
+	assert.Equal(t, "RentalRepository.FindByID", spans[1].Name)
+	assert.Contains(t, spans[1].Attributes, attribute.Int64("rental.id", 2))
+	assert.Equal(t, codes.Error, spans[1].Status.Code)
+	assert.Equal(t, "record not found", spans[1].Status.Description)
+
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,88 @@
+package repositorytest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/plar/rentals-api/domain"
+)
+
+// RunImages checks the positions of the images kept by repo, which must be empty and hold the rentals 1 and 2
+// of NewFixture
+func RunImages(t *testing.T, repo domain.RentalImageRepository) {
+	ctx := context.Background()
+	image := func(rentalID uint, name string) domain.RentalImage {
+		return domain.RentalImage{
+			RentalID: rentalID,
+			Width:    1280,
+			Height:   960,
+			Key:      name + "/original.jpg",
+			Variants: []domain.ImageVariant{{Size: "thumb", Format: "webp", Width: 160, Height: 120, Key: name + "/thumb.webp"}},
+		}
+	}
+	keys := func(rentalID uint) []string {
+		byRental, err := repo.FindByRentalIDs(ctx, []uint{rentalID})
+		require.NoError(t, err)
+		var keys []string
+		for i, image := range byRental[rentalID] {
+			assert.Equal(t, i+1, image.Position)
+			keys = append(keys, image.Key)
+		}
+		return keys
+	}
+
+	var added []domain.RentalImage
+	for _, name := range []string{"a", "b", "c"} {
+		image, err := repo.Add(ctx, image(1, name))
+		require.NoError(t, err)
+		added = append(added, image)
+	}
+	other, err := repo.Add(ctx, image(2, "other"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, other.Position)
+	assert.Equal(t, 3, added[2].Position)
+	assert.Equal(t, image(1, "c").Variants, added[2].Variants)
+
+	byRental, err := repo.FindByRentalIDs(ctx, []uint{1, 2, 3})
+	require.NoError(t, err)
+	assert.Len(t, byRental[1], 3)
+	assert.Len(t, byRental[2], 1)
+	assert.NotContains(t, byRental, uint(3))
+
+	t.Run("reorder", func(t *testing.T) {
+		reordered, err := repo.Reorder(ctx, 1, []uint{added[2].ID, added[0].ID, added[1].ID})
+		require.NoError(t, err)
+		require.Len(t, reordered, 3)
+		assert.Equal(t, "c/original.jpg", reordered[0].Key)
+		assert.Equal(t, []string{"c/original.jpg", "a/original.jpg", "b/original.jpg"}, keys(1))
+
+		for _, ids := range [][]uint{
+			{added[0].ID, added[1].ID},
+			{added[0].ID, added[0].ID, added[1].ID},
+			{added[0].ID, added[1].ID, other.ID},
+		} {
+			_, err = repo.Reorder(ctx, 1, ids)
+			assert.ErrorIs(t, err, domain.ErrImageOrder, "ids %v", ids)
+		}
+		assert.Equal(t, []string{"c/original.jpg", "a/original.jpg", "b/original.jpg"}, keys(1))
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		deleted, err := repo.Delete(ctx, 1, added[2].ID)
+		require.NoError(t, err)
+		assert.Equal(t, "c/original.jpg", deleted.Key)
+		assert.Equal(t, []string{"a/original.jpg", "b/original.jpg"}, keys(1))
+
+		_, err = repo.Delete(ctx, 1, added[2].ID)
+		assert.ErrorIs(t, err, domain.ErrImageNotFound)
+		_, err = repo.Delete(ctx, 1, other.ID)
+		assert.ErrorIs(t, err, domain.ErrImageNotFound)
+
+		require.NoError(t, repo.DeleteAll(ctx, 1))
+		assert.Empty(t, keys(1))
+		assert.Equal(t, []string{"other/original.jpg"}, keys(2))
+	})
+}
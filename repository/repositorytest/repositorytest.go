@@ -0,0 +1,208 @@
+// Package repositorytest is the contract of domain.RentalRepository: the behavior of the lookups and
+// listings every implementation must have, checked against a fixture.
+package repositorytest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/plar/rentals-api/config"
+	"github.com/plar/rentals-api/domain"
+)
+
+// Fixture is the data a repository is seeded with, the rentals with DeletedAt are soft-deleted
+type Fixture struct {
+	Users   []domain.User
+	Rentals []domain.Rental
+}
+
+// Factory returns a repository configured with cfg which holds the fixture and nothing else, the rentals
+// keep the IDs of the fixture
+type Factory func(t *testing.T, cfg config.RepositoryConfig, fixture Fixture) domain.RentalRepository
+
+var (
+	john = domain.User{ID: 1, FirstName: "John", LastName: "Smith"}
+	jane = domain.User{ID: 2, FirstName: "Jane", LastName: "Doe"}
+
+	// costaMesa is the center of the near filters, the rentals 9 and 10 are 99.5 and 100.5 miles south
+	// of it, inside and outside the default radius
+	costaMesa = [2]float64{33.64, -117.93}
+	deletedAt = time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+)
+
+// NewFixture returns the fixture of the suite: ten rentals with ties on the price and the year, and a
+// deleted rental which matches every filter
+func NewFixture() Fixture {
+	rental := func(id uint, name string, price, year int, lat, lng float64, user domain.User) domain.Rental {
+		return domain.Rental{
+			ID:              id,
+			Name:            name,
+			Description:     "Description of " + name,
+			Type:            "camper-van",
+			Make:            "Volkswagen",
+			Model:           "Westfalia",
+			Year:            year,
+			Length:          15.5,
+			Sleeps:          4,
+			PrimaryImageURL: "https://example.com/rentals/" + name + ".jpg",
+			Price:           domain.Price{Day: price},
+			Location:        domain.Location{City: name, State: "CA", Zip: "92627", Country: "US", Lat: lat, Lng: lng},
+			User:            user,
+		}
+	}
+	deleted := rental(11, "Deleted", 12000, 1999, 33.64, -117.93, jane)
+	deleted.DeletedAt = &deletedAt
+
+	return Fixture{
+		Users: []domain.User{john, jane},
+		Rentals: []domain.Rental{
+			rental(1, "Costa Mesa", 16900, 1978, 33.64, -117.93, john),
+			rental(2, "Portland", 15000, 1989, 45.51, -122.68, jane),
+			rental(3, "San Diego", 18000, 1984, 32.83, -117.28, john),
+			rental(4, "Salt Lake City", 8900, 2016, 40.73, -111.92, jane),
+			rental(5, "Pacific Beach", 8000, 2005, 32.80, -117.24, john),
+			rental(6, "Charleston", 13000, 2003, 32.69, -79.96, john),
+			rental(7, "Rancho Mission Viejo", 15000, 2002, 33.53, -117.63, jane),
+			rental(8, "Newport Beach", 16900, 2016, 33.62, -117.93, john),
+			rental(9, "Inside the radius", 10000, 1995, 32.2015, -117.93, jane),
+			rental(10, "Outside the radius", 10000, 1995, 32.1871, -117.93, jane),
+			deleted,
+		},
+	}
+}
+
+// Run seeds a repository of factory with NewFixture and checks the lookups and listings, the suite does not
+// write to the repository
+func Run(t *testing.T, factory Factory) {
+	fixture := NewFixture()
+	repo := factory(t, config.Default().Repository, fixture)
+
+	t.Run("FindByID", func(t *testing.T) { testFindByID(t, repo, fixture) })
+	t.Run("FindByIDs", func(t *testing.T) { testFindByIDs(t, repo) })
+	t.Run("FindAll", func(t *testing.T) { testFindAll(t, repo) })
+	t.Run("FindByFilter", func(t *testing.T) { testFindByFilter(t, repo) })
+	t.Run("FindByFilterPages", func(t *testing.T) { testFindByFilterPages(t, repo) })
+}
+
+func ids(rentals []domain.Rental) []uint {
+	ids := make([]uint, len(rentals))
+	for i, rental := range rentals {
+		ids[i] = rental.ID
+	}
+	return ids
+}
+
+func testFindByID(t *testing.T, repo domain.RentalRepository, fixture Fixture) {
+	rental, err := repo.FindByID(context.Background(), 3)
+	require.NoError(t, err)
+	want := fixture.Rentals[2]
+	want.Version = rental.Version
+	assert.Equal(t, want, rental)
+	assert.NotZero(t, rental.Version)
+
+	for name, id := range map[string]uint{"unknown": 99, "deleted": 11} {
+		t.Run(name, func(t *testing.T) {
+			_, err := repo.FindByID(context.Background(), id)
+			assert.ErrorIs(t, err, domain.ErrRentalNotFound)
+		})
+	}
+}
+
+func testFindByIDs(t *testing.T, repo domain.RentalRepository) {
+	rentals, err := repo.FindByIDs(context.Background(), []uint{8, 2, 11, 99})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []uint{2, 8}, ids(rentals))
+	for _, rental := range rentals {
+		assert.NotEmpty(t, rental.User.FirstName)
+	}
+
+	rentals, err = repo.FindByIDs(context.Background(), []uint{})
+	require.NoError(t, err)
+	assert.Empty(t, rentals)
+}
+
+func testFindAll(t *testing.T, repo domain.RentalRepository) {
+	rentals, err := repo.FindAll(context.Background())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []uint{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, ids(rentals))
+}
+
+func testFindByFilter(t *testing.T, repo domain.RentalRepository) {
+	all := []uint{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	tests := []struct {
+		name   string
+		filter *domain.RentalFindFilterBuilder
+		want   []uint
+		total  uint
+	}{
+		{"no filter", domain.NewRentalFilterBuilder(), all, 10},
+		{"price min is inclusive", domain.NewRentalFilterBuilder().WithPriceMin(16900), []uint{1, 3, 8}, 3},
+		{"price max is inclusive", domain.NewRentalFilterBuilder().WithPriceMax(8900), []uint{4, 5}, 2},
+		{"price range", domain.NewRentalFilterBuilder().WithPriceMin(10000).WithPriceMax(15000), []uint{2, 6, 7, 9, 10}, 5},
+		{"single price", domain.NewRentalFilterBuilder().WithPriceMin(15000).WithPriceMax(15000), []uint{2, 7}, 2},
+		{"no match", domain.NewRentalFilterBuilder().WithPriceMin(20000), []uint{}, 0},
+		{"ids", domain.NewRentalFilterBuilder().WithRentalIDs([]int{8, 2, 11, 99}), []uint{2, 8}, 2},
+		{"near", domain.NewRentalFilterBuilder().WithCoords(costaMesa), []uint{1, 3, 5, 7, 8, 9}, 6},
+		{"near nothing", domain.NewRentalFilterBuilder().WithCoords([2]float64{0, 0}), []uint{}, 0},
+		{"near and price", domain.NewRentalFilterBuilder().WithCoords(costaMesa).WithPriceMax(15000), []uint{5, 7, 9}, 3},
+		{"ids and price", domain.NewRentalFilterBuilder().WithRentalIDs([]int{1, 2, 3}).WithPriceMin(16000), []uint{1, 3}, 2},
+		{"sort price", domain.NewRentalFilterBuilder().WithSort(domain.SortPriceAsc), []uint{5, 4, 9, 10, 6, 2, 7, 1, 8, 3}, 10},
+		{"sort price desc", domain.NewRentalFilterBuilder().WithSort(domain.SortPriceDesc), []uint{3, 1, 8, 2, 7, 6, 9, 10, 4, 5}, 10},
+		{"sort year", domain.NewRentalFilterBuilder().WithSort(domain.SortYearAsc), []uint{1, 3, 2, 9, 10, 7, 6, 5, 4, 8}, 10},
+		{"sort year desc", domain.NewRentalFilterBuilder().WithSort(domain.SortYearDesc), []uint{4, 8, 5, 6, 7, 9, 10, 2, 3, 1}, 10},
+		{"limit", domain.NewRentalFilterBuilder().WithLimit(3), []uint{1, 2, 3}, 10},
+		{"offset", domain.NewRentalFilterBuilder().WithOffset(8), []uint{9, 10}, 10},
+		{"offset past the end", domain.NewRentalFilterBuilder().WithOffset(20), []uint{}, 10},
+		{"sorted page", domain.NewRentalFilterBuilder().WithSort(domain.SortPriceAsc).WithLimit(3).WithOffset(2), []uint{9, 10, 6}, 10},
+		{"filtered page", domain.NewRentalFilterBuilder().WithPriceMin(15000).WithLimit(2), []uint{1, 2}, 5},
+		{"every option", domain.NewRentalFilterBuilder().WithCoords(costaMesa).WithPriceMin(9000).WithPriceMax(17000).
+			WithRentalIDs([]int{1, 3, 7, 8, 9, 10}).WithSort(domain.SortYearDesc).WithLimit(2).WithOffset(1), []uint{7, 9}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := tt.filter.Build()
+			require.NoError(t, err)
+
+			response, err := repo.FindByFilter(context.Background(), filter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, ids(response.Items))
+			assert.Equal(t, tt.total, response.Paginator.TotalItems)
+			limit, _ := filter.Limit()
+			offset, _ := filter.Offset()
+			assert.Equal(t, limit, response.Paginator.Limit)
+			assert.Equal(t, offset, response.Paginator.Offset)
+		})
+	}
+
+	t.Run("owner", func(t *testing.T) {
+		filter, _ := domain.NewRentalFilterBuilder().WithRentalIDs([]int{1, 2}).Build()
+		response, err := repo.FindByFilter(context.Background(), filter)
+		require.NoError(t, err)
+		require.Len(t, response.Items, 2)
+		assert.Equal(t, john, response.Items[0].User)
+		assert.Equal(t, jane, response.Items[1].User)
+	})
+}
+
+// testFindByFilterPages walks the pages of sorted listings with ties, together they hold every rental once
+func testFindByFilterPages(t *testing.T, repo domain.RentalRepository) {
+	for _, sort := range []domain.Sort{domain.SortNone, domain.SortPriceAsc, domain.SortPriceDesc, domain.SortYearAsc, domain.SortYearDesc} {
+		var walked []uint
+		for offset := uint(0); offset < 10; offset += 3 {
+			b := domain.NewRentalFilterBuilder().WithLimit(3).WithOffset(offset)
+			if !sort.IsZero() {
+				b = b.WithSort(sort)
+			}
+			filter, err := b.Build()
+			require.NoError(t, err)
+			response, err := repo.FindByFilter(context.Background(), filter)
+			require.NoError(t, err)
+			walked = append(walked, ids(response.Items)...)
+		}
+		assert.ElementsMatch(t, []uint{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, walked, sort)
+	}
+}
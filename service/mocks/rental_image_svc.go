@@ -0,0 +1,34 @@
+package mocks
+
+import (
+	"context"
+	"io"
+
+	"github.com/plar/rentals-api/domain"
+	"github.com/plar/rentals-api/service"
+
+	"github.com/stretchr/testify/mock"
+)
+
+type RentalImageService struct {
+	mock.Mock
+}
+
+var _ service.RentalImageService = (*RentalImageService)(nil)
+
+func (s *RentalImageService) AddRentalImage(ctx context.Context, rentalID uint, upload io.Reader) (domain.RentalImage, error) {
+	args := s.Called(ctx, rentalID, upload)
+	return args.Get(0).(domain.RentalImage), args.Error(1)
+}
+
+func (s *RentalImageService) DeleteRentalImage(ctx context.Context, rentalID, imageID uint) error {
+	args := s.Called(ctx, rentalID, imageID)
+	return args.Error(0)
+}
+
+func (s *RentalImageService) ReorderRentalImages(ctx context.Context, rentalID uint, ids []uint) ([]domain.RentalImage, error) {
+	args := s.Called(ctx, rentalID, ids)
+	return args.Get(0).([]domain.RentalImage), args.Error(1)
+}
+
+// Add more methods as needed
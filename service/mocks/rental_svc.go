@@ -1,6 +1,9 @@
 package mocks
 
 import (
+	"context"
+	"time"
+
 	"github.com/plar/rentals-api/domain"
 	"github.com/plar/rentals-api/service"
 
@@ -13,19 +16,69 @@ type RentalService struct {
 
 var _ service.RentalService = (*RentalService)(nil)
 
-func (s *RentalService) GetAllRentals() ([]domain.Rental, error) {
-	args := s.Called()
+func (s *RentalService) GetAllRentals(ctx context.Context) ([]domain.Rental, error) {
+	args := s.Called(ctx)
 	return args.Get(0).([]domain.Rental), args.Error(1)
 }
 
-func (s *RentalService) GetRentalByID(id uint) (domain.Rental, error) {
-	args := s.Called(id)
+func (s *RentalService) GetRentalByID(ctx context.Context, id uint) (domain.Rental, error) {
+	args := s.Called(ctx, id)
 	return args.Get(0).(domain.Rental), args.Error(1)
 }
 
-func (s *RentalService) GetRentalsByFilter(filter domain.RentalFindFilter) (domain.Response[domain.Rental], error) {
-	args := s.Called(filter)
+func (s *RentalService) BatchGetRentals(ctx context.Context, ids []uint) (domain.BatchResponse[domain.Rental], error) {
+	args := s.Called(ctx, ids)
+	return args.Get(0).(domain.BatchResponse[domain.Rental]), args.Error(1)
+}
+
+func (s *RentalService) GetRentalsByFilter(ctx context.Context, filter domain.RentalFindFilter) (domain.Response[domain.Rental], error) {
+	args := s.Called(ctx, filter)
 	return args.Get(0).(domain.Response[domain.Rental]), args.Error(1)
 }
 
+func (s *RentalService) ExportRentals(ctx context.Context, filter domain.RentalFindFilter, fn func(domain.Rental) error) error {
+	args := s.Called(ctx, filter, fn)
+	return args.Error(0)
+}
+
+func (s *RentalService) ImportRentals(ctx context.Context, rows []domain.ImportRow, dryRun bool) (domain.ImportReport, error) {
+	args := s.Called(ctx, rows, dryRun)
+	return args.Get(0).(domain.ImportReport), args.Error(1)
+}
+
+func (s *RentalService) GetDeletedRentals(ctx context.Context, filter domain.RentalFindFilter) (domain.Response[domain.Rental], error) {
+	args := s.Called(ctx, filter)
+	return args.Get(0).(domain.Response[domain.Rental]), args.Error(1)
+}
+
+func (s *RentalService) UpdateRental(ctx context.Context, rental domain.Rental) (domain.Rental, error) {
+	args := s.Called(ctx, rental)
+	return args.Get(0).(domain.Rental), args.Error(1)
+}
+
+func (s *RentalService) RestoreRental(ctx context.Context, id uint) (domain.Rental, error) {
+	args := s.Called(ctx, id)
+	return args.Get(0).(domain.Rental), args.Error(1)
+}
+
+func (s *RentalService) PurgeRental(ctx context.Context, id uint) error {
+	args := s.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (s *RentalService) PurgeDeletedRentals(ctx context.Context, before time.Time) ([]uint, error) {
+	args := s.Called(ctx, before)
+	return args.Get(0).([]uint), args.Error(1)
+}
+
+func (s *RentalService) GetRentalHistory(ctx context.Context, id uint, page domain.ViewFilter) (domain.Response[domain.RentalRevision], error) {
+	args := s.Called(ctx, id, page)
+	return args.Get(0).(domain.Response[domain.RentalRevision]), args.Error(1)
+}
+
+func (s *RentalService) GetRentalAsOf(ctx context.Context, id uint, at time.Time) (domain.Rental, error) {
+	args := s.Called(ctx, id, at)
+	return args.Get(0).(domain.Rental), args.Error(1)
+}
+
 // Add more methods as needed
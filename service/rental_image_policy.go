@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"io"
+
+	"github.com/plar/rentals-api/auth"
+	"github.com/plar/rentals-api/domain"
+)
+
+type rentalImageServicePolicy struct {
+	next   RentalImageService
+	repo   domain.RentalRepository
+	policy auth.Policy
+}
+
+var _ RentalImageService = (*rentalImageServicePolicy)(nil)
+
+// NewRentalImageServicePolicy authorizes the changes of the images as writes of their rental, owners change
+// the images of their own rentals only. repo looks up the current owners.
+func NewRentalImageServicePolicy(next RentalImageService, repo domain.RentalRepository, policy auth.Policy) RentalImageService {
+	return &rentalImageServicePolicy{
+		next:   next,
+		repo:   repo,
+		policy: policy,
+	}
+}
+
+func (p *rentalImageServicePolicy) AddRentalImage(ctx context.Context, rentalID uint, upload io.Reader) (domain.RentalImage, error) {
+	if err := authorizeRental(ctx, p.policy, p.repo, auth.ActionWrite, rentalID); err != nil {
+		return domain.RentalImage{}, err
+	}
+	return p.next.AddRentalImage(ctx, rentalID, upload)
+}
+
+func (p *rentalImageServicePolicy) DeleteRentalImage(ctx context.Context, rentalID, imageID uint) error {
+	if err := authorizeRental(ctx, p.policy, p.repo, auth.ActionWrite, rentalID); err != nil {
+		return err
+	}
+	return p.next.DeleteRentalImage(ctx, rentalID, imageID)
+}
+
+func (p *rentalImageServicePolicy) ReorderRentalImages(ctx context.Context, rentalID uint, ids []uint) ([]domain.RentalImage, error) {
+	if err := authorizeRental(ctx, p.policy, p.repo, auth.ActionWrite, rentalID); err != nil {
+		return nil, err
+	}
+	return p.next.ReorderRentalImages(ctx, rentalID, ids)
+}
+
+// Add more methods as needed
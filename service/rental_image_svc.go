@@ -0,0 +1,199 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"go.uber.org/zap"
+
+	"github.com/plar/rentals-api/domain"
+	"github.com/plar/rentals-api/images"
+)
+
+// primaryImageRetries is the number of attempts to write primary_image_url when the rental is updated concurrently
+const primaryImageRetries = 3
+
+type RentalImageService interface {
+	// AddRentalImage stores an uploaded image and its variants after the other images of the rental,
+	// domain.ErrInvalidImage is returned when the upload is not a supported image
+	AddRentalImage(ctx context.Context, rentalID uint, upload io.Reader) (domain.RentalImage, error)
+	DeleteRentalImage(ctx context.Context, rentalID, imageID uint) error
+	// ReorderRentalImages puts the images of a rental in the order of ids, which must list all of them
+	ReorderRentalImages(ctx context.Context, rentalID uint, ids []uint) ([]domain.RentalImage, error)
+}
+
+type rentalImageService struct {
+	rentals domain.RentalRepository
+	images  domain.RentalImageRepository
+	store   images.Storage
+	logger  *zap.Logger
+}
+
+// NewRentalImageService keeps primary_image_url of the rentals at the URL of their first image, every change
+// of the images updates the rental through rentals so it gets a new version and a revision
+func NewRentalImageService(rentals domain.RentalRepository, repo domain.RentalImageRepository, store images.Storage, logger *zap.Logger) RentalImageService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &rentalImageService{
+		rentals: rentals,
+		images:  repo,
+		store:   store,
+		logger:  logger,
+	}
+}
+
+func (s *rentalImageService) AddRentalImage(ctx context.Context, rentalID uint, upload io.Reader) (domain.RentalImage, error) {
+	if _, err := s.rentals.FindByID(domain.WithPrimaryReads(ctx), rentalID); err != nil {
+		return domain.RentalImage{}, err
+	}
+
+	data, err := io.ReadAll(upload)
+	if err != nil {
+		return domain.RentalImage{}, err
+	}
+	img, format, err := images.Decode(data)
+	if err != nil {
+		return domain.RentalImage{}, fmt.Errorf("%w: %v", domain.ErrInvalidImage, err)
+	}
+	variants, err := images.Variants(img)
+	if err != nil {
+		return domain.RentalImage{}, err
+	}
+
+	// the files of every upload have a directory of their own, the original is kept as uploaded
+	dir, err := randomHex(8)
+	if err != nil {
+		return domain.RentalImage{}, err
+	}
+	prefix := rentalImagePrefix(rentalID) + dir + "/"
+	image := domain.RentalImage{
+		RentalID: rentalID,
+		Width:    img.Bounds().Dx(),
+		Height:   img.Bounds().Dy(),
+		Key:      prefix + "original." + images.Extension(format),
+	}
+	files := map[string][]byte{image.Key: data}
+	for _, v := range variants {
+		key := prefix + v.Size + "." + images.Extension(v.Format)
+		image.Variants = append(image.Variants, domain.ImageVariant{Size: v.Size, Format: v.Format, Width: v.Width, Height: v.Height, Key: key})
+		files[key] = v.Data
+	}
+
+	for _, key := range image.Keys() {
+		if err = s.store.Put(ctx, key, bytes.NewReader(files[key])); err != nil {
+			s.deleteFiles(image)
+			return domain.RentalImage{}, err
+		}
+	}
+	added, err := s.images.Add(ctx, image)
+	if err != nil {
+		s.deleteFiles(image)
+		return domain.RentalImage{}, err
+	}
+
+	s.syncPrimaryImage(ctx, rentalID)
+	return withImageURLs(s.store, added), nil
+}
+
+func (s *rentalImageService) DeleteRentalImage(ctx context.Context, rentalID, imageID uint) error {
+	deleted, err := s.images.Delete(ctx, rentalID, imageID)
+	if err != nil {
+		return err
+	}
+	s.deleteFiles(deleted)
+	s.syncPrimaryImage(ctx, rentalID)
+	return nil
+}
+
+func (s *rentalImageService) ReorderRentalImages(ctx context.Context, rentalID uint, ids []uint) ([]domain.RentalImage, error) {
+	reordered, err := s.images.Reorder(ctx, rentalID, ids)
+	if err != nil {
+		return nil, err
+	}
+	s.syncPrimaryImage(ctx, rentalID)
+	for i := range reordered {
+		reordered[i] = withImageURLs(s.store, reordered[i])
+	}
+	return reordered, nil
+}
+
+// syncPrimaryImage writes the URL of the first image, or none without images, to primary_image_url. A failure
+// is logged only, the image change is done and the reads show the first image as primary anyway.
+func (s *rentalImageService) syncPrimaryImage(ctx context.Context, rentalID uint) {
+	err := s.updatePrimaryImage(ctx, rentalID)
+	for attempt := 1; errors.Is(err, domain.ErrConflict) && attempt < primaryImageRetries; attempt++ {
+		err = s.updatePrimaryImage(ctx, rentalID)
+	}
+	if err != nil {
+		s.logger.Error("Cannot update the primary image of the rental", zap.Uint("rental_id", rentalID), zap.Error(err))
+	}
+}
+
+func (s *rentalImageService) updatePrimaryImage(ctx context.Context, rentalID uint) error {
+	ctx = domain.WithPrimaryReads(ctx)
+	rental, err := s.rentals.FindByID(ctx, rentalID)
+	if err != nil {
+		return err
+	}
+	byRental, err := s.images.FindByRentalIDs(ctx, []uint{rentalID})
+	if err != nil {
+		return err
+	}
+	rental.PrimaryImageURL = primaryImageURL(s.store, byRental[rentalID])
+	// the update gives the rental a new version even when the primary image stays, its ETag covers the images
+	_, err = s.rentals.Update(ctx, rental)
+	return err
+}
+
+// deleteFiles removes the files of an image, the errors are logged only since the image is gone anyway
+func (s *rentalImageService) deleteFiles(image domain.RentalImage) {
+	deleteImageFiles(s.store, s.logger, image)
+}
+
+func deleteImageFiles(store images.Storage, logger *zap.Logger, image domain.RentalImage) {
+	for _, key := range image.Keys() {
+		// the files are removed even when the request is canceled
+		if err := store.Delete(context.Background(), key); err != nil {
+			logger.Warn("Cannot delete image file", zap.String("key", key), zap.Error(err))
+		}
+	}
+}
+
+// rentalImagePrefix is the key prefix of the files of the images of a rental
+func rentalImagePrefix(rentalID uint) string {
+	return fmt.Sprintf("rentals/%d/", rentalID)
+}
+
+// withImageURLs sets the URLs of the files of an image
+func withImageURLs(store images.Storage, image domain.RentalImage) domain.RentalImage {
+	image.URL = store.URL(image.Key)
+	variants := make([]domain.ImageVariant, len(image.Variants))
+	for i, v := range image.Variants {
+		v.URL = store.URL(v.Key)
+		variants[i] = v
+	}
+	image.Variants = variants
+	return image
+}
+
+// primaryImageURL is the URL of the first image, empty without images
+func primaryImageURL(store images.Storage, rentalImages []domain.RentalImage) string {
+	if len(rentalImages) == 0 {
+		return ""
+	}
+	return store.URL(rentalImages[0].Key)
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
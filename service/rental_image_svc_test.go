@@ -0,0 +1,230 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/plar/rentals-api/auth"
+	"github.com/plar/rentals-api/config"
+	"github.com/plar/rentals-api/domain"
+	"github.com/plar/rentals-api/images"
+	"github.com/plar/rentals-api/repository/memory"
+	"github.com/plar/rentals-api/service"
+)
+
+// pngUpload returns a PNG of width x height pixels
+func pngUpload(t *testing.T, width, height int) *bytes.Reader {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		img.Set(x, x%height, color.NRGBA{R: 200, A: 255})
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return bytes.NewReader(buf.Bytes())
+}
+
+type imagesFixture struct {
+	rentals *memory.RentalRepository
+	images  *memory.RentalImageRepository
+	dir     string
+	store   images.Storage
+}
+
+func newImagesFixture(t *testing.T) imagesFixture {
+	rentals := memory.NewRentalRepository(config.Default().Repository)
+	rentals.AddUsers(domain.User{ID: 7, FirstName: "John"}, domain.User{ID: 8, FirstName: "Jane"})
+	require.NoError(t, rentals.Add(
+		domain.Rental{ID: 1, Name: "Van", Type: "camper-van", PrimaryImageURL: "https://example.com/van.jpg", Price: domain.Price{Day: 100}, User: domain.User{ID: 7}},
+		domain.Rental{ID: 2, Name: "Bus", Type: "camper-van", Price: domain.Price{Day: 100}, User: domain.User{ID: 8}},
+	))
+	dir := t.TempDir()
+	return imagesFixture{
+		rentals: rentals,
+		images:  memory.NewRentalImageRepository(),
+		dir:     dir,
+		store:   images.NewLocal(dir, "/images"),
+	}
+}
+
+// files lists the files stored under the directory of the fixture
+func (f imagesFixture) files(t *testing.T) []string {
+	var files []string
+	err := filepath.WalkDir(f.dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(f.dir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	require.NoError(t, err)
+	return files
+}
+
+func TestRentalImageService(t *testing.T) {
+	ctx := context.Background()
+	f := newImagesFixture(t)
+	imageService := service.NewRentalImageService(f.rentals, f.images, f.store, nil)
+	rentalService := service.NewRentalServiceImages(service.NewRentalService(f.rentals, nil), f.images, f.store, nil)
+
+	first, err := imageService.AddRentalImage(ctx, 1, pngUpload(t, 800, 600))
+	require.NoError(t, err)
+	assert.Equal(t, 1, first.Position)
+	assert.Equal(t, [2]int{800, 600}, [2]int{first.Width, first.Height})
+	assert.True(t, strings.HasPrefix(first.URL, "/images/rentals/1/"), first.URL)
+	assert.True(t, strings.HasSuffix(first.URL, "/original.png"), first.URL)
+	require.Len(t, first.Variants, 2*len(images.Sizes))
+	thumb := first.Variants[0]
+	thumb.Key = ""
+	assert.Equal(t, domain.ImageVariant{Size: "thumb", Format: images.FormatJPEG, Width: 160, Height: 120, URL: strings.TrimSuffix(first.URL, "original.png") + "thumb.jpg"}, thumb)
+	assert.Len(t, f.files(t), 1+2*len(images.Sizes))
+
+	rental, err := f.rentals.FindByID(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, first.URL, rental.PrimaryImageURL)
+	assert.Equal(t, uint(2), rental.Version)
+
+	second, err := imageService.AddRentalImage(ctx, 1, pngUpload(t, 100, 50))
+	require.NoError(t, err)
+	assert.Equal(t, 2, second.Position)
+	assert.Equal(t, 100, second.Variants[len(second.Variants)-1].Width, "not enlarged")
+
+	t.Run("rentals have their images", func(t *testing.T) {
+		rental, err := rentalService.GetRentalByID(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, rental.Images, 2)
+		assert.Equal(t, []uint{first.ID, second.ID}, []uint{rental.Images[0].ID, rental.Images[1].ID})
+		assert.Equal(t, first.URL, rental.PrimaryImageURL)
+		assert.Equal(t, uint(3), rental.Version, "every image change is a new version")
+
+		rental.PrimaryImageURL = "https://example.com/other.jpg"
+		updated, err := rentalService.UpdateRental(ctx, rental)
+		require.NoError(t, err)
+		assert.Equal(t, first.URL, updated.PrimaryImageURL)
+		assert.Len(t, updated.Images, 2)
+
+		without, err := rentalService.GetRentalByID(ctx, 2)
+		require.NoError(t, err)
+		assert.Nil(t, without.Images)
+	})
+
+	t.Run("invalid uploads", func(t *testing.T) {
+		_, err := imageService.AddRentalImage(ctx, 1, strings.NewReader("not an image"))
+		assert.ErrorIs(t, err, domain.ErrInvalidImage)
+		_, err = imageService.AddRentalImage(ctx, 99, pngUpload(t, 10, 10))
+		assert.ErrorIs(t, err, domain.ErrRentalNotFound)
+		assert.Len(t, f.files(t), 2*(1+2*len(images.Sizes)))
+	})
+
+	t.Run("reorder", func(t *testing.T) {
+		reordered, err := imageService.ReorderRentalImages(ctx, 1, []uint{second.ID, first.ID})
+		require.NoError(t, err)
+		assert.Equal(t, second.URL, reordered[0].URL)
+		rental, err := f.rentals.FindByID(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, second.URL, rental.PrimaryImageURL)
+
+		_, err = imageService.ReorderRentalImages(ctx, 1, []uint{second.ID})
+		assert.ErrorIs(t, err, domain.ErrImageOrder)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(t, imageService.DeleteRentalImage(ctx, 1, second.ID))
+		assert.Len(t, f.files(t), 1+2*len(images.Sizes))
+		rental, err := f.rentals.FindByID(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, first.URL, rental.PrimaryImageURL)
+
+		assert.ErrorIs(t, imageService.DeleteRentalImage(ctx, 1, second.ID), domain.ErrImageNotFound)
+
+		// without images the rental has no primary image
+		require.NoError(t, imageService.DeleteRentalImage(ctx, 1, first.ID))
+		assert.Empty(t, f.files(t))
+		rental, err = f.rentals.FindByID(ctx, 1)
+		require.NoError(t, err)
+		assert.Empty(t, rental.PrimaryImageURL)
+	})
+}
+
+func TestRentalServiceImagesPurge(t *testing.T) {
+	ctx := context.Background()
+	f := newImagesFixture(t)
+	imageService := service.NewRentalImageService(f.rentals, f.images, f.store, nil)
+	rentalService := service.NewRentalServiceImages(service.NewRentalService(f.rentals, nil), f.images, f.store, nil)
+
+	_, err := imageService.AddRentalImage(ctx, 2, pngUpload(t, 64, 64))
+	require.NoError(t, err)
+	assert.ErrorIs(t, rentalService.PurgeRental(ctx, 2), domain.ErrRentalNotFound, "not deleted")
+	assert.NotEmpty(t, f.files(t))
+
+	require.NoError(t, f.rentals.Delete(2, time.Now()))
+	require.NoError(t, rentalService.PurgeRental(ctx, 2))
+	assert.Empty(t, f.files(t))
+	byRental, err := f.images.FindByRentalIDs(ctx, []uint{2})
+	require.NoError(t, err)
+	assert.Empty(t, byRental)
+}
+
+func TestRentalServiceImagesPurgeDeleted(t *testing.T) {
+	ctx := context.Background()
+	f := newImagesFixture(t)
+	imageService := service.NewRentalImageService(f.rentals, f.images, f.store, nil)
+	rentalService := service.NewRentalServiceImages(service.NewRentalService(f.rentals, nil), f.images, f.store, nil)
+
+	kept, err := imageService.AddRentalImage(ctx, 1, pngUpload(t, 64, 64))
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		_, err = imageService.AddRentalImage(ctx, 2, pngUpload(t, 64, 64))
+		require.NoError(t, err)
+	}
+	require.NoError(t, f.rentals.Delete(2, time.Now().Add(-48*time.Hour)))
+
+	// the scheduled purge removes the images of the purged rentals only
+	purgeCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		service.PurgeDeletedRentals(purgeCtx, rentalService, 24*time.Hour, time.Hour, nil)
+		close(done)
+	}()
+	// the directory of the rental goes last
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(f.dir, "rentals", "2"))
+		return errors.Is(err, os.ErrNotExist)
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	<-done
+
+	assert.ElementsMatch(t, kept.Keys(), f.files(t))
+	byRental, err := f.images.FindByRentalIDs(ctx, []uint{1, 2})
+	require.NoError(t, err)
+	assert.Len(t, byRental[1], 1)
+	assert.Empty(t, byRental[2])
+	deleted, err := f.rentals.FindDeleted(ctx, domain.RentalFindFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, deleted.Items)
+}
+
+func TestRentalImageServicePolicy(t *testing.T) {
+	owner := auth.NewContext(context.Background(), auth.Identity{Subject: "7", Roles: []string{"owner"}})
+	f := newImagesFixture(t)
+	imageService := service.NewRentalImageServicePolicy(service.NewRentalImageService(f.rentals, f.images, f.store, nil), f.rentals, auth.DefaultPolicy)
+
+	_, err := imageService.AddRentalImage(owner, 1, pngUpload(t, 32, 32))
+	assert.NoError(t, err)
+	_, err = imageService.AddRentalImage(owner, 2, pngUpload(t, 32, 32))
+	assert.ErrorIs(t, err, auth.ErrForbidden)
+	assert.ErrorIs(t, imageService.DeleteRentalImage(owner, 2, 1), auth.ErrForbidden)
+	_, err = imageService.ReorderRentalImages(context.Background(), 1, []uint{1})
+	assert.ErrorIs(t, err, auth.ErrForbidden)
+}
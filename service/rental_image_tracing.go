@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"io"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/plar/rentals-api/domain"
+	"github.com/plar/rentals-api/tracing"
+)
+
+type rentalImageServiceTracer struct {
+	next   RentalImageService
+	tracer trace.Tracer
+}
+
+var _ RentalImageService = (*rentalImageServiceTracer)(nil)
+
+// NewRentalImageServiceTracer wraps every service call in a span named RentalImageService.<Method>
+func NewRentalImageServiceTracer(next RentalImageService, tp trace.TracerProvider) RentalImageService {
+	return &rentalImageServiceTracer{
+		next:   next,
+		tracer: tp.Tracer(tracerName),
+	}
+}
+
+func (t *rentalImageServiceTracer) start(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return t.tracer.Start(ctx, "RentalImageService."+method, trace.WithAttributes(attrs...))
+}
+
+func (t *rentalImageServiceTracer) AddRentalImage(ctx context.Context, rentalID uint, upload io.Reader) (image domain.RentalImage, err error) {
+	ctx, span := t.start(ctx, "AddRentalImage", attribute.Int64("rental.id", int64(rentalID)))
+	defer func() {
+		span.SetAttributes(attribute.Int64("image.id", int64(image.ID)))
+		tracing.End(span, err)
+	}()
+	return t.next.AddRentalImage(ctx, rentalID, upload)
+}
+
+func (t *rentalImageServiceTracer) DeleteRentalImage(ctx context.Context, rentalID, imageID uint) (err error) {
+	ctx, span := t.start(ctx, "DeleteRentalImage", attribute.Int64("rental.id", int64(rentalID)), attribute.Int64("image.id", int64(imageID)))
+	defer func() { tracing.End(span, err) }()
+	return t.next.DeleteRentalImage(ctx, rentalID, imageID)
+}
+
+func (t *rentalImageServiceTracer) ReorderRentalImages(ctx context.Context, rentalID uint, ids []uint) (reordered []domain.RentalImage, err error) {
+	ctx, span := t.start(ctx, "ReorderRentalImages", attribute.Int64("rental.id", int64(rentalID)), attribute.Int("image.ids.count", len(ids)))
+	defer func() { tracing.End(span, err) }()
+	return t.next.ReorderRentalImages(ctx, rentalID, ids)
+}
+
+// Add more methods as needed
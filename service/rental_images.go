@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/plar/rentals-api/domain"
+	"github.com/plar/rentals-api/images"
+)
+
+type rentalServiceImages struct {
+	next   RentalService
+	repo   domain.RentalImageRepository
+	store  images.Storage
+	logger *zap.Logger
+}
+
+var _ RentalService = (*rentalServiceImages)(nil)
+
+// NewRentalServiceImages attaches the images to the rentals it returns, the primary image of a rental with
+// images is its first one. The exports and the past states of the rentals have no images.
+func NewRentalServiceImages(next RentalService, repo domain.RentalImageRepository, store images.Storage, logger *zap.Logger) RentalService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &rentalServiceImages{
+		next:   next,
+		repo:   repo,
+		store:  store,
+		logger: logger,
+	}
+}
+
+// attach sets the images of rentals in place
+func (s *rentalServiceImages) attach(ctx context.Context, rentals []domain.Rental) error {
+	if len(rentals) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(rentals))
+	for i, rental := range rentals {
+		ids[i] = rental.ID
+	}
+	byRental, err := s.repo.FindByRentalIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range rentals {
+		rentalImages := byRental[rentals[i].ID]
+		if len(rentalImages) == 0 {
+			continue
+		}
+		rentals[i].Images = make([]domain.RentalImage, len(rentalImages))
+		for j, image := range rentalImages {
+			rentals[i].Images[j] = withImageURLs(s.store, image)
+		}
+		rentals[i].PrimaryImageURL = rentals[i].Images[0].URL
+	}
+	return nil
+}
+
+func (s *rentalServiceImages) attachOne(ctx context.Context, rental domain.Rental, err error) (domain.Rental, error) {
+	if err != nil {
+		return rental, err
+	}
+	rentals := []domain.Rental{rental}
+	if err = s.attach(ctx, rentals); err != nil {
+		return domain.Rental{}, err
+	}
+	return rentals[0], nil
+}
+
+func (s *rentalServiceImages) GetAllRentals(ctx context.Context) ([]domain.Rental, error) {
+	rentals, err := s.next.GetAllRentals(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return rentals, s.attach(ctx, rentals)
+}
+
+func (s *rentalServiceImages) GetRentalByID(ctx context.Context, id uint) (domain.Rental, error) {
+	rental, err := s.next.GetRentalByID(ctx, id)
+	return s.attachOne(ctx, rental, err)
+}
+
+func (s *rentalServiceImages) BatchGetRentals(ctx context.Context, ids []uint) (domain.BatchResponse[domain.Rental], error) {
+	response, err := s.next.BatchGetRentals(ctx, ids)
+	if err != nil {
+		return response, err
+	}
+	return response, s.attach(ctx, response.Items)
+}
+
+func (s *rentalServiceImages) GetRentalsByFilter(ctx context.Context, filter domain.RentalFindFilter) (domain.Response[domain.Rental], error) {
+	response, err := s.next.GetRentalsByFilter(ctx, filter)
+	if err != nil {
+		return response, err
+	}
+	return response, s.attach(ctx, response.Items)
+}
+
+func (s *rentalServiceImages) ExportRentals(ctx context.Context, filter domain.RentalFindFilter, fn func(domain.Rental) error) error {
+	return s.next.ExportRentals(ctx, filter, fn)
+}
+
+func (s *rentalServiceImages) ImportRentals(ctx context.Context, rows []domain.ImportRow, dryRun bool) (domain.ImportReport, error) {
+	return s.next.ImportRentals(ctx, rows, dryRun)
+}
+
+// UpdateRental keeps the first image as primary image, an update cannot point it elsewhere
+func (s *rentalServiceImages) UpdateRental(ctx context.Context, rental domain.Rental) (domain.Rental, error) {
+	byRental, err := s.repo.FindByRentalIDs(domain.WithPrimaryReads(ctx), []uint{rental.ID})
+	if err != nil {
+		return domain.Rental{}, err
+	}
+	if rentalImages := byRental[rental.ID]; len(rentalImages) > 0 {
+		rental.PrimaryImageURL = primaryImageURL(s.store, rentalImages)
+	}
+	updated, err := s.next.UpdateRental(ctx, rental)
+	return s.attachOne(domain.WithPrimaryReads(ctx), updated, err)
+}
+
+func (s *rentalServiceImages) GetDeletedRentals(ctx context.Context, filter domain.RentalFindFilter) (domain.Response[domain.Rental], error) {
+	response, err := s.next.GetDeletedRentals(ctx, filter)
+	if err != nil {
+		return response, err
+	}
+	return response, s.attach(ctx, response.Items)
+}
+
+func (s *rentalServiceImages) RestoreRental(ctx context.Context, id uint) (domain.Rental, error) {
+	rental, err := s.next.RestoreRental(ctx, id)
+	return s.attachOne(domain.WithPrimaryReads(ctx), rental, err)
+}
+
+// PurgeRental removes the images of the rental along with it, their files included
+func (s *rentalServiceImages) PurgeRental(ctx context.Context, id uint) error {
+	byRental, err := s.repo.FindByRentalIDs(domain.WithPrimaryReads(ctx), []uint{id})
+	if err != nil {
+		return err
+	}
+	if err = s.next.PurgeRental(ctx, id); err != nil {
+		return err
+	}
+	// the database removes them with the rental, the memory repository does not
+	if err = s.repo.DeleteAll(ctx, id); err != nil {
+		return err
+	}
+	for _, image := range byRental[id] {
+		deleteImageFiles(s.store, s.logger, image)
+	}
+	return nil
+}
+
+// PurgeDeletedRentals removes the images of the purged rentals, the database removes their rows with the
+// rentals so their files are removed by the prefix of the rental
+func (s *rentalServiceImages) PurgeDeletedRentals(ctx context.Context, before time.Time) ([]uint, error) {
+	purged, err := s.next.PurgeDeletedRentals(ctx, before)
+	if err != nil {
+		return purged, err
+	}
+	for _, id := range purged {
+		if err = s.repo.DeleteAll(ctx, id); err != nil {
+			return purged, err
+		}
+		// the files are removed even when the request is canceled
+		prefix := rentalImagePrefix(id)
+		if err = s.store.DeleteAll(context.Background(), prefix); err != nil {
+			s.logger.Warn("Cannot delete image files", zap.String("prefix", prefix), zap.Error(err))
+		}
+	}
+	return purged, nil
+}
+
+func (s *rentalServiceImages) GetRentalHistory(ctx context.Context, id uint, page domain.ViewFilter) (domain.Response[domain.RentalRevision], error) {
+	return s.next.GetRentalHistory(ctx, id, page)
+}
+
+func (s *rentalServiceImages) GetRentalAsOf(ctx context.Context, id uint, at time.Time) (domain.Rental, error) {
+	return s.next.GetRentalAsOf(ctx, id, at)
+}
+
+// Add more methods as needed
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/plar/rentals-api/auth"
+	"github.com/plar/rentals-api/domain"
+)
+
+type rentalServicePolicy struct {
+	next   RentalService
+	repo   domain.RentalRepository
+	policy auth.Policy
+}
+
+var _ RentalService = (*rentalServicePolicy)(nil)
+
+// NewRentalServicePolicy authorizes every call with policy against the identity of the request context,
+// a denied call returns an *auth.ForbiddenError. repo looks up the current owners of the rentals a
+// call modifies.
+func NewRentalServicePolicy(next RentalService, repo domain.RentalRepository, policy auth.Policy) RentalService {
+	return &rentalServicePolicy{
+		next:   next,
+		repo:   repo,
+		policy: policy,
+	}
+}
+
+func (p *rentalServicePolicy) authorize(ctx context.Context, action auth.Action, ownerIDs ...uint) error {
+	id, _ := auth.FromContext(ctx)
+	return p.policy.Authorize(id, action, ownerIDs...)
+}
+
+func (p *rentalServicePolicy) authorizeRental(ctx context.Context, action auth.Action, id uint) error {
+	return authorizeRental(ctx, p.policy, p.repo, action, id)
+}
+
+// authorizeRental checks action on a single rental, its current owner is looked up in repo for the
+// callers allowed on their own rentals only
+func authorizeRental(ctx context.Context, policy auth.Policy, repo domain.RentalRepository, action auth.Action, id uint) error {
+	caller, _ := auth.FromContext(ctx)
+	var owners []uint
+	if policy.Grant(caller, action) == auth.AllowOwn {
+		rental, err := repo.FindByID(domain.WithPrimaryReads(ctx), id)
+		if err != nil {
+			return err
+		}
+		owners = append(owners, uint(rental.User.ID))
+	}
+	return policy.Authorize(caller, action, owners...)
+}
+
+func (p *rentalServicePolicy) GetAllRentals(ctx context.Context) ([]domain.Rental, error) {
+	if err := p.authorize(ctx, auth.ActionRead); err != nil {
+		return nil, err
+	}
+	return p.next.GetAllRentals(ctx)
+}
+
+func (p *rentalServicePolicy) GetRentalByID(ctx context.Context, id uint) (domain.Rental, error) {
+	if err := p.authorize(ctx, auth.ActionRead); err != nil {
+		return domain.Rental{}, err
+	}
+	return p.next.GetRentalByID(ctx, id)
+}
+
+func (p *rentalServicePolicy) BatchGetRentals(ctx context.Context, ids []uint) (domain.BatchResponse[domain.Rental], error) {
+	if err := p.authorize(ctx, auth.ActionRead); err != nil {
+		return domain.BatchResponse[domain.Rental]{}, err
+	}
+	return p.next.BatchGetRentals(ctx, ids)
+}
+
+func (p *rentalServicePolicy) GetRentalsByFilter(ctx context.Context, filter domain.RentalFindFilter) (domain.Response[domain.Rental], error) {
+	if err := p.authorize(ctx, auth.ActionRead); err != nil {
+		return domain.Response[domain.Rental]{}, err
+	}
+	return p.next.GetRentalsByFilter(ctx, filter)
+}
+
+func (p *rentalServicePolicy) ExportRentals(ctx context.Context, filter domain.RentalFindFilter, fn func(domain.Rental) error) error {
+	if err := p.authorize(ctx, auth.ActionExport); err != nil {
+		return err
+	}
+	return p.next.ExportRentals(ctx, filter, fn)
+}
+
+// ImportRentals lets owners import only rentals they own, both the owner in the rows and the current
+// owner of the rentals the rows overwrite are checked
+func (p *rentalServicePolicy) ImportRentals(ctx context.Context, rows []domain.ImportRow, dryRun bool) (domain.ImportReport, error) {
+	id, _ := auth.FromContext(ctx)
+	var owners []uint
+	if p.policy.Grant(id, auth.ActionImport) == auth.AllowOwn {
+		var err error
+		if owners, err = p.importOwners(ctx, rows); err != nil {
+			return domain.ImportReport{}, err
+		}
+	}
+	if err := p.policy.Authorize(id, auth.ActionImport, owners...); err != nil {
+		return domain.ImportReport{}, err
+	}
+	return p.next.ImportRentals(ctx, rows, dryRun)
+}
+
+func (p *rentalServicePolicy) importOwners(ctx context.Context, rows []domain.ImportRow) ([]uint, error) {
+	owners := make([]uint, 0, len(rows))
+	var ids []uint
+	for _, row := range rows {
+		if row.Err != nil {
+			continue
+		}
+		owners = append(owners, uint(row.Rental.User.ID))
+		if row.Rental.ID != 0 {
+			ids = append(ids, row.Rental.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return owners, nil
+	}
+
+	// a lagging replica could miss a change of owner, the check reads the primary
+	ctx = domain.WithPrimaryReads(ctx)
+	existing, err := p.repo.FindByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, rental := range existing {
+		owners = append(owners, uint(rental.User.ID))
+	}
+	if len(existing) == len(ids) {
+		return owners, nil
+	}
+
+	// the upsert of a deleted rental restores it, which is up to the admins like RestoreRental
+	deleted, err := deletedAmong(ctx, p.repo, ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(deleted) > 0 {
+		if err = p.authorize(ctx, auth.ActionAdmin); err != nil {
+			return nil, err
+		}
+	}
+	for _, rental := range deleted {
+		owners = append(owners, uint(rental.User.ID))
+	}
+	return owners, nil
+}
+
+// UpdateRental lets owners update only rentals they own, both the current owner and the owner in the
+// update are checked
+func (p *rentalServicePolicy) UpdateRental(ctx context.Context, rental domain.Rental) (domain.Rental, error) {
+	caller, _ := auth.FromContext(ctx)
+	var owners []uint
+	if p.policy.Grant(caller, auth.ActionWrite) == auth.AllowOwn {
+		current, err := p.repo.FindByID(domain.WithPrimaryReads(ctx), rental.ID)
+		if err != nil {
+			return domain.Rental{}, err
+		}
+		owners = append(owners, uint(current.User.ID), uint(rental.User.ID))
+	}
+	if err := p.policy.Authorize(caller, auth.ActionWrite, owners...); err != nil {
+		return domain.Rental{}, err
+	}
+	return p.next.UpdateRental(ctx, rental)
+}
+
+func (p *rentalServicePolicy) GetDeletedRentals(ctx context.Context, filter domain.RentalFindFilter) (domain.Response[domain.Rental], error) {
+	if err := p.authorize(ctx, auth.ActionAdmin); err != nil {
+		return domain.Response[domain.Rental]{}, err
+	}
+	return p.next.GetDeletedRentals(ctx, filter)
+}
+
+func (p *rentalServicePolicy) RestoreRental(ctx context.Context, id uint) (domain.Rental, error) {
+	if err := p.authorize(ctx, auth.ActionAdmin); err != nil {
+		return domain.Rental{}, err
+	}
+	return p.next.RestoreRental(ctx, id)
+}
+
+func (p *rentalServicePolicy) PurgeRental(ctx context.Context, id uint) error {
+	if err := p.authorize(ctx, auth.ActionAdmin); err != nil {
+		return err
+	}
+	return p.next.PurgeRental(ctx, id)
+}
+
+func (p *rentalServicePolicy) PurgeDeletedRentals(ctx context.Context, before time.Time) ([]uint, error) {
+	if err := p.authorize(ctx, auth.ActionAdmin); err != nil {
+		return nil, err
+	}
+	return p.next.PurgeDeletedRentals(ctx, before)
+}
+
+func (p *rentalServicePolicy) GetRentalHistory(ctx context.Context, id uint, page domain.ViewFilter) (domain.Response[domain.RentalRevision], error) {
+	if err := p.authorizeRental(ctx, auth.ActionHistory, id); err != nil {
+		return domain.Response[domain.RentalRevision]{}, err
+	}
+	return p.next.GetRentalHistory(ctx, id, page)
+}
+
+func (p *rentalServicePolicy) GetRentalAsOf(ctx context.Context, id uint, at time.Time) (domain.Rental, error) {
+	if err := p.authorizeRental(ctx, auth.ActionHistory, id); err != nil {
+		return domain.Rental{}, err
+	}
+	return p.next.GetRentalAsOf(ctx, id, at)
+}
+
+// Add more methods as needed
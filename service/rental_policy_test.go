@@ -0,0 +1,166 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/plar/rentals-api/auth"
+	"github.com/plar/rentals-api/domain"
+	"github.com/plar/rentals-api/repository/mocks"
+	"github.com/plar/rentals-api/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRentalServicePolicy(t *testing.T) {
+	owner := auth.NewContext(context.Background(), auth.Identity{Subject: "7", Roles: []string{"owner"}})
+	admin := auth.NewContext(context.Background(), auth.Identity{Subject: "admin-1", Roles: []string{"admin"}})
+	rows := []domain.ImportRow{
+		{Line: 2, Rental: domain.Rental{ID: 10, Name: "Van", Type: "camper-van", Price: domain.Price{Day: 100}, User: domain.User{ID: 7}}},
+		{Line: 3, Rental: domain.Rental{Name: "New van", Type: "camper-van", Price: domain.Price{Day: 100}, User: domain.User{ID: 7}}},
+	}
+
+	t.Run("anonymous reads", func(t *testing.T) {
+		mockRepo := &mocks.RentalRepository{}
+		mockRepo.On("FindByID", mock.Anything, uint(1)).Return(domain.Rental{ID: 1}, nil)
+
+		rentalService := service.NewRentalServicePolicy(service.NewRentalService(mockRepo, nil), mockRepo, auth.DefaultPolicy)
+		_, err := rentalService.GetRentalByID(context.Background(), 1)
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("owner cannot export", func(t *testing.T) {
+		mockRepo := &mocks.RentalRepository{}
+
+		rentalService := service.NewRentalServicePolicy(service.NewRentalService(mockRepo, nil), mockRepo, auth.DefaultPolicy)
+		err := rentalService.ExportRentals(owner, domain.RentalFindFilter{}, func(domain.Rental) error { return nil })
+		assert.ErrorIs(t, err, auth.ErrForbidden)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("owner imports own rentals", func(t *testing.T) {
+		mockRepo := &mocks.RentalRepository{}
+		mockRepo.On("FindByIDs", mock.Anything, []uint{10}).Return([]domain.Rental{{ID: 10, User: domain.User{ID: 7}}}, nil)
+		mockRepo.On("FindDeleted", mock.Anything, mock.Anything).Return(domain.Response[domain.Rental]{}, nil)
+		mockRepo.On("Upsert", mock.Anything, mock.Anything).Return(nil)
+
+		rentalService := service.NewRentalServicePolicy(service.NewRentalService(mockRepo, nil), mockRepo, auth.DefaultPolicy)
+		report, err := rentalService.ImportRentals(owner, rows, false)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, report.Imported)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("owner cannot overwrite others rental", func(t *testing.T) {
+		mockRepo := &mocks.RentalRepository{}
+		mockRepo.On("FindByIDs", mock.Anything, []uint{10}).Return([]domain.Rental{{ID: 10, User: domain.User{ID: 8}}}, nil)
+
+		rentalService := service.NewRentalServicePolicy(service.NewRentalService(mockRepo, nil), mockRepo, auth.DefaultPolicy)
+		_, err := rentalService.ImportRentals(owner, rows, true)
+		var forbidden *auth.ForbiddenError
+		assert.ErrorAs(t, err, &forbidden)
+		assert.Equal(t, "rental owned by user 8", forbidden.Reason)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("owner cannot import a deleted rental", func(t *testing.T) {
+		deletedAt := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+		for _, deletedOwner := range []int{8, 7} {
+			mockRepo := &mocks.RentalRepository{}
+			mockRepo.On("FindByIDs", mock.Anything, []uint{10}).Return([]domain.Rental{}, nil)
+			mockRepo.On("FindDeleted", mock.MatchedBy(domain.PrimaryReads), mock.MatchedBy(func(f domain.RentalFindFilter) bool {
+				ids, _ := f.RentalIDs()
+				return len(ids) == 1 && ids[0] == 10
+			})).Return(domain.Response[domain.Rental]{Items: []domain.Rental{{ID: 10, User: domain.User{ID: deletedOwner}, DeletedAt: &deletedAt}}}, nil)
+
+			rentalService := service.NewRentalServicePolicy(service.NewRentalService(mockRepo, nil), mockRepo, auth.DefaultPolicy)
+			_, err := rentalService.ImportRentals(owner, rows, false)
+			var forbidden *auth.ForbiddenError
+			assert.ErrorAs(t, err, &forbidden, "deleted rental of user %d", deletedOwner)
+			mockRepo.AssertExpectations(t)
+		}
+	})
+
+	t.Run("admin imports without owner lookup", func(t *testing.T) {
+		mockRepo := &mocks.RentalRepository{}
+		mockRepo.On("FindDeleted", mock.Anything, mock.Anything).Return(domain.Response[domain.Rental]{}, nil)
+
+		rentalService := service.NewRentalServicePolicy(service.NewRentalService(mockRepo, nil), mockRepo, auth.DefaultPolicy)
+		report, err := rentalService.ImportRentals(admin, rows, true)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, report.Valid)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("only admins restore and purge", func(t *testing.T) {
+		mockRepo := &mocks.RentalRepository{}
+		mockRepo.On("Restore", mock.Anything, uint(10)).Return(domain.Rental{ID: 10}, nil)
+		mockRepo.On("Purge", mock.Anything, uint(11)).Return(nil)
+
+		rentalService := service.NewRentalServicePolicy(service.NewRentalService(mockRepo, nil), mockRepo, auth.DefaultPolicy)
+		_, err := rentalService.GetDeletedRentals(owner, domain.RentalFindFilter{})
+		assert.ErrorIs(t, err, auth.ErrForbidden)
+		_, err = rentalService.RestoreRental(owner, 10)
+		assert.ErrorIs(t, err, auth.ErrForbidden)
+		assert.ErrorIs(t, rentalService.PurgeRental(owner, 11), auth.ErrForbidden)
+
+		_, err = rentalService.RestoreRental(admin, 10)
+		assert.NoError(t, err)
+		assert.NoError(t, rentalService.PurgeRental(admin, 11))
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("owners see the history of their own rentals", func(t *testing.T) {
+		at := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+		page, _ := domain.NewRentalFilterBuilder().WithLimit(10).Build()
+		mockRepo := &mocks.RentalRepository{}
+		mockRepo.On("FindByID", mock.MatchedBy(domain.PrimaryReads), uint(10)).Return(domain.Rental{ID: 10, User: domain.User{ID: 7}}, nil)
+		mockRepo.On("FindByID", mock.MatchedBy(domain.PrimaryReads), uint(11)).Return(domain.Rental{ID: 11, User: domain.User{ID: 8}}, nil)
+		mockRepo.On("FindRevisions", mock.Anything, uint(10), &page).Return(domain.Response[domain.RentalRevision]{}, nil)
+		mockRepo.On("FindAsOf", mock.Anything, uint(11), at).Return(domain.Rental{ID: 11}, nil)
+
+		rentalService := service.NewRentalServicePolicy(service.NewRentalService(mockRepo, nil), mockRepo, auth.DefaultPolicy)
+		_, err := rentalService.GetRentalHistory(owner, 10, &page)
+		assert.NoError(t, err)
+		_, err = rentalService.GetRentalAsOf(owner, 11, at)
+		assert.ErrorIs(t, err, auth.ErrForbidden)
+		_, err = rentalService.GetRentalHistory(context.Background(), 10, &page)
+		assert.ErrorIs(t, err, auth.ErrForbidden)
+
+		// admins need no owner lookup
+		_, err = rentalService.GetRentalAsOf(admin, 11, at)
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		mockRepo.AssertNumberOfCalls(t, "FindByID", 2)
+	})
+
+	t.Run("owners update their own rentals only", func(t *testing.T) {
+		van := domain.Rental{ID: 10, Name: "Van", Type: "camper-van", Price: domain.Price{Day: 100}, User: domain.User{ID: 7}, Version: 2}
+		mockRepo := &mocks.RentalRepository{}
+		mockRepo.On("FindByID", mock.MatchedBy(domain.PrimaryReads), uint(10)).Return(domain.Rental{ID: 10, User: domain.User{ID: 7}}, nil)
+		mockRepo.On("FindByID", mock.MatchedBy(domain.PrimaryReads), uint(11)).Return(domain.Rental{ID: 11, User: domain.User{ID: 8}}, nil)
+		mockRepo.On("Update", mock.Anything, van).Return(van, nil)
+
+		rentalService := service.NewRentalServicePolicy(service.NewRentalService(mockRepo, nil), mockRepo, auth.DefaultPolicy)
+		_, err := rentalService.UpdateRental(owner, van)
+		assert.NoError(t, err)
+
+		// neither someone else's rental nor a transfer to someone else
+		other := van
+		other.ID = 11
+		_, err = rentalService.UpdateRental(owner, other)
+		assert.ErrorIs(t, err, auth.ErrForbidden)
+		transfer := van
+		transfer.User.ID = 8
+		_, err = rentalService.UpdateRental(owner, transfer)
+		assert.ErrorIs(t, err, auth.ErrForbidden)
+
+		_, err = rentalService.UpdateRental(context.Background(), van)
+		assert.ErrorIs(t, err, auth.ErrForbidden)
+		mockRepo.AssertExpectations(t)
+		mockRepo.AssertNumberOfCalls(t, "Update", 1)
+	})
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// PurgeDeletedRentals removes for good, at start and then every interval, the rentals soft-deleted longer
+// than retention ago, until ctx is done. It is not run on behalf of a caller, svc must not check the policy.
+func PurgeDeletedRentals(ctx context.Context, svc RentalService, retention, interval time.Duration, logger *zap.Logger) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		before := time.Now().Add(-retention)
+		if purged, err := svc.PurgeDeletedRentals(ctx, before); err != nil && ctx.Err() == nil {
+			logger.Error("Cannot purge deleted rentals", zap.Time("before", before), zap.Error(err))
+		} else if len(purged) > 0 {
+			logger.Info("Purged deleted rentals", zap.Int("purged", len(purged)), zap.Duration("retention", retention))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/plar/rentals-api/service"
+	"github.com/plar/rentals-api/service/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPurgeDeletedRentals(t *testing.T) {
+	mockSvc := &mocks.RentalService{}
+	retention := 30 * 24 * time.Hour
+	start := time.Now()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	// a failed purge is retried at the next interval
+	mockSvc.On("PurgeDeletedRentals", mock.Anything, mock.MatchedBy(func(before time.Time) bool {
+		return !before.After(start.Add(-retention).Add(time.Minute)) && before.After(start.Add(-retention).Add(-time.Minute))
+	})).Return([]uint(nil), errors.New("connection refused")).Once()
+	mockSvc.On("PurgeDeletedRentals", mock.Anything, mock.Anything).Return([]uint{3, 4}, nil).Run(func(mock.Arguments) {
+		if calls++; calls == 2 {
+			cancel()
+		}
+	})
+
+	done := make(chan struct{})
+	go func() {
+		service.PurgeDeletedRentals(ctx, mockSvc, retention, time.Millisecond, nil)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("purge did not stop with its context")
+	}
+	assert.Equal(t, 2, calls)
+	mockSvc.AssertNumberOfCalls(t, "PurgeDeletedRentals", 3)
+}
@@ -1,14 +1,33 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/plar/rentals-api/domain"
 	"go.uber.org/zap"
 )
 
 type RentalService interface {
-	GetAllRentals() ([]domain.Rental, error)
-	GetRentalByID(id uint) (domain.Rental, error)
-	GetRentalsByFilter(filter domain.RentalFindFilter) (domain.Response[domain.Rental], error)
+	GetAllRentals(ctx context.Context) ([]domain.Rental, error)
+	GetRentalByID(ctx context.Context, id uint) (domain.Rental, error)
+	BatchGetRentals(ctx context.Context, ids []uint) (domain.BatchResponse[domain.Rental], error)
+	GetRentalsByFilter(ctx context.Context, filter domain.RentalFindFilter) (domain.Response[domain.Rental], error)
+	ExportRentals(ctx context.Context, filter domain.RentalFindFilter, fn func(domain.Rental) error) error
+	ImportRentals(ctx context.Context, rows []domain.ImportRow, dryRun bool) (domain.ImportReport, error)
+	// UpdateRental overwrites a rental if it is still at rental.Version, see domain.RentalRepository.Update
+	UpdateRental(ctx context.Context, rental domain.Rental) (domain.Rental, error)
+	GetDeletedRentals(ctx context.Context, filter domain.RentalFindFilter) (domain.Response[domain.Rental], error)
+	RestoreRental(ctx context.Context, id uint) (domain.Rental, error)
+	PurgeRental(ctx context.Context, id uint) error
+	// PurgeDeletedRentals removes for good the rentals soft-deleted before the time, it returns their IDs
+	PurgeDeletedRentals(ctx context.Context, before time.Time) ([]uint, error)
+	// GetRentalHistory returns the revisions of a rental, the last one first
+	GetRentalHistory(ctx context.Context, id uint, page domain.ViewFilter) (domain.Response[domain.RentalRevision], error)
+	// GetRentalAsOf returns the rental as it was at the time
+	GetRentalAsOf(ctx context.Context, id uint, at time.Time) (domain.Rental, error)
 }
 
 type rentalService struct {
@@ -22,14 +41,188 @@ func NewRentalService(repo domain.RentalRepository, logger *zap.Logger) RentalSe
 	return &rentalService{repo}
 }
 
-func (s *rentalService) GetAllRentals() ([]domain.Rental, error) {
-	return s.repo.FindAll()
+func (s *rentalService) GetAllRentals(ctx context.Context) ([]domain.Rental, error) {
+	return s.repo.FindAll(ctx)
+}
+
+func (s *rentalService) GetRentalByID(ctx context.Context, id uint) (domain.Rental, error) {
+	return s.repo.FindByID(ctx, id)
+}
+
+// BatchGetRentals returns rentals in the order of ids, duplicates are returned once
+func (s *rentalService) BatchGetRentals(ctx context.Context, ids []uint) (domain.BatchResponse[domain.Rental], error) {
+	response := domain.BatchResponse[domain.Rental]{
+		Items:    []domain.Rental{},
+		NotFound: []uint{},
+	}
+
+	uniqueIDs := make([]uint, 0, len(ids))
+	seen := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			uniqueIDs = append(uniqueIDs, id)
+		}
+	}
+
+	rentals, err := s.repo.FindByIDs(ctx, uniqueIDs)
+	if err != nil {
+		return response, err
+	}
+
+	byID := make(map[uint]domain.Rental, len(rentals))
+	for _, rental := range rentals {
+		byID[rental.ID] = rental
+	}
+	for _, id := range uniqueIDs {
+		if rental, ok := byID[id]; ok {
+			response.Items = append(response.Items, rental)
+		} else {
+			response.NotFound = append(response.NotFound, id)
+		}
+	}
+	return response, nil
+}
+
+func (s *rentalService) GetRentalsByFilter(ctx context.Context, filter domain.RentalFindFilter) (domain.Response[domain.Rental], error) {
+	return s.repo.FindByFilter(ctx, filter)
+}
+
+func (s *rentalService) ExportRentals(ctx context.Context, filter domain.RentalFindFilter, fn func(domain.Rental) error) error {
+	return s.repo.StreamByFilter(ctx, filter, fn)
+}
+
+// ImportRentals validates every row and, unless it is a dry run, upserts all of them in one transaction.
+// Nothing is written when any row is invalid, the report lists the errors per row. A row cannot
+// overwrite a soft-deleted rental, it is restored with RestoreRental.
+func (s *rentalService) ImportRentals(ctx context.Context, rows []domain.ImportRow, dryRun bool) (domain.ImportReport, error) {
+	report := domain.ImportReport{
+		DryRun: dryRun,
+		Total:  len(rows),
+		Errors: []domain.ImportRowError{},
+	}
+
+	deleted, err := s.deletedRows(ctx, rows)
+	if err != nil {
+		return report, err
+	}
+
+	rentals := make([]domain.Rental, 0, len(rows))
+	seenIDs := make(map[uint]int)
+	for _, row := range rows {
+		err := row.Err
+		if err == nil {
+			err = row.Rental.Validate()
+		}
+		if err == nil && row.Rental.ID != 0 {
+			if line, ok := seenIDs[row.Rental.ID]; ok {
+				err = fmt.Errorf("duplicate id, first seen at line %d", line)
+			} else if deleted[row.Rental.ID] {
+				err = errors.New("rental is deleted, restore it before importing it")
+			}
+			seenIDs[row.Rental.ID] = row.Line
+		}
+
+		if err != nil {
+			report.Errors = append(report.Errors, toImportRowError(row, err))
+			continue
+		}
+		rentals = append(rentals, row.Rental)
+	}
+	report.Valid = len(rentals)
+
+	if dryRun || report.HasErrors() || len(rentals) == 0 {
+		return report, nil
+	}
+
+	if err := s.repo.Upsert(ctx, rentals); err != nil {
+		return report, err
+	}
+	report.Imported = len(rentals)
+	return report, nil
+}
+
+// deletedRows returns the IDs of the rows which belong to soft-deleted rentals, an upsert would undelete them
+func (s *rentalService) deletedRows(ctx context.Context, rows []domain.ImportRow) (map[uint]bool, error) {
+	var ids []uint
+	for _, row := range rows {
+		if row.Err == nil && row.Rental.ID != 0 {
+			ids = append(ids, row.Rental.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	rentals, err := deletedAmong(domain.WithPrimaryReads(ctx), s.repo, ids)
+	if err != nil {
+		return nil, err
+	}
+	deleted := make(map[uint]bool, len(rentals))
+	for _, rental := range rentals {
+		deleted[rental.ID] = true
+	}
+	return deleted, nil
+}
+
+// deletedAmong returns the soft-deleted rentals among ids
+func deletedAmong(ctx context.Context, repo domain.RentalRepository, ids []uint) ([]domain.Rental, error) {
+	rentalIDs := make([]int, len(ids))
+	for i, id := range ids {
+		rentalIDs[i] = int(id)
+	}
+	filter, err := domain.NewRentalFilterBuilder().WithRentalIDs(rentalIDs).Build()
+	if err != nil {
+		return nil, err
+	}
+	response, err := repo.FindDeleted(ctx, filter)
+	return response.Items, err
+}
+
+func toImportRowError(row domain.ImportRow, err error) domain.ImportRowError {
+	rowErr := domain.ImportRowError{
+		Line: row.Line,
+		ID:   row.Rental.ID,
+	}
+
+	var verrs domain.ValidationErrors
+	if errors.As(err, &verrs) {
+		for _, verr := range verrs {
+			rowErr.Errors = append(rowErr.Errors, verr.Error())
+		}
+	} else {
+		rowErr.Errors = append(rowErr.Errors, err.Error())
+	}
+	return rowErr
+}
+
+// UpdateRental validates the rental before it is written, a domain.ValidationErrors is returned when it is invalid
+func (s *rentalService) UpdateRental(ctx context.Context, rental domain.Rental) (domain.Rental, error) {
+	if err := rental.Validate(); err != nil {
+		return domain.Rental{}, err
+	}
+	return s.repo.Update(ctx, rental)
+}
+
+func (s *rentalService) GetDeletedRentals(ctx context.Context, filter domain.RentalFindFilter) (domain.Response[domain.Rental], error) {
+	return s.repo.FindDeleted(ctx, filter)
+}
+
+func (s *rentalService) RestoreRental(ctx context.Context, id uint) (domain.Rental, error) {
+	return s.repo.Restore(ctx, id)
+}
+
+func (s *rentalService) PurgeRental(ctx context.Context, id uint) error {
+	return s.repo.Purge(ctx, id)
+}
+
+func (s *rentalService) PurgeDeletedRentals(ctx context.Context, before time.Time) ([]uint, error) {
+	return s.repo.PurgeDeleted(ctx, before)
 }
 
-func (s *rentalService) GetRentalByID(id uint) (domain.Rental, error) {
-	return s.repo.FindByID(id)
+func (s *rentalService) GetRentalHistory(ctx context.Context, id uint, page domain.ViewFilter) (domain.Response[domain.RentalRevision], error) {
+	return s.repo.FindRevisions(ctx, id, page)
 }
 
-func (s *rentalService) GetRentalsByFilter(filter domain.RentalFindFilter) (domain.Response[domain.Rental], error) {
-	return s.repo.FindByFilter(filter)
+func (s *rentalService) GetRentalAsOf(ctx context.Context, id uint, at time.Time) (domain.Rental, error) {
+	return s.repo.FindAsOf(ctx, id, at)
 }
@@ -1,13 +1,17 @@
 package service_test
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/plar/rentals-api/domain"
 	"github.com/plar/rentals-api/repository/mocks"
 	"github.com/plar/rentals-api/service"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestGetAllRentals(t *testing.T) {
@@ -17,14 +21,164 @@ func TestGetAllRentals(t *testing.T) {
 		{ID: 2, Name: "Test Rental 2"},
 	}
 
-	mockRepo.On("FindAll").Return(mockRentals, nil)
+	mockRepo.On("FindAll", mock.Anything).Return(mockRentals, nil)
 
 	rentalService := service.NewRentalService(mockRepo, nil)
-	rentals, err := rentalService.GetAllRentals()
+	rentals, err := rentalService.GetAllRentals(context.Background())
 
 	assert.NoError(t, err)
 	assert.Len(t, rentals, 2)
 	mockRepo.AssertExpectations(t)
 }
 
+func TestExportRentals(t *testing.T) {
+	mockRepo := &mocks.RentalRepository{}
+	filter, _ := domain.NewRentalFilterBuilder().WithPriceMax(20000).Build()
+	fn := func(domain.Rental) error { return nil }
+
+	mockRepo.On("StreamByFilter", mock.Anything, filter, mock.Anything).Return(nil)
+
+	rentalService := service.NewRentalService(mockRepo, nil)
+	err := rentalService.ExportRentals(context.Background(), filter, fn)
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestImportRentals(t *testing.T) {
+	valid := func(id uint, name string) domain.Rental {
+		return domain.Rental{
+			ID:    id,
+			Name:  name,
+			Type:  "camper-van",
+			Price: domain.Price{Day: 100},
+			User:  domain.User{ID: 1},
+		}
+	}
+
+	t.Run("valid rows are upserted", func(t *testing.T) {
+		rows := []domain.ImportRow{
+			{Line: 2, Rental: valid(0, "New")},
+			{Line: 3, Rental: valid(7, "Existing")},
+		}
+		mockRepo := &mocks.RentalRepository{}
+		mockRepo.On("FindDeleted", mock.MatchedBy(domain.PrimaryReads), mock.Anything).Return(domain.Response[domain.Rental]{}, nil)
+		mockRepo.On("Upsert", mock.Anything, []domain.Rental{rows[0].Rental, rows[1].Rental}).Return(nil)
+
+		report, err := service.NewRentalService(mockRepo, nil).ImportRentals(context.Background(), rows, false)
+
+		assert.NoError(t, err)
+		assert.Equal(t, domain.ImportReport{Total: 2, Valid: 2, Imported: 2, Errors: []domain.ImportRowError{}}, report)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("dry run does not write", func(t *testing.T) {
+		rows := []domain.ImportRow{{Line: 2, Rental: valid(0, "New")}}
+		mockRepo := &mocks.RentalRepository{}
+
+		report, err := service.NewRentalService(mockRepo, nil).ImportRentals(context.Background(), rows, true)
+
+		assert.NoError(t, err)
+		assert.Equal(t, domain.ImportReport{DryRun: true, Total: 1, Valid: 1, Errors: []domain.ImportRowError{}}, report)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("any invalid row rejects the import", func(t *testing.T) {
+		invalid := valid(0, "")
+		invalid.Price.Day = 0
+		rows := []domain.ImportRow{
+			{Line: 2, Rental: valid(5, "Van")},
+			{Line: 3, Rental: invalid},
+			{Line: 4, Err: errors.New(`invalid year value "abc"`)},
+			{Line: 5, Rental: valid(5, "Same ID")},
+		}
+		mockRepo := &mocks.RentalRepository{}
+		mockRepo.On("FindDeleted", mock.Anything, mock.Anything).Return(domain.Response[domain.Rental]{}, nil)
+
+		report, err := service.NewRentalService(mockRepo, nil).ImportRentals(context.Background(), rows, false)
+
+		assert.NoError(t, err)
+		assert.Equal(t, domain.ImportReport{
+			Total: 4,
+			Valid: 1,
+			Errors: []domain.ImportRowError{
+				{Line: 3, Errors: []string{"name: is required", "price.day: must be positive"}},
+				{Line: 4, Errors: []string{`invalid year value "abc"`}},
+				{Line: 5, ID: 5, Errors: []string{"duplicate id, first seen at line 2"}},
+			},
+		}, report)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("a deleted rental is not undeleted", func(t *testing.T) {
+		deletedAt := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+		rows := []domain.ImportRow{
+			{Line: 2, Rental: valid(5, "Van")},
+			{Line: 3, Rental: valid(6, "Deleted van")},
+		}
+		mockRepo := &mocks.RentalRepository{}
+		mockRepo.On("FindDeleted", mock.MatchedBy(domain.PrimaryReads), mock.MatchedBy(func(f domain.RentalFindFilter) bool {
+			ids, _ := f.RentalIDs()
+			return assert.ElementsMatch(t, []int{5, 6}, ids)
+		})).Return(domain.Response[domain.Rental]{Items: []domain.Rental{{ID: 6, DeletedAt: &deletedAt}}}, nil)
+
+		report, err := service.NewRentalService(mockRepo, nil).ImportRentals(context.Background(), rows, false)
+
+		assert.NoError(t, err)
+		assert.Equal(t, domain.ImportReport{
+			Total:  2,
+			Valid:  1,
+			Errors: []domain.ImportRowError{{Line: 3, ID: 6, Errors: []string{"rental is deleted, restore it before importing it"}}},
+		}, report)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("repository error", func(t *testing.T) {
+		rows := []domain.ImportRow{{Line: 2, Rental: valid(0, "New")}}
+		mockRepo := &mocks.RentalRepository{}
+		mockRepo.On("Upsert", mock.Anything, mock.Anything).Return(errors.New("db is down"))
+
+		report, err := service.NewRentalService(mockRepo, nil).ImportRentals(context.Background(), rows, false)
+
+		assert.EqualError(t, err, "db is down")
+		assert.Equal(t, 0, report.Imported)
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestUpdateRental(t *testing.T) {
+	mockRepo := &mocks.RentalRepository{}
+	rental := domain.Rental{ID: 1, Name: "Van", Type: "camper-van", Price: domain.Price{Day: 100}, User: domain.User{ID: 7}, Version: 2}
+	mockRepo.On("Update", mock.Anything, rental).Return(domain.Rental{ID: 1, Version: 3}, nil)
+
+	rentalService := service.NewRentalService(mockRepo, nil)
+	updated, err := rentalService.UpdateRental(context.Background(), rental)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(3), updated.Version)
+
+	// an invalid rental is not written
+	_, err = rentalService.UpdateRental(context.Background(), domain.Rental{ID: 1, Version: 2})
+	var verrs domain.ValidationErrors
+	assert.ErrorAs(t, err, &verrs)
+	mockRepo.AssertNumberOfCalls(t, "Update", 1)
+}
+
+func TestBatchGetRentals(t *testing.T) {
+	mockRepo := &mocks.RentalRepository{}
+	mockRentals := []domain.Rental{
+		{ID: 1, Name: "Test Rental 1"},
+		{ID: 3, Name: "Test Rental 3"},
+	}
+
+	mockRepo.On("FindByIDs", mock.Anything, []uint{3, 42, 1}).Return(mockRentals, nil)
+
+	rentalService := service.NewRentalService(mockRepo, nil)
+	response, err := rentalService.BatchGetRentals(context.Background(), []uint{3, 42, 3, 1})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.Rental{mockRentals[1], mockRentals[0]}, response.Items)
+	assert.Equal(t, []uint{42}, response.NotFound)
+	mockRepo.AssertExpectations(t)
+}
+
 // Add more service layer tests
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/plar/rentals-api/domain"
+	"github.com/plar/rentals-api/tracing"
+)
+
+const tracerName = "github.com/plar/rentals-api/service"
+
+type rentalServiceTracer struct {
+	next   RentalService
+	tracer trace.Tracer
+}
+
+var _ RentalService = (*rentalServiceTracer)(nil)
+
+// NewRentalServiceTracer wraps every service call in a span named RentalService.<Method>
+func NewRentalServiceTracer(next RentalService, tp trace.TracerProvider) RentalService {
+	return &rentalServiceTracer{
+		next:   next,
+		tracer: tp.Tracer(tracerName),
+	}
+}
+
+func (t *rentalServiceTracer) start(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return t.tracer.Start(ctx, "RentalService."+method, trace.WithAttributes(attrs...))
+}
+
+func (t *rentalServiceTracer) GetAllRentals(ctx context.Context) (rentals []domain.Rental, err error) {
+	ctx, span := t.start(ctx, "GetAllRentals")
+	defer func() { tracing.End(span, err) }()
+	return t.next.GetAllRentals(ctx)
+}
+
+func (t *rentalServiceTracer) GetRentalByID(ctx context.Context, id uint) (rental domain.Rental, err error) {
+	ctx, span := t.start(ctx, "GetRentalByID", attribute.Int64("rental.id", int64(id)))
+	defer func() { tracing.End(span, err) }()
+	return t.next.GetRentalByID(ctx, id)
+}
+
+func (t *rentalServiceTracer) BatchGetRentals(ctx context.Context, ids []uint) (response domain.BatchResponse[domain.Rental], err error) {
+	ctx, span := t.start(ctx, "BatchGetRentals", attribute.Int("rental.ids.count", len(ids)))
+	defer func() {
+		span.SetAttributes(attribute.Int("rentals.not_found.count", len(response.NotFound)))
+		tracing.End(span, err)
+	}()
+	return t.next.BatchGetRentals(ctx, ids)
+}
+
+func (t *rentalServiceTracer) GetRentalsByFilter(ctx context.Context, filter domain.RentalFindFilter) (response domain.Response[domain.Rental], err error) {
+	ctx, span := t.start(ctx, "GetRentalsByFilter", attribute.String("rental.filter", filter.String()))
+	defer func() { tracing.End(span, err) }()
+	return t.next.GetRentalsByFilter(ctx, filter)
+}
+
+func (t *rentalServiceTracer) ExportRentals(ctx context.Context, filter domain.RentalFindFilter, fn func(domain.Rental) error) (err error) {
+	ctx, span := t.start(ctx, "ExportRentals", attribute.String("rental.filter", filter.String()))
+	defer func() { tracing.End(span, err) }()
+	return t.next.ExportRentals(ctx, filter, fn)
+}
+
+func (t *rentalServiceTracer) ImportRentals(ctx context.Context, rows []domain.ImportRow, dryRun bool) (report domain.ImportReport, err error) {
+	ctx, span := t.start(ctx, "ImportRentals", attribute.Int("import.rows", len(rows)), attribute.Bool("import.dry_run", dryRun))
+	defer func() {
+		span.SetAttributes(
+			attribute.Int("import.valid", report.Valid),
+			attribute.Int("import.imported", report.Imported),
+			attribute.Int("import.errors", len(report.Errors)),
+		)
+		tracing.End(span, err)
+	}()
+	return t.next.ImportRentals(ctx, rows, dryRun)
+}
+
+func (t *rentalServiceTracer) GetDeletedRentals(ctx context.Context, filter domain.RentalFindFilter) (response domain.Response[domain.Rental], err error) {
+	ctx, span := t.start(ctx, "GetDeletedRentals", attribute.String("rental.filter", filter.String()))
+	defer func() { tracing.End(span, err) }()
+	return t.next.GetDeletedRentals(ctx, filter)
+}
+
+func (t *rentalServiceTracer) UpdateRental(ctx context.Context, rental domain.Rental) (updated domain.Rental, err error) {
+	ctx, span := t.start(ctx, "UpdateRental", attribute.Int64("rental.id", int64(rental.ID)), attribute.Int64("rental.version", int64(rental.Version)))
+	defer func() { tracing.End(span, err) }()
+	return t.next.UpdateRental(ctx, rental)
+}
+
+func (t *rentalServiceTracer) RestoreRental(ctx context.Context, id uint) (rental domain.Rental, err error) {
+	ctx, span := t.start(ctx, "RestoreRental", attribute.Int64("rental.id", int64(id)))
+	defer func() { tracing.End(span, err) }()
+	return t.next.RestoreRental(ctx, id)
+}
+
+func (t *rentalServiceTracer) PurgeRental(ctx context.Context, id uint) (err error) {
+	ctx, span := t.start(ctx, "PurgeRental", attribute.Int64("rental.id", int64(id)))
+	defer func() { tracing.End(span, err) }()
+	return t.next.PurgeRental(ctx, id)
+}
+
+func (t *rentalServiceTracer) PurgeDeletedRentals(ctx context.Context, before time.Time) (purged []uint, err error) {
+	ctx, span := t.start(ctx, "PurgeDeletedRentals", attribute.String("rental.deleted_before", before.Format(time.RFC3339)))
+	defer func() {
+		span.SetAttributes(attribute.Int("rentals.count", len(purged)))
+		tracing.End(span, err)
+	}()
+	return t.next.PurgeDeletedRentals(ctx, before)
+}
+
+func (t *rentalServiceTracer) GetRentalHistory(ctx context.Context, id uint, page domain.ViewFilter) (response domain.Response[domain.RentalRevision], err error) {
+	ctx, span := t.start(ctx, "GetRentalHistory", attribute.Int64("rental.id", int64(id)))
+	defer func() { tracing.End(span, err) }()
+	return t.next.GetRentalHistory(ctx, id, page)
+}
+
+func (t *rentalServiceTracer) GetRentalAsOf(ctx context.Context, id uint, at time.Time) (rental domain.Rental, err error) {
+	ctx, span := t.start(ctx, "GetRentalAsOf", attribute.Int64("rental.id", int64(id)), attribute.String("rental.as_of", at.Format(time.RFC3339)))
+	defer func() { tracing.End(span, err) }()
+	return t.next.GetRentalAsOf(ctx, id, at)
+}
+
+// Add more methods as needed
@@ -0,0 +1,43 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/plar/rentals-api/domain"
+	"github.com/plar/rentals-api/repository"
+	"github.com/plar/rentals-api/repository/mocks"
+	"github.com/plar/rentals-api/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRentalServiceTracer(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	mockRepo := &mocks.RentalRepository{}
+	mockRepo.On("FindByIDs", mock.Anything, []uint{1, 2}).Return([]domain.Rental{{ID: 1}}, nil)
+
+	repo := repository.NewRentalRepositoryTracer(mockRepo, tp)
+	rentalService := service.NewRentalServiceTracer(service.NewRentalService(repo, nil), tp)
+	response, err := rentalService.BatchGetRentals(context.Background(), []uint{1, 2, 1})
+	require.NoError(t, err)
+	assert.Equal(t, []uint{2}, response.NotFound)
+
+	// spans are exported as they end, the child first
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "RentalRepository.FindByIDs", spans[0].Name)
+	assert.Equal(t, "RentalService.BatchGetRentals", spans[1].Name)
+	assert.Equal(t, spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID())
+	assert.Equal(t, spans[1].SpanContext.TraceID(), spans[0].SpanContext.TraceID())
+	assert.Contains(t, spans[1].Attributes, attribute.Int("rental.ids.count", 3))
+	assert.Contains(t, spans[1].Attributes, attribute.Int("rentals.not_found.count", 1))
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/plar/rentals-api/config"
+	"github.com/plar/rentals-api/domain"
+	"github.com/plar/rentals-api/handler"
+	"github.com/plar/rentals-api/migrate"
+	"github.com/plar/rentals-api/repository"
+	"github.com/plar/rentals-api/repository/memory"
+)
+
+// storage holds the repositories of the configured backend. db and migrated are nil without database,
+// close releases the connections.
+type storage struct {
+	rentals  domain.RentalRepository
+	images   domain.RentalImageRepository
+	apiKeys  domain.APIKeyRepository
+	router   *repository.DBRouter
+	db       *sql.DB
+	migrated handler.ReadinessCheck
+	close    func()
+}
+
+// openMemory returns the memory backend loaded with the seed fixture, API keys cannot be created
+// for it since the apikey command works on a database
+func openMemory(log *zap.Logger, cfg config.RepositoryConfig) storage {
+	rentals := memory.NewRentalRepository(cfg)
+	if cfg.Seed != "" {
+		if err := rentals.LoadFile(cfg.Seed); err != nil {
+			log.Fatal("Cannot load the seed fixture", zap.Error(err))
+		}
+		all, _ := rentals.FindAll(context.Background())
+		log.Info("Loaded the seed fixture", zap.String("seed", cfg.Seed), zap.Int("rentals", len(all)))
+	}
+	log.Warn("The rentals are kept in memory, they are lost on exit")
+	return storage{
+		rentals: rentals,
+		images:  memory.NewRentalImageRepository(),
+		apiKeys: memory.NewAPIKeyRepository(),
+		close:   func() {},
+	}
+}
+
+// openPostgres connects to the primary and the read replicas, registers their pool stats on registry
+// and checks the schema version, the replica health checks run until ctx is done
+func openPostgres(ctx context.Context, log *zap.Logger, cfg config.Config, tp trace.TracerProvider, registry *prometheus.Registry) storage {
+	db, err := openDB(log, cfg)
+	if err != nil {
+		log.Fatal("Failed to connect to database", zap.Error(err))
+	}
+
+	replicas, err := openReplicas(log, cfg.DB)
+	if err != nil {
+		log.Fatal("Failed to open read replica", zap.Error(err))
+	}
+
+	for _, gormDB := range append([]*gorm.DB{db}, replicaDBs(replicas)...) {
+		if err = gormDB.Use(repository.NewGormTracing(tp)); err != nil {
+			log.Fatal("Failed to setup GORM tracing", zap.Error(err))
+		}
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Fatal("Cannot get DB", zap.Error(err))
+	}
+	registry.MustRegister(collectors.NewDBStatsCollector(sqlDB, cfg.DB.Name))
+	for _, replica := range replicas {
+		replicaDB, err := replica.DB.DB()
+		if err != nil {
+			log.Fatal("Cannot get DB", zap.Error(err))
+		}
+		registry.MustRegister(collectors.NewDBStatsCollector(replicaDB, cfg.DB.Name+"@"+replica.Name))
+	}
+
+	// reads go to the healthy replicas, writes and the reads following them to the primary
+	dbRouter := repository.NewDBRouter(db, replicas, cfg.DB.Replicas.StickyWindow, log)
+	checkCtx, cancelCheck := context.WithTimeout(ctx, cfg.DB.Replicas.CheckInterval)
+	dbRouter.CheckReplicas(checkCtx)
+	cancelCheck()
+	go dbRouter.Watch(ctx, cfg.DB.Replicas.CheckInterval)
+
+	migrator := migrateDB(log, db, cfg.DB.AutoMigrate)
+
+	return storage{
+		rentals:  repository.NewRoutedRentalRepository(dbRouter, cfg.Repository, log),
+		images:   repository.NewRoutedRentalImageRepository(dbRouter),
+		apiKeys:  repository.NewAPIKeyRepository(db),
+		router:   dbRouter,
+		db:       sqlDB,
+		migrated: migrator.Check,
+		close: func() {
+			for _, replica := range replicas {
+				closeDB(log, replica.DB)
+			}
+			closeDB(log, db)
+		},
+	}
+}
+
+// openSQLite opens the database file and loads the seed fixture into it while it has no rentals
+func openSQLite(log *zap.Logger, cfg config.Config, tp trace.TracerProvider, registry *prometheus.Registry) storage {
+	db, err := openDB(log, cfg)
+	if err != nil {
+		log.Fatal("Failed to open database", zap.Error(err))
+	}
+	if err = db.Use(repository.NewGormTracing(tp)); err != nil {
+		log.Fatal("Failed to setup GORM tracing", zap.Error(err))
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Fatal("Cannot get DB", zap.Error(err))
+	}
+	registry.MustRegister(collectors.NewDBStatsCollector(sqlDB, filepath.Base(cfg.DB.SQLitePath)))
+
+	migrator := migrateDB(log, db, cfg.DB.AutoMigrate)
+
+	rentals := repository.NewRentalRepository(db, cfg.Repository, log)
+	if cfg.Repository.Seed != "" {
+		loaded, err := seedSQLite(context.Background(), db, rentals, cfg.Repository)
+		if err != nil {
+			log.Fatal("Cannot load the seed fixture", zap.Error(err))
+		}
+		if loaded > 0 {
+			log.Info("Loaded the seed fixture", zap.String("seed", cfg.Repository.Seed), zap.Int("rentals", loaded))
+		}
+	}
+
+	return storage{
+		rentals:  rentals,
+		images:   repository.NewRentalImageRepository(db),
+		apiKeys:  repository.NewAPIKeyRepository(db),
+		db:       sqlDB,
+		migrated: migrator.Check,
+		close:    func() { closeDB(log, db) },
+	}
+}
+
+// migrateDB applies the pending migrations when autoMigrate is set, the service refuses to start on
+// another schema version than the one it was built for
+func migrateDB(log *zap.Logger, db *gorm.DB, autoMigrate bool) *migrate.Migrator {
+	migrator, err := newMigrator(log, db)
+	if err != nil {
+		log.Fatal("Cannot load migrations", zap.Error(err))
+	}
+	if autoMigrate {
+		if _, err = migrator.Up(context.Background()); err != nil {
+			log.Fatal("Migration failed", zap.Error(err))
+		}
+	}
+	if err = migrator.Check(context.Background()); err != nil {
+		log.Fatal("Unexpected database schema", zap.Error(err))
+	}
+	return migrator
+}
+
+// seedSQLite loads the fixture, parsed by the memory backend, into a database which has no rentals, the
+// deleted ones included. It returns the number of loaded rentals.
+func seedSQLite(ctx context.Context, db *gorm.DB, rentals domain.RentalRepository, cfg config.RepositoryConfig) (int, error) {
+	var count int64
+	if err := db.WithContext(ctx).Unscoped().Model(&repository.Rental{}).Count(&count).Error; err != nil || count > 0 {
+		return 0, err
+	}
+
+	fixture := memory.NewRentalRepository(cfg)
+	if err := fixture.LoadFile(cfg.Seed); err != nil {
+		return 0, err
+	}
+	all, err := fixture.FindAll(ctx)
+	if err != nil || len(all) == 0 {
+		return 0, err
+	}
+
+	byID := make(map[int]repository.User)
+	for _, rental := range all {
+		byID[rental.User.ID] = repository.User{Model: gorm.Model{ID: uint(rental.User.ID)}, FirstName: rental.User.FirstName, LastName: rental.User.LastName}
+	}
+	users := make([]repository.User, 0, len(byID))
+	for _, user := range byID {
+		users = append(users, user)
+	}
+	if err = db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&users).Error; err != nil {
+		return 0, err
+	}
+	return len(all), rentals.Upsert(ctx, all)
+}
@@ -0,0 +1,72 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/plar/rentals-api/config"
+)
+
+const ServiceName = "rentals-api"
+
+// Setup installs the global tracer provider and the W3C trace context propagator. Without an exporter
+// spans are still created, the trace ID is propagated downstream and logged but nothing is exported.
+// The returned function flushes the pending spans, call it on shutdown.
+func Setup(ctx context.Context, cfg config.TracingConfig, version string) (func(context.Context) error, error) {
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName(ServiceName),
+			semconv.ServiceVersion(version),
+		)),
+	}
+
+	exporter, err := newExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if exporter != nil {
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp.Shutdown, nil
+}
+
+func newExporter(ctx context.Context, cfg config.TracingConfig) (sdktrace.SpanExporter, error) {
+	switch cfg.Exporter {
+	case "none":
+		return nil, nil
+	case "stdout":
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "otlp":
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, opts...)
+	}
+	return nil, fmt.Errorf("unsupported span exporter %q", cfg.Exporter)
+}
+
+// End records err on span, if any, and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
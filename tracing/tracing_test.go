@@ -0,0 +1,60 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/plar/rentals-api/config"
+	"github.com/plar/rentals-api/logs"
+	"github.com/plar/rentals-api/tracing"
+)
+
+func TestSetup(t *testing.T) {
+	cfg := config.Default().Tracing
+	cfg.Exporter = "unknown"
+	_, err := tracing.Setup(context.Background(), cfg, "test")
+	assert.EqualError(t, err, `unsupported span exporter "unknown"`)
+
+	shutdown, err := tracing.Setup(context.Background(), config.Default().Tracing, "test")
+	require.NoError(t, err)
+	defer shutdown(context.Background())
+
+	core, logged := observer.New(zap.DebugLevel)
+	logger := zap.New(core)
+
+	var sc trace.SpanContext
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(otelgin.Middleware(tracing.ServiceName))
+	router.GET("/rentals/:id", func(c *gin.Context) {
+		sc = trace.SpanContextFromContext(c.Request.Context())
+		logs.WithContext(c.Request.Context(), logger).Info("handled")
+	})
+
+	// the incoming W3C trace context is continued
+	req := httptest.NewRequest("GET", "/rentals/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID().String())
+	assert.True(t, sc.IsSampled())
+	require.Equal(t, 1, logged.Len())
+	fields := logged.All()[0].ContextMap()
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", fields["trace_id"])
+	assert.Equal(t, sc.SpanID().String(), fields["span_id"])
+
+	// a new trace is started without one
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/rentals/1", nil))
+	assert.True(t, sc.IsValid())
+	assert.NotEqual(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID().String())
+}